@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"time"
+
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupsDir    string
+	backupsEngine string
+)
+
+func getBackupsCmd() *cobra.Command {
+	backupsCmd := &cobra.Command{
+		Use:   "backups",
+		Short: "Manage the backups in a --backup-dir.",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the backups in a --backup-dir with their size and age.",
+		Long: `Lists the timestamped backups written by mysql -b and psql -b with
+--backup-dir, newest first. Selective backups are directories holding one file
+per database and are shown with a trailing /.`,
+		RunE:         runBackupsList,
+		SilenceUsage: true,
+	}
+	listCmd.Flags().StringVarP(&backupsDir, "backup-dir", "d", "", "Directory to list")
+	listCmd.Flags().StringVar(&backupsEngine, "engine", "", "Only list backups of this engine: mysql or postgres")
+	listCmd.MarkFlagRequired("backup-dir")
+
+	backupsCmd.AddCommand(listCmd)
+	return backupsCmd
+}
+
+func runBackupsList(cmd *cobra.Command, args []string) error {
+	backups, err := utils.ListBackups(backupsDir)
+	if err != nil {
+		return err
+	}
+	if backupsEngine != "" {
+		var matching []utils.BackupEntry
+		for _, b := range backups {
+			if b.Engine == backupsEngine {
+				matching = append(matching, b)
+			}
+		}
+		backups = matching
+	}
+	utils.PrintBackups(backups, time.Now())
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var keygenOut string
+
+func getKeygenCmd() *cobra.Command {
+	keygenCmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a key pair for encrypted backups.",
+		Long: `Generates a key pair for backups made with --recipient.
+
+The private key is written to the -o file, readable only by its owner, and the
+public key to <file>.pub. Copy the public key to the boxes taking backups and
+keep the private key off them; restores need it passed with --identity.`,
+		RunE:         runKeygen,
+		SilenceUsage: true,
+	}
+	keygenCmd.Flags().StringVarP(&keygenOut, "out", "o", "", "File to write the private key to")
+	keygenCmd.MarkFlagRequired("out")
+	return keygenCmd
+}
+
+func runKeygen(cmd *cobra.Command, args []string) error {
+	private, public, err := utils.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+
+	f, err := utils.CreatePrivateFile(keygenOut)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, private); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keygenOut+".pub", []byte(public+"\n"), 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Private key written to %s\n", keygenOut)
+	fmt.Printf("Public key written to %s.pub\n", keygenOut)
+	fmt.Println(public)
+	return nil
+}
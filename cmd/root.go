@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"ccdc-cli/mysqlModule"
 	"ccdc-cli/psqlModule"
+	"ccdc-cli/utils"
 
 	"github.com/spf13/cobra"
 )
@@ -13,16 +15,25 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "ccdc-cli",
 	Short: "A portable cli tool for ccdc",
+	// Execute prints the error itself
+	SilenceErrors: true,
 }
 
 func init() {
 	rootCmd.AddCommand(mysqlModule.GetmysqlCmd())
 	rootCmd.AddCommand(psqlModule.GetpsqlCmd())
+	rootCmd.AddCommand(getKeygenCmd())
+	rootCmd.AddCommand(getBackupsCmd())
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+
+		var exitErr *utils.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,105 @@
+package mysqlModule
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"ccdc-cli/utils"
+)
+
+// snapshot flattens the report into key/value maps per diff category.
+func (r *InventoryReport) snapshot() map[string]map[string]string {
+	s := map[string]map[string]string{
+		"account":           {},
+		"auth plugin":       {},
+		"grant":             {},
+		"role mapping":      {},
+		"database":          {},
+		"table":             {},
+		"security variable": {},
+		"persistence":       {},
+	}
+
+	for _, u := range r.Users {
+		account := fmt.Sprintf("'%s'@'%s'", u.User, u.Host)
+		s["account"][account] = "password_set=" + strconv.FormatBool(u.PasswordSet)
+		s["auth plugin"][account] = u.Plugin
+	}
+	for _, g := range r.Grants {
+		for _, grant := range g.Grants {
+			s["grant"][grant] = ""
+		}
+	}
+	for _, m := range r.RoleMappings {
+		s["role mapping"][fmt.Sprintf("'%s'@'%s' -> %s", m.User, m.Host, m.Role)] = ""
+	}
+	for _, d := range r.Databases {
+		s["database"][d.Name] = ""
+		for _, t := range d.Tables {
+			s["table"][d.Name+"."+t.Name] = t.Engine
+		}
+	}
+	for _, v := range r.SecurityVars {
+		s["security variable"][v.Name] = v.Value
+	}
+	for _, o := range r.Persistence {
+		s["persistence"][fmt.Sprintf("%s %s.%s", o.Type, o.Schema, o.Name)] = o.Definer + " " + utils.Fingerprint(o.Body)
+	}
+	return s
+}
+
+// securityCategories lists the diff categories that make the command fail.
+// New or dropped databases and tables are reported but are routine.
+var securityCategories = map[string]bool{
+	"account":           true,
+	"auth plugin":       true,
+	"grant":             true,
+	"role mapping":      true,
+	"security variable": true,
+	"persistence":       true,
+}
+
+var diffCategoryOrder = []string{"account", "auth plugin", "grant", "role mapping", "security variable", "persistence", "database", "table"}
+
+func diffReports(base, current *InventoryReport) []utils.Change {
+	baseSnap := base.snapshot()
+	currentSnap := current.snapshot()
+
+	var changes []utils.Change
+	for _, category := range diffCategoryOrder {
+		changes = append(changes, utils.DiffSnapshots(category, securityCategories[category], baseSnap[category], currentSnap[category])...)
+	}
+	if base.AnonymousLogin != current.AnonymousLogin {
+		changes = append(changes, utils.Change{
+			Category: "anonymous login",
+			Kind:     utils.ChangeChanged,
+			Key:      "anonymous_login",
+			Old:      strconv.FormatBool(base.AnonymousLogin),
+			New:      strconv.FormatBool(current.AnonymousLogin),
+			Security: true,
+		})
+	}
+	return changes
+}
+
+// compareWithBaseline diffs report against the baseline stored in path and
+// returns an error when a security relevant change was found.
+func compareWithBaseline(path string, report *InventoryReport) error {
+	var base InventoryReport
+	if err := utils.LoadSnapshot(path, &base); err != nil {
+		return err
+	}
+
+	changes := diffReports(&base, report)
+	if output == utils.OutputText {
+		utils.PrintChanges(changes)
+	} else if err := utils.WriteStructured(os.Stdout, output, changes); err != nil {
+		return err
+	}
+
+	if utils.HasSecurityChange(changes) {
+		return fmt.Errorf("security relevant changes detected since baseline %s", path)
+	}
+	return nil
+}
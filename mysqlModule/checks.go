@@ -0,0 +1,231 @@
+package mysqlModule
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ccdc-cli/utils"
+)
+
+// varCheck is one entry of the security variable catalog. The first of names
+// that exists on the server is checked, so renamed variables (e.g.
+// validate_password_policy and validate_password.policy) share a check.
+type varCheck struct {
+	names       []string
+	expected    string
+	severity    utils.Severity
+	remediation string
+	// required checks fail when none of the names exist on the server
+	required bool
+	pass     func(value string) bool
+}
+
+func isOn(value string) bool {
+	switch strings.ToUpper(value) {
+	case "ON", "1", "YES", "TRUE":
+		return true
+	}
+	return false
+}
+
+func isOff(value string) bool {
+	return !isOn(value)
+}
+
+func equals(want ...string) func(string) bool {
+	return func(value string) bool {
+		for _, w := range want {
+			if strings.EqualFold(value, w) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func notEmpty(value string) bool {
+	return value != "" && value != "NULL"
+}
+
+func isEmpty(value string) bool {
+	return !notEmpty(value)
+}
+
+func atLeast(n int64) func(string) bool {
+	return func(value string) bool {
+		v, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && v >= n
+	}
+}
+
+func between(low, high int64) func(string) bool {
+	return func(value string) bool {
+		v, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && v >= low && v <= high
+	}
+}
+
+var securityChecks = []varCheck{
+	// File and network access
+	{names: []string{"local_infile"}, expected: "OFF", severity: utils.SeverityHigh, pass: isOff,
+		remediation: "SET GLOBAL local_infile = 0 and set local-infile=0 in my.cnf"},
+	{names: []string{"secure_file_priv"}, expected: "a dedicated directory or NULL", severity: utils.SeverityHigh,
+		pass:        func(v string) bool { return v != "" },
+		remediation: "set secure-file-priv to an empty dedicated directory in my.cnf and restart"},
+	{names: []string{"plugin_dir"}, expected: "a root owned directory outside /tmp", severity: utils.SeverityHigh,
+		pass: func(v string) bool {
+			return notEmpty(v) && !strings.HasPrefix(v, "/tmp") && !strings.HasPrefix(v, "/var/tmp") && !strings.HasPrefix(v, "/dev/shm")
+		},
+		remediation: "point plugin-dir at the packaged plugin directory and make it writable by root only"},
+	{names: []string{"bind_address"}, expected: "a specific address", severity: utils.SeverityMedium,
+		pass:        func(v string) bool { return v != "*" && v != "0.0.0.0" && v != "::" && v != "" },
+		remediation: "set bind-address to 127.0.0.1 or the service address in my.cnf"},
+	{names: []string{"skip_networking"}, expected: "ON when only local clients connect", severity: utils.SeverityInfo, pass: isOn,
+		remediation: "set skip-networking in my.cnf if no remote client needs the database"},
+	{names: []string{"skip_name_resolve"}, expected: "ON", severity: utils.SeverityLow, pass: isOn,
+		remediation: "set skip-name-resolve in my.cnf so host grants can't be spoofed through DNS"},
+	{names: []string{"skip_show_database"}, expected: "ON", severity: utils.SeverityLow, pass: isOn,
+		remediation: "set skip-show-database in my.cnf to hide databases users have no access to"},
+
+	// Transport security
+	{names: []string{"have_ssl", "have_openssl"}, expected: "YES", severity: utils.SeverityMedium, pass: equals("YES"),
+		remediation: "configure ssl-cert and ssl-key in my.cnf"},
+	{names: []string{"require_secure_transport"}, expected: "ON", severity: utils.SeverityMedium, pass: isOn,
+		remediation: "SET PERSIST require_secure_transport = ON once clients support TLS"},
+	{names: []string{"tls_version"}, expected: "TLSv1.2 or newer only", severity: utils.SeverityMedium,
+		pass: func(v string) bool {
+			for _, version := range strings.Split(v, ",") {
+				if version = strings.TrimSpace(version); version == "TLSv1" || version == "TLSv1.0" || version == "TLSv1.1" {
+					return false
+				}
+			}
+			return true
+		},
+		remediation: "set tls_version=TLSv1.2,TLSv1.3 in my.cnf"},
+
+	// Authentication and passwords
+	{names: []string{"old_passwords"}, expected: "0", severity: utils.SeverityHigh, pass: equals("0", "OFF"),
+		remediation: "SET GLOBAL old_passwords = 0 and reset any pre-4.1 password hashes"},
+	{names: []string{"secure_auth"}, expected: "ON", severity: utils.SeverityHigh, pass: isOn,
+		remediation: "set secure-auth in my.cnf to refuse pre-4.1 password hashes"},
+	{names: []string{"default_authentication_plugin", "authentication_policy"}, expected: "caching_sha2_password", severity: utils.SeverityLow,
+		pass:        func(v string) bool { return strings.Contains(v, "caching_sha2_password") || strings.HasPrefix(v, "*") },
+		remediation: "set default-authentication-plugin=caching_sha2_password in my.cnf"},
+	{names: []string{"default_password_lifetime"}, expected: "between 1 and 365 days", severity: utils.SeverityLow, pass: between(1, 365),
+		remediation: "SET PERSIST default_password_lifetime = 90"},
+	{names: []string{"password_history"}, expected: "at least 5", severity: utils.SeverityLow, pass: atLeast(5),
+		remediation: "SET PERSIST password_history = 5"},
+	{names: []string{"validate_password.policy", "validate_password_policy"}, expected: "MEDIUM or STRONG", severity: utils.SeverityMedium,
+		required: true, pass: equals("MEDIUM", "STRONG", "1", "2"),
+		remediation: "INSTALL COMPONENT 'file://component_validate_password' (MariaDB: INSTALL SONAME 'simple_password_check') and SET PERSIST validate_password.policy = MEDIUM"},
+	{names: []string{"validate_password.length", "validate_password_length", "simple_password_check_minimal_length"}, expected: "at least 14", severity: utils.SeverityLow,
+		required: true, pass: atLeast(14),
+		remediation: "SET PERSIST validate_password.length = 14"},
+	{names: []string{"validate_password.mixed_case_count", "validate_password_mixed_case_count", "simple_password_check_letters_same_case"}, expected: "at least 1", severity: utils.SeverityLow, pass: atLeast(1),
+		remediation: "SET PERSIST validate_password.mixed_case_count = 1"},
+	{names: []string{"validate_password.number_count", "validate_password_number_count", "simple_password_check_digits"}, expected: "at least 1", severity: utils.SeverityLow, pass: atLeast(1),
+		remediation: "SET PERSIST validate_password.number_count = 1"},
+	{names: []string{"validate_password.special_char_count", "validate_password_special_char_count", "simple_password_check_other_characters"}, expected: "at least 1", severity: utils.SeverityLow, pass: atLeast(1),
+		remediation: "SET PERSIST validate_password.special_char_count = 1"},
+	{names: []string{"max_connect_errors"}, expected: "at most 100", severity: utils.SeverityLow, pass: between(1, 100),
+		remediation: "SET GLOBAL max_connect_errors = 100 to block hosts that brute force logins"},
+
+	// Code execution and persistence
+	{names: []string{"event_scheduler"}, expected: "OFF unless events are required", severity: utils.SeverityMedium, pass: isOff,
+		remediation: "SET GLOBAL event_scheduler = OFF after reviewing the events in the persistence section"},
+	{names: []string{"init_connect"}, expected: "empty", severity: utils.SeverityHigh, pass: isEmpty,
+		remediation: "SET GLOBAL init_connect = '' and remove init-connect from my.cnf"},
+	{names: []string{"init_file"}, expected: "empty", severity: utils.SeverityHigh, pass: isEmpty,
+		remediation: "review the file and remove init-file from my.cnf"},
+	{names: []string{"have_symlink"}, expected: "DISABLED", severity: utils.SeverityMedium, pass: equals("DISABLED", "NO"),
+		remediation: "set skip-symbolic-links in my.cnf"},
+	{names: []string{"automatic_sp_privileges"}, expected: "OFF", severity: utils.SeverityLow, pass: isOff,
+		remediation: "SET GLOBAL automatic_sp_privileges = OFF so routine creators don't get ALTER/EXECUTE automatically"},
+	{names: []string{"sql_mode"}, expected: "STRICT_ALL_TABLES or STRICT_TRANS_TABLES", severity: utils.SeverityLow,
+		pass: func(v string) bool {
+			return strings.Contains(v, "STRICT_ALL_TABLES") || strings.Contains(v, "STRICT_TRANS_TABLES")
+		},
+		remediation: "add STRICT_ALL_TABLES to sql_mode in my.cnf"},
+
+	// Logging
+	{names: []string{"log_error"}, expected: "a log file", severity: utils.SeverityMedium, pass: notEmpty,
+		remediation: "set log-error to a file in my.cnf"},
+	{names: []string{"log_error_verbosity", "log_warnings"}, expected: "at least 2", severity: utils.SeverityLow, pass: atLeast(2),
+		remediation: "SET GLOBAL log_error_verbosity = 2 to log failed logins"},
+	{names: []string{"general_log"}, expected: "ON while under attack", severity: utils.SeverityLow, pass: isOn,
+		remediation: "SET GLOBAL general_log = ON to record every statement (watch the disk usage)"},
+	{names: []string{"log_raw"}, expected: "OFF", severity: utils.SeverityMedium, pass: isOff,
+		remediation: "SET GLOBAL log_raw = OFF so passwords are not written to the general log"},
+	{names: []string{"log_bin"}, expected: "ON", severity: utils.SeverityLow, pass: isOn,
+		remediation: "set log-bin in my.cnf to keep a record of every change"},
+
+	// Informational
+	{names: []string{"version"}, expected: "a supported release", severity: utils.SeverityInfo,
+		pass: func(string) bool { return true }},
+}
+
+// showVariables returns every global server variable. NULL values are
+// reported as the string NULL.
+func showVariables(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SHOW GLOBAL VARIABLES")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vars := map[string]string{}
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			vars[strings.ToLower(name)] = value.String
+		} else {
+			vars[strings.ToLower(name)] = "NULL"
+		}
+	}
+	return vars, rows.Err()
+}
+
+// evaluateSecurityChecks runs the catalog against the server variables and
+// returns the results with failing checks first, most severe first.
+func evaluateSecurityChecks(vars map[string]string) []SecurityVar {
+	var results []SecurityVar
+	for _, check := range securityChecks {
+		result := SecurityVar{
+			Name:        check.names[0],
+			Expected:    check.expected,
+			Severity:    check.severity,
+			Remediation: check.remediation,
+		}
+
+		found := false
+		for _, name := range check.names {
+			if value, ok := vars[name]; ok {
+				result.Name, result.Value, found = name, value, true
+				break
+			}
+		}
+		if !found {
+			if !check.required {
+				continue
+			}
+			result.Value = "(not set)"
+		} else {
+			result.Passed = check.pass(result.Value)
+		}
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Passed != results[j].Passed {
+			return !results[i].Passed
+		}
+		return results[i].Severity > results[j].Severity
+	})
+	return results
+}
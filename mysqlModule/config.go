@@ -0,0 +1,449 @@
+package mysqlModule
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configFiles   []string
+	configOffline bool
+)
+
+// defaultConfigFiles are read in the order mysqld and mariadbd read them.
+var defaultConfigFiles = []string{
+	"/etc/my.cnf",
+	"/etc/mysql/my.cnf",
+	"/usr/etc/my.cnf",
+}
+
+// defaultConfigDirs are included by the stock Debian and RHEL configs and are
+// read even when the include line was removed, since an attacker may have
+// disabled it temporarily.
+var defaultConfigDirs = []string{
+	"/etc/mysql/conf.d",
+	"/etc/mysql/mariadb.conf.d",
+	"/etc/mysql/mysql.conf.d",
+	"/etc/my.cnf.d",
+}
+
+type ConfigOption struct {
+	File    string `json:"file" yaml:"file"`
+	Line    int    `json:"line" yaml:"line"`
+	Section string `json:"section" yaml:"section"`
+	Name    string `json:"name" yaml:"name"`
+	Value   string `json:"value" yaml:"value"`
+	HasVal  bool   `json:"-" yaml:"-"`
+}
+
+type ConfigIssue struct {
+	Option  string `json:"option" yaml:"option"`
+	Value   string `json:"value" yaml:"value"`
+	Source  string `json:"source" yaml:"source"`
+	Problem string `json:"problem" yaml:"problem"`
+}
+
+type ConfigDrift struct {
+	Variable  string `json:"variable" yaml:"variable"`
+	FileValue string `json:"file_value" yaml:"file_value"`
+	LiveValue string `json:"live_value" yaml:"live_value"`
+	Source    string `json:"source" yaml:"source"`
+}
+
+type ConfigAudit struct {
+	Files   []string       `json:"files" yaml:"files"`
+	Options []ConfigOption `json:"options" yaml:"options"`
+	Issues  []ConfigIssue  `json:"issues" yaml:"issues"`
+	Drift   []ConfigDrift  `json:"drift" yaml:"drift"`
+	Errors  []string       `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+func getConfigAuditCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config-audit",
+		Short: "Audit the MySQL server configuration files.",
+		Long: `Find and parse my.cnf and every file it pulls in with !include and
+!includedir (including conf.d and mariadb.conf.d) and report dangerous
+server options such as bind-address=0.0.0.0, skip-grant-tables,
+local-infile=1, an empty secure-file-priv and init-file.
+
+Unless --offline is given the file settings are compared with the live values
+from SHOW VARIABLES to point out drift.`,
+		RunE:         runConfigAudit,
+		SilenceUsage: true,
+	}
+	configCmd.Flags().StringSliceVarP(&configFiles, "config", "c", nil, "Config files to audit instead of the default locations")
+	configCmd.Flags().BoolVar(&configOffline, "offline", false, "Do not compare with the live server")
+	configCmd.Flags().StringVarP(&output, "output", "o", utils.OutputText, "Output format: text, json or yaml")
+	return configCmd
+}
+
+func runConfigAudit(cmd *cobra.Command, args []string) error {
+	if err := utils.ValidateOutputFormat(output); err != nil {
+		return err
+	}
+
+	audit := &ConfigAudit{}
+	parser := &configParser{seen: map[string]bool{}, audit: audit}
+
+	if len(configFiles) > 0 {
+		for _, f := range configFiles {
+			parser.parseFile(f, true)
+		}
+	} else {
+		for _, f := range defaultConfigFiles {
+			parser.parseFile(f, false)
+		}
+		for _, d := range defaultConfigDirs {
+			parser.parseDir(d, false)
+		}
+	}
+	if len(audit.Files) == 0 {
+		return fmt.Errorf("no MySQL configuration files found, use --config to point at one")
+	}
+
+	effective := effectiveServerOptions(audit.Options)
+	audit.Issues = checkConfigOptions(effective)
+	audit.Issues = append(audit.Issues, checkConfigFilePermissions(audit)...)
+
+	if !configOffline {
+		live, err := liveVariables()
+		if err != nil {
+			audit.Errors = append(audit.Errors, fmt.Sprintf("live comparison skipped: %v", err))
+		} else {
+			audit.Drift = compareConfigWithLive(effective, live)
+		}
+	}
+
+	if output != utils.OutputText {
+		return utils.WriteStructured(os.Stdout, output, audit)
+	}
+	printConfigAuditText(audit)
+	return nil
+}
+
+type configParser struct {
+	seen  map[string]bool
+	audit *ConfigAudit
+}
+
+func (p *configParser) parseDir(dir string, required bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if required {
+			p.audit.Errors = append(p.audit.Errors, err.Error())
+		}
+		return
+	}
+	// Files in an included directory are read in name order
+	for _, e := range entries {
+		if !e.IsDir() && (strings.HasSuffix(e.Name(), ".cnf") || strings.HasSuffix(e.Name(), ".ini")) {
+			p.parseFile(filepath.Join(dir, e.Name()), true)
+		}
+	}
+}
+
+func (p *configParser) parseFile(path string, required bool) {
+	path = filepath.Clean(path)
+	if p.seen[path] {
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if required {
+			p.audit.Errors = append(p.audit.Errors, err.Error())
+		}
+		return
+	}
+	defer f.Close()
+	p.seen[path] = true
+	p.audit.Files = append(p.audit.Files, path)
+
+	section := ""
+	lineNo := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case strings.HasPrefix(line, "!includedir"):
+			p.parseDir(strings.TrimSpace(strings.TrimPrefix(line, "!includedir")), true)
+			continue
+		case strings.HasPrefix(line, "!include"):
+			p.parseFile(strings.TrimSpace(strings.TrimPrefix(line, "!include")), true)
+			continue
+		case line[0] == '[':
+			section = strings.ToLower(strings.Trim(line, "[] "))
+			continue
+		}
+
+		opt := ConfigOption{File: path, Line: lineNo, Section: section}
+		name, value, hasVal := strings.Cut(line, "=")
+		opt.Name = normalizeOptionName(name)
+		if hasVal {
+			opt.Value = unquoteOptionValue(value)
+			opt.HasVal = true
+		}
+		p.audit.Options = append(p.audit.Options, opt)
+	}
+}
+
+func normalizeOptionName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.ReplaceAll(name, "-", "_")
+	return strings.TrimPrefix(name, "loose_")
+}
+
+func unquoteOptionValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	// Unquoted values end at an inline comment
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+func isServerSection(section string) bool {
+	switch section {
+	case "mysqld", "server", "mariadb", "mariadbd":
+		return true
+	}
+	for _, prefix := range []string{"mysqld-", "mariadb-", "mariadbd-"} {
+		if strings.HasPrefix(section, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveServerOptions returns the server options in effect, the last
+// occurrence of an option wins.
+func effectiveServerOptions(options []ConfigOption) map[string]ConfigOption {
+	effective := map[string]ConfigOption{}
+	for _, opt := range options {
+		if isServerSection(opt.Section) {
+			effective[opt.Name] = opt
+		}
+	}
+	return effective
+}
+
+func (o ConfigOption) source() string {
+	return fmt.Sprintf("%s:%d", o.File, o.Line)
+}
+
+// boolValue normalizes a boolean option value to ON or OFF. Options given
+// without a value are enabled.
+func boolValue(opt ConfigOption) string {
+	if !opt.HasVal {
+		return "ON"
+	}
+	switch strings.ToLower(opt.Value) {
+	case "1", "on", "true", "yes", "force_plus_permanent", "force":
+		return "ON"
+	case "0", "off", "false", "no":
+		return "OFF"
+	}
+	return strings.ToUpper(opt.Value)
+}
+
+func checkConfigOptions(effective map[string]ConfigOption) []ConfigIssue {
+	var issues []ConfigIssue
+	add := func(opt ConfigOption, problem string) {
+		issues = append(issues, ConfigIssue{Option: opt.Name, Value: opt.Value, Source: opt.source(), Problem: problem})
+	}
+
+	if opt, ok := effective["bind_address"]; ok {
+		switch opt.Value {
+		case "0.0.0.0", "*", "::", "":
+			add(opt, "server listens on every interface")
+		}
+	}
+	if opt, ok := effective["skip_grant_tables"]; ok && boolValue(opt) == "ON" {
+		add(opt, "privilege checks are disabled, anyone can log in as any user")
+	}
+	if opt, ok := effective["skip_networking"]; ok && boolValue(opt) == "OFF" {
+		add(opt, "networking is explicitly enabled")
+	}
+	if opt, ok := effective["local_infile"]; ok && boolValue(opt) == "ON" {
+		add(opt, "clients can read local files with LOAD DATA LOCAL")
+	}
+	if opt, ok := effective["secure_file_priv"]; ok && opt.Value == "" {
+		add(opt, "file import/export is allowed in every directory")
+	}
+	if opt, ok := effective["init_file"]; ok {
+		add(opt, "SQL from this file runs as a superuser at every start")
+	}
+	if opt, ok := effective["init_connect"]; ok && opt.Value != "" {
+		add(opt, "SQL runs for every new connection")
+	}
+	for _, name := range []string{"plugin_load", "plugin_load_add"} {
+		if opt, ok := effective[name]; ok {
+			add(opt, "loads server plugins at startup")
+		}
+	}
+	if opt, ok := effective["allow_suspicious_udfs"]; ok && boolValue(opt) == "ON" {
+		add(opt, "UDFs without the usual symbol checks can be loaded")
+	}
+	if opt, ok := effective["symbolic_links"]; ok && boolValue(opt) == "ON" {
+		add(opt, "symbolic links to tables outside the data directory are allowed")
+	}
+	if opt, ok := effective["old_passwords"]; ok && boolValue(opt) == "ON" {
+		add(opt, "weak pre-4.1 password hashing is used")
+	}
+	return issues
+}
+
+func checkConfigFilePermissions(audit *ConfigAudit) []ConfigIssue {
+	hasPassword := map[string]bool{}
+	for _, opt := range audit.Options {
+		if opt.Name == "password" && opt.Value != "" {
+			hasPassword[opt.File] = true
+		}
+	}
+
+	var issues []ConfigIssue
+	for _, f := range audit.Files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		mode := info.Mode().Perm()
+		if mode&0002 != 0 {
+			issues = append(issues, ConfigIssue{Option: "(file mode)", Value: mode.String(), Source: f,
+				Problem: "file is world-writable (mysqld ignores it, but anyone can change it)"})
+		}
+		if hasPassword[f] && mode&0044 != 0 {
+			issues = append(issues, ConfigIssue{Option: "password", Value: mode.String(), Source: f,
+				Problem: "file stores a password and is readable by other users"})
+		}
+	}
+	return issues
+}
+
+func liveVariables() (map[string]string, error) {
+	password, err := utils.GetPassword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password")
+	}
+
+	db, err := connectToDatabase(username, password, host, port, dbName, output == utils.OutputText)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return showVariables(db)
+}
+
+// configVariable maps a config option to the server variable it sets and the
+// value that variable should have.
+func configVariable(opt ConfigOption, live map[string]string) (string, string, bool) {
+	if _, ok := live[opt.Name]; ok {
+		return opt.Name, opt.Value, true
+	}
+	// skip-foo, disable-foo and enable-foo set the boolean variable foo
+	for prefix, value := range map[string]string{"skip_": "OFF", "disable_": "OFF", "enable_": "ON"} {
+		name := strings.TrimPrefix(opt.Name, prefix)
+		if name == opt.Name {
+			continue
+		}
+		if _, ok := live[name]; ok {
+			if boolValue(opt) == "OFF" {
+				value = map[string]string{"ON": "OFF", "OFF": "ON"}[value]
+			}
+			return name, value, true
+		}
+	}
+	return "", "", false
+}
+
+func sameConfigValue(fileValue string, hasVal bool, liveValue string) bool {
+	normalize := func(v string) string {
+		v = strings.TrimSpace(v)
+		switch strings.ToLower(v) {
+		case "1", "on", "true", "yes":
+			return "ON"
+		case "0", "off", "false", "no":
+			return "OFF"
+		}
+		return strings.TrimRight(v, "/")
+	}
+	if !hasVal {
+		fileValue = "ON"
+	}
+	if normalize(fileValue) == normalize(liveValue) {
+		return true
+	}
+
+	// Sizes may be written with a K, M or G suffix
+	if n, err := strconv.ParseInt(liveValue, 10, 64); err == nil && len(fileValue) > 1 {
+		multiplier := map[byte]int64{'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30}[strings.ToLower(fileValue)[len(fileValue)-1]]
+		if base, err := strconv.ParseInt(fileValue[:len(fileValue)-1], 10, 64); err == nil && multiplier != 0 {
+			return base*multiplier == n
+		}
+	}
+	return false
+}
+
+func compareConfigWithLive(effective map[string]ConfigOption, live map[string]string) []ConfigDrift {
+	var drift []ConfigDrift
+	for _, opt := range effective {
+		name, expected, ok := configVariable(opt, live)
+		if !ok {
+			continue
+		}
+		hasVal := opt.HasVal || name != opt.Name
+		if !sameConfigValue(expected, hasVal, live[name]) {
+			drift = append(drift, ConfigDrift{Variable: name, FileValue: expected, LiveValue: live[name], Source: opt.source()})
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Variable < drift[j].Variable })
+	return drift
+}
+
+func printConfigAuditText(audit *ConfigAudit) {
+	utils.PrintHeader("CONFIGURATION FILES")
+	for _, f := range audit.Files {
+		fmt.Printf("  |-- %s\n", f)
+	}
+	for _, e := range audit.Errors {
+		fmt.Printf("  [?] %s\n", e)
+	}
+
+	utils.PrintHeader("DANGEROUS OPTIONS")
+	if len(audit.Issues) == 0 {
+		fmt.Println("No dangerous options found")
+	}
+	for _, issue := range audit.Issues {
+		fmt.Printf("  [!] %-22s = %-15s | %s\n", issue.Option, issue.Value, issue.Source)
+		fmt.Printf("        |-- %s\n", issue.Problem)
+	}
+
+	if configOffline {
+		return
+	}
+	utils.PrintHeader("DRIFT BETWEEN FILES AND LIVE SERVER")
+	if len(audit.Drift) == 0 {
+		fmt.Println("No drift found")
+		return
+	}
+	fmt.Printf("  %-30s | %-20s | %-20s | %s\n", "Variable", "File", "Live", "Source")
+	for _, d := range audit.Drift {
+		fmt.Printf("  %-30s | %-20s | %-20s | %s\n", d.Variable, d.FileValue, d.LiveValue, d.Source)
+	}
+}
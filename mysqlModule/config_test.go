@@ -0,0 +1,111 @@
+package mysqlModule
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "conf.d")
+	os.MkdirAll(confd, 0700)
+	main := filepath.Join(dir, "my.cnf")
+	extra := filepath.Join(dir, "extra.cnf")
+
+	os.WriteFile(main, []byte(`# global options
+[client]
+password = secret
+
+[mysqld]
+bind-address = 0.0.0.0
+loose-local-infile=1
+secure_file_priv = "/var/lib/mysql files"
+init_connect = SET NAMES utf8 # inline comment
+; another comment
+skip-grant-tables
+!include `+extra+`
+!include `+main+`
+!includedir `+confd+`
+`), 0600)
+	os.WriteFile(extra, []byte("[mysqld-8.0]\nbind_address = 127.0.0.1\n"), 0600)
+	os.WriteFile(filepath.Join(confd, "b.cnf"), []byte("[mysqld]\nLOCAL_INFILE = OFF\n"), 0600)
+	os.WriteFile(filepath.Join(confd, "a.cnf"), []byte("[Server]\nsymbolic-links='0'\n"), 0600)
+	os.WriteFile(filepath.Join(confd, "notes.txt"), []byte("[mysqld]\nskip_networking\n"), 0600)
+
+	audit := &ConfigAudit{}
+	p := &configParser{seen: map[string]bool{}, audit: audit}
+	p.parseFile(main, true)
+	p.parseFile(filepath.Join(dir, "missing.cnf"), false)
+
+	wantFiles := []string{main, extra, filepath.Join(confd, "a.cnf"), filepath.Join(confd, "b.cnf")}
+	if !slices.Equal(audit.Files, wantFiles) {
+		t.Errorf("files = %v, want %v", audit.Files, wantFiles)
+	}
+	if len(audit.Errors) != 0 {
+		t.Errorf("unexpected errors %v", audit.Errors)
+	}
+
+	want := []ConfigOption{
+		{File: main, Line: 3, Section: "client", Name: "password", Value: "secret", HasVal: true},
+		{File: main, Line: 6, Section: "mysqld", Name: "bind_address", Value: "0.0.0.0", HasVal: true},
+		{File: main, Line: 7, Section: "mysqld", Name: "local_infile", Value: "1", HasVal: true},
+		{File: main, Line: 8, Section: "mysqld", Name: "secure_file_priv", Value: "/var/lib/mysql files", HasVal: true},
+		{File: main, Line: 9, Section: "mysqld", Name: "init_connect", Value: "SET NAMES utf8", HasVal: true},
+		{File: main, Line: 11, Section: "mysqld", Name: "skip_grant_tables"},
+		{File: extra, Line: 2, Section: "mysqld-8.0", Name: "bind_address", Value: "127.0.0.1", HasVal: true},
+		{File: filepath.Join(confd, "a.cnf"), Line: 2, Section: "server", Name: "symbolic_links", Value: "0", HasVal: true},
+		{File: filepath.Join(confd, "b.cnf"), Line: 2, Section: "mysqld", Name: "local_infile", Value: "OFF", HasVal: true},
+	}
+	if !reflect.DeepEqual(audit.Options, want) {
+		t.Errorf("options =\n%+v\nwant\n%+v", audit.Options, want)
+	}
+
+	effective := effectiveServerOptions(audit.Options)
+	if _, ok := effective["password"]; ok {
+		t.Error("a [client] option was taken as a server option")
+	}
+	for name, value := range map[string]string{"bind_address": "127.0.0.1", "local_infile": "OFF", "symbolic_links": "0"} {
+		if got := effective[name].Value; got != value {
+			t.Errorf("effective %s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestParseConfigFileMissing(t *testing.T) {
+	audit := &ConfigAudit{}
+	p := &configParser{seen: map[string]bool{}, audit: audit}
+	p.parseFile(filepath.Join(t.TempDir(), "my.cnf"), true)
+	if len(audit.Errors) != 1 || len(audit.Files) != 0 {
+		t.Errorf("errors = %v, files = %v", audit.Errors, audit.Files)
+	}
+}
+
+func TestSameConfigValue(t *testing.T) {
+	tests := []struct {
+		file   string
+		hasVal bool
+		live   string
+		want   bool
+	}{
+		{"1", true, "ON", true},
+		{"true", true, "ON", true},
+		{"off", true, "OFF", true},
+		{"", false, "ON", true},
+		{"", false, "OFF", false},
+		{"OFF", true, "ON", false},
+		{"64M", true, "67108864", true},
+		{"16k", true, "16384", true},
+		{"1G", true, "1024", false},
+		{"64M", true, "64M", true},
+		{"/var/lib/mysql-files/", true, "/var/lib/mysql-files", true},
+		{"0.0.0.0", true, "127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := sameConfigValue(tt.file, tt.hasVal, tt.live); got != tt.want {
+			t.Errorf("sameConfigValue(%q, %t, %q) = %t, want %t", tt.file, tt.hasVal, tt.live, got, tt.want)
+		}
+	}
+}
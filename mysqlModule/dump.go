@@ -0,0 +1,542 @@
+package mysqlModule
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"ccdc-cli/utils"
+)
+
+// skippedSchemas are never dumped. The mysql schema is replaced by CREATE
+// USER and GRANT statements so the dump loads on other server versions.
+var skippedSchemas = []string{"mysql", "information_schema", "performance_schema", "sys"}
+
+// maxInsertSize is the approximate size of one extended INSERT statement.
+const maxInsertSize = 1 << 20
+
+var dumpEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	"\x00", `\0`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x1a", `\Z`,
+)
+
+// dumper writes a logical backup in the format of mysqldump using a single
+// connection inside a consistent snapshot transaction.
+type dumper struct {
+	ctx  context.Context
+	conn *sql.Conn
+	w    *bufio.Writer
+	// views are created at the end of the dump, once every table, routine
+	// and placeholder they can reference exists
+	views []dumpView
+	// sel limits the dump to some databases and tables, nil dumps everything
+	sel *utils.Selector
+}
+
+type dumpView struct {
+	schema, name, create string
+}
+
+func (d *dumper) printf(format string, args ...any) {
+	fmt.Fprintf(d.w, format, args...)
+}
+
+// nativeBackup dumps every user database, the accounts and their grants to w
+// without the mysqldump binary. With an active selector only the selected
+// databases and tables are dumped, without accounts.
+func nativeBackup(ctx context.Context, password string, w io.Writer, sel *utils.Selector) error {
+	// parseTime is left off so temporal values, including zero dates, are
+	// copied exactly as the server prints them
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/", username, password, host, port)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, stmt := range []string{
+		"SET SESSION time_zone = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	defer conn.ExecContext(ctx, "ROLLBACK")
+
+	d := &dumper{ctx: ctx, conn: conn, w: bufio.NewWriterSize(w, 1<<16), sel: sel}
+	if err := d.dump(); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
+
+func (d *dumper) dump() error {
+	d.printf("-- ccdc-cli native MySQL dump\n")
+	d.printf("-- Host: %s:%d    Date: %s\n\n", host, port, time.Now().UTC().Format(time.RFC3339))
+	d.printf("SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT;\n")
+	d.printf("SET NAMES utf8mb4;\n")
+	d.printf("SET @OLD_TIME_ZONE=@@TIME_ZONE, TIME_ZONE='+00:00';\n")
+	d.printf("SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;\n")
+	d.printf("SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;\n")
+	d.printf("SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO';\n\n")
+
+	if _, err := d.conn.ExecContext(d.ctx, "SET NAMES utf8mb4"); err != nil {
+		return err
+	}
+
+	schemas, err := d.queryStrings("SHOW DATABASES")
+	if err != nil {
+		return fmt.Errorf("could not list databases: %w", err)
+	}
+	for _, schema := range schemas {
+		if slices.Contains(skippedSchemas, strings.ToLower(schema)) || !d.sel.IncludesDatabase(schema) {
+			continue
+		}
+		fmt.Printf("  |-- Dumping %s\n", schema)
+		if err := d.dumpSchema(schema); err != nil {
+			return fmt.Errorf("%s: %w", schema, err)
+		}
+	}
+
+	if len(d.views) > 0 {
+		d.printf("--\n-- Views\n--\n\n")
+	}
+	for _, v := range d.views {
+		d.printf("USE %s;\n", quoteIdent(v.schema))
+		d.printf("DROP VIEW IF EXISTS %s;\n", quoteIdent(v.name))
+		d.printf("%s;\n\n", v.create)
+	}
+
+	// accounts are instance wide, a partial backup leaves them out
+	if !d.sel.Active() {
+		if err := d.dumpUsers(); err != nil {
+			return err
+		}
+	}
+
+	d.printf("SET SQL_MODE=@OLD_SQL_MODE;\n")
+	d.printf("SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;\n")
+	d.printf("SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;\n")
+	d.printf("SET TIME_ZONE=@OLD_TIME_ZONE;\n")
+	d.printf("SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT;\n")
+	d.printf("\n-- Dump completed %s\n", time.Now().UTC().Format(time.RFC3339))
+	return nil
+}
+
+func (d *dumper) dumpSchema(schema string) error {
+	create, err := d.showCreate("SHOW CREATE DATABASE IF NOT EXISTS "+quoteIdent(schema), 1)
+	if err != nil {
+		return err
+	}
+	d.printf("--\n-- Database %s\n--\n\n", quoteIdent(schema))
+	d.printf("%s;\n", create)
+	d.printf("USE %s;\n\n", quoteIdent(schema))
+
+	rows, err := d.conn.QueryContext(d.ctx, `
+		SELECT TABLE_NAME, TABLE_TYPE FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME`, schema)
+	if err != nil {
+		return err
+	}
+	var tables, views []string
+	for rows.Next() {
+		var name, kind string
+		if err := rows.Scan(&name, &kind); err != nil {
+			rows.Close()
+			return err
+		}
+		if !d.sel.IncludesTable(schema, "", name) {
+			continue
+		}
+		if kind == "VIEW" {
+			views = append(views, name)
+		} else {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := d.dumpTable(schema, table); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+	for _, view := range views {
+		if err := d.dumpViewPlaceholder(schema, view); err != nil {
+			return fmt.Errorf("view %s: %w", view, err)
+		}
+	}
+	if err := d.dumpTriggers(schema); err != nil {
+		return err
+	}
+	if err := d.dumpRoutines(schema); err != nil {
+		return err
+	}
+	return d.dumpEvents(schema)
+}
+
+func (d *dumper) dumpTable(schema, table string) error {
+	create, err := d.showCreate(fmt.Sprintf("SHOW CREATE TABLE %s.%s", quoteIdent(schema), quoteIdent(table)), 1)
+	if err != nil {
+		return err
+	}
+	d.printf("DROP TABLE IF EXISTS %s;\n", quoteIdent(table))
+	d.printf("%s;\n\n", create)
+
+	// generated columns are computed by the server and can't be inserted.
+	// Columns with a default expression are DEFAULT_GENERATED and are kept,
+	// MySQL may append INVISIBLE and older MariaDB uses VIRTUAL or PERSISTENT.
+	columns, err := d.queryStrings(`
+		SELECT COLUMN_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		AND EXTRA NOT LIKE 'VIRTUAL GENERATED%' AND EXTRA NOT LIKE 'STORED GENERATED%'
+		AND EXTRA NOT IN ('VIRTUAL', 'PERSISTENT', 'STORED')
+		ORDER BY ORDINAL_POSITION`, schema, table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = quoteIdent(c)
+	}
+	columnList := strings.Join(quoted, ", ")
+
+	// no query arguments so the text protocol returns every value as the
+	// server formats it
+	rows, err := d.conn.QueryContext(d.ctx, fmt.Sprintf("SELECT %s FROM %s.%s", columnList, quoteIdent(schema), quoteIdent(table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdent(table), columnList)
+	var stmt strings.Builder
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if stmt.Len() == 0 {
+			stmt.WriteString(prefix)
+		} else {
+			stmt.WriteString(",")
+		}
+		stmt.WriteString("(")
+		for i, v := range values {
+			if i > 0 {
+				stmt.WriteString(",")
+			}
+			stmt.WriteString(sqlValue(types[i].DatabaseTypeName(), v))
+		}
+		stmt.WriteString(")")
+
+		if stmt.Len() >= maxInsertSize {
+			d.printf("%s;\n", stmt.String())
+			stmt.Reset()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if stmt.Len() > 0 {
+		d.printf("%s;\n", stmt.String())
+	}
+	d.printf("\n")
+	return nil
+}
+
+// sqlValue formats a value read over the text protocol as a SQL literal.
+func sqlValue(typeName string, v sql.RawBytes) string {
+	if v == nil {
+		return "NULL"
+	}
+	typeName = strings.TrimPrefix(typeName, "UNSIGNED ")
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+		return string(v)
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		if len(v) == 0 {
+			return "''"
+		}
+		return "0x" + hex.EncodeToString(v)
+	}
+	return "'" + dumpEscaper.Replace(string(v)) + "'"
+}
+
+// dumpViewPlaceholder writes a stand-in view with the same columns so views
+// and routines that reference it can be created before the real definition.
+func (d *dumper) dumpViewPlaceholder(schema, view string) error {
+	columns, err := d.queryStrings(`
+		SELECT COLUMN_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION`, schema, view)
+	if err != nil {
+		return err
+	}
+	create, err := d.showCreate(fmt.Sprintf("SHOW CREATE VIEW %s.%s", quoteIdent(schema), quoteIdent(view)), 1)
+	if err != nil {
+		return err
+	}
+
+	placeholder := make([]string, len(columns))
+	for i, c := range columns {
+		placeholder[i] = "1 AS " + quoteIdent(c)
+	}
+	if len(placeholder) == 0 {
+		placeholder = []string{"1"}
+	}
+	d.printf("DROP VIEW IF EXISTS %s;\n", quoteIdent(view))
+	d.printf("CREATE VIEW %s AS SELECT %s;\n\n", quoteIdent(view), strings.Join(placeholder, ", "))
+
+	d.views = append(d.views, dumpView{schema: schema, name: view, create: create})
+	return nil
+}
+
+// dumpObjects writes stored objects between DELIMITER ;; markers with the
+// sql_mode they were created under.
+func (d *dumper) dumpObjects(kind, schema string, names []string, createColumn int) error {
+	if len(names) == 0 {
+		return nil
+	}
+	d.printf("DELIMITER ;;\n")
+	for _, name := range names {
+		query := fmt.Sprintf("SHOW CREATE %s %s.%s", kind, quoteIdent(schema), quoteIdent(name))
+		columns, err := d.showCreateColumns(query)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", strings.ToLower(kind), name, err)
+		}
+		if createColumn >= len(columns) || !columns[createColumn].Valid {
+			return fmt.Errorf("%s %s: definition not readable, the dump user needs more privileges", strings.ToLower(kind), name)
+		}
+		d.printf("SET SESSION sql_mode = %s;;\n", quoteLiteral(columns[1].String))
+		d.printf("DROP %s IF EXISTS %s;;\n", kind, quoteIdent(name))
+		d.printf("%s;;\n", columns[createColumn].String)
+	}
+	d.printf("DELIMITER ;\n")
+	d.printf("SET SESSION sql_mode = 'NO_AUTO_VALUE_ON_ZERO';\n\n")
+	return nil
+}
+
+func (d *dumper) dumpTriggers(schema string) error {
+	rows, err := d.conn.QueryContext(d.ctx, `
+		SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE FROM information_schema.TRIGGERS
+		WHERE TRIGGER_SCHEMA = ? ORDER BY EVENT_OBJECT_TABLE, ACTION_ORDER`, schema)
+	if err != nil {
+		return fmt.Errorf("could not list triggers: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name, table string
+		if err := rows.Scan(&name, &table); err != nil {
+			rows.Close()
+			return err
+		}
+		if d.sel.IncludesTable(schema, "", table) {
+			names = append(names, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not list triggers: %w", err)
+	}
+	return d.dumpObjects("TRIGGER", schema, names, 2)
+}
+
+func (d *dumper) dumpRoutines(schema string) error {
+	for _, kind := range []string{"FUNCTION", "PROCEDURE"} {
+		names, err := d.queryStrings(`
+			SELECT ROUTINE_NAME FROM information_schema.ROUTINES
+			WHERE ROUTINE_SCHEMA = ? AND ROUTINE_TYPE = ? ORDER BY ROUTINE_NAME`, schema, kind)
+		if err != nil {
+			return fmt.Errorf("could not list routines: %w", err)
+		}
+		if err := d.dumpObjects(kind, schema, names, 2); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dumper) dumpEvents(schema string) error {
+	names, err := d.queryStrings(`
+		SELECT EVENT_NAME FROM information_schema.EVENTS
+		WHERE EVENT_SCHEMA = ? ORDER BY EVENT_NAME`, schema)
+	if err != nil {
+		return fmt.Errorf("could not list events: %w", err)
+	}
+	return d.dumpObjects("EVENT", schema, names, 3)
+}
+
+// dumpUsers writes every account followed by its grants. All accounts are
+// created first so role grants can reference roles defined later.
+func (d *dumper) dumpUsers() error {
+	accounts, err := d.queryAccounts()
+	if err != nil {
+		return fmt.Errorf("could not list accounts: %w", err)
+	}
+
+	// Binary password hashes are printed as hex so the dump stays valid
+	// text. MySQL before 8.0.17 and MariaDB don't have the variable.
+	d.conn.ExecContext(d.ctx, "SET SESSION print_identified_with_as_hex = ON")
+
+	d.printf("--\n-- Accounts\n--\n\n")
+	for _, a := range accounts {
+		if a.role {
+			d.printf("CREATE ROLE IF NOT EXISTS %s;\n", a.name())
+			continue
+		}
+		create, err := d.showCreate("SHOW CREATE USER "+a.name(), 0)
+		if err != nil {
+			d.printf("-- could not read %s: %v\n", a.name(), err)
+			continue
+		}
+		create = strings.Replace(create, "CREATE USER ", "CREATE USER IF NOT EXISTS ", 1)
+		d.printf("%s;\n", create)
+	}
+	d.printf("\n")
+
+	for _, a := range accounts {
+		grants, err := d.queryStrings("SHOW GRANTS FOR " + a.name())
+		if err != nil {
+			d.printf("-- could not read grants for %s: %v\n", a.name(), err)
+			continue
+		}
+		for _, grant := range grants {
+			d.printf("%s;\n", grant)
+		}
+	}
+	d.printf("FLUSH PRIVILEGES;\n\n")
+	return nil
+}
+
+type dumpAccount struct {
+	user, host string
+	// role is set for MariaDB roles, which have no host and no SHOW CREATE
+	// USER. MySQL 8 roles are locked accounts and dumped as such.
+	role bool
+}
+
+func (a dumpAccount) name() string {
+	if a.role {
+		return quoteLiteral(a.user)
+	}
+	return quoteAccount(a.user, a.host)
+}
+
+func (d *dumper) queryAccounts() ([]dumpAccount, error) {
+	query := "SELECT User, Host, %s FROM mysql.user ORDER BY User, Host"
+	rows, err := d.conn.QueryContext(d.ctx, fmt.Sprintf(query, "is_role = 'Y'"))
+	if err != nil {
+		// only MariaDB has is_role
+		rows, err = d.conn.QueryContext(d.ctx, fmt.Sprintf(query, "false"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []dumpAccount
+	for rows.Next() {
+		var a dumpAccount
+		if err := rows.Scan(&a.user, &a.host, &a.role); err != nil {
+			return nil, err
+		}
+		if slices.Contains(systemAccounts, a.user) {
+			continue
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// queryStrings returns the first column of every row.
+func (d *dumper) queryStrings(query string, args ...any) ([]string, error) {
+	rows, err := d.conn.QueryContext(d.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+func (d *dumper) showCreateColumns(query string) ([]sql.NullString, error) {
+	rows, err := d.conn.QueryContext(d.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no result from %s", query)
+	}
+	columns := make([]sql.NullString, len(names))
+	dest := make([]any, len(names))
+	for i := range columns {
+		dest[i] = &columns[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// showCreate runs a SHOW CREATE statement and returns the given column.
+func (d *dumper) showCreate(query string, column int) (string, error) {
+	columns, err := d.showCreateColumns(query)
+	if err != nil {
+		return "", err
+	}
+	if column >= len(columns) || !columns[column].Valid {
+		return "", fmt.Errorf("no definition returned by %s", query)
+	}
+	return columns[column].String, nil
+}
@@ -0,0 +1,34 @@
+package mysqlModule
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSQLValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeName string
+		value    sql.RawBytes
+		want     string
+	}{
+		{"null", "VARCHAR", nil, "NULL"},
+		{"empty string", "VARCHAR", sql.RawBytes{}, "''"},
+		{"int", "INT", sql.RawBytes("-42"), "-42"},
+		{"unsigned", "UNSIGNED BIGINT", sql.RawBytes("18446744073709551615"), "18446744073709551615"},
+		{"decimal", "DECIMAL", sql.RawBytes("3.14"), "3.14"},
+		{"escaped text", "TEXT", sql.RawBytes("it's a\\b\n\x00\r\x1a"), `'it\'s a\\b\n\0\r\Z'`},
+		{"datetime", "DATETIME", sql.RawBytes("0000-00-00 00:00:00"), "'0000-00-00 00:00:00'"},
+		{"blob", "BLOB", sql.RawBytes{0x00, 0xff, 'a'}, "0x00ff61"},
+		{"empty blob", "VARBINARY", sql.RawBytes{}, "''"},
+		{"bit", "BIT", sql.RawBytes{0x05}, "0x05"},
+		{"json", "JSON", sql.RawBytes(`{"a": "b"}`), `'{"a": "b"}'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlValue(tt.typeName, tt.value); got != tt.want {
+				t.Errorf("sqlValue(%q, %q) = %s, want %s", tt.typeName, tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package mysqlModule
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"ccdc-cli/utils"
+)
+
+// globalPrivilegePatterns match grants that give an account control over the
+// whole server.
+var globalPrivilegePatterns = []struct {
+	re     *regexp.Regexp
+	reason string
+}{
+	{regexp.MustCompile(`(?i)^GRANT ALL PRIVILEGES ON \*\.\*`), "has ALL PRIVILEGES on every database"},
+	{regexp.MustCompile(`(?i)^GRANT .*\b(SUPER|FILE|PROCESS|SHUTDOWN|CREATE USER|SYSTEM_USER)\b.* ON \*\.\*`), "holds server administration privileges"},
+	{regexp.MustCompile(`(?i)WITH GRANT OPTION`), "can grant its privileges to others"},
+	{regexp.MustCompile("(?i)^GRANT .* ON `?mysql`?\\.\\*"), "has privileges on the mysql system schema"},
+}
+
+func isLocalHost(h string) bool {
+	return h == "localhost" || h == "127.0.0.1" || h == "::1"
+}
+
+// collectFindings turns the inventory into findings, most severe first.
+func (r *InventoryReport) collectFindings() []utils.Finding {
+	target := fmt.Sprintf("%s:%d", r.Host, r.Port)
+	var findings []utils.Finding
+
+	if r.AnonymousLogin {
+		findings = append(findings, utils.Finding{
+			ID:          "MYSQL-ANON-LOGIN",
+			Severity:    utils.SeverityCritical,
+			Target:      target,
+			Title:       "server accepts logins with an empty user and password",
+			Remediation: "run mysql harden to drop the anonymous accounts",
+		})
+	}
+
+	for _, u := range r.Users {
+		account := fmt.Sprintf("'%s'@'%s'", u.User, u.Host)
+		switch {
+		case slices.Contains(systemAccounts, u.User):
+		case u.User == "":
+			findings = append(findings, utils.Finding{
+				ID:          "MYSQL-ANON-USER",
+				Severity:    utils.SeverityHigh,
+				Target:      account,
+				Title:       "anonymous account exists",
+				Remediation: "DROP USER " + account,
+			})
+		case !u.PasswordSet && !slices.Contains(passwordlessPlugins, u.Plugin):
+			findings = append(findings, utils.Finding{
+				ID:          "MYSQL-USER-NOPASS",
+				Severity:    utils.SeverityHigh,
+				Target:      account,
+				Title:       "account has no password",
+				Evidence:    "plugin " + u.Plugin,
+				Remediation: "set a password with mysql rotate or drop the account",
+			})
+		}
+		if u.User == "root" && !isLocalHost(u.Host) {
+			findings = append(findings, utils.Finding{
+				ID:          "MYSQL-ROOT-REMOTE",
+				Severity:    utils.SeverityMedium,
+				Target:      account,
+				Title:       "root can log in from a remote host",
+				Remediation: "DROP USER " + account,
+			})
+		}
+	}
+
+	for _, g := range r.Grants {
+		if g.User == "root" || slices.Contains(systemAccounts, g.User) {
+			continue
+		}
+		account := fmt.Sprintf("'%s'@'%s'", g.User, g.Host)
+		for _, grant := range g.Grants {
+			for _, p := range globalPrivilegePatterns {
+				if p.re.MatchString(grant) {
+					findings = append(findings, utils.Finding{
+						ID:          "MYSQL-PRIV-EXCESSIVE",
+						Severity:    utils.SeverityHigh,
+						Target:      account,
+						Title:       "non-root account " + p.reason,
+						Evidence:    grant,
+						Remediation: "REVOKE the privilege from " + account + " unless the application needs it",
+					})
+					break
+				}
+			}
+		}
+	}
+
+	for _, d := range r.Databases {
+		if d.Name == "test" {
+			findings = append(findings, utils.Finding{
+				ID:          "MYSQL-TEST-DB",
+				Severity:    utils.SeverityLow,
+				Target:      target,
+				Title:       "test database exists",
+				Remediation: "run mysql harden to drop it",
+			})
+		}
+	}
+
+	for _, v := range r.SecurityVars {
+		if v.Passed {
+			continue
+		}
+		findings = append(findings, utils.Finding{
+			ID:          "MYSQL-VAR-" + strings.ToUpper(strings.NewReplacer(".", "-", "_", "-").Replace(v.Name)),
+			Severity:    v.Severity,
+			Target:      target,
+			Title:       fmt.Sprintf("%s should be %s", v.Name, v.Expected),
+			Evidence:    fmt.Sprintf("%s = %s", v.Name, v.Value),
+			Remediation: v.Remediation,
+		})
+	}
+
+	for _, o := range r.Persistence {
+		name := o.Name
+		if o.Schema != "" {
+			name = o.Schema + "." + o.Name
+		}
+		switch {
+		case len(o.Flags) > 0:
+			findings = append(findings, utils.Finding{
+				ID:          "MYSQL-PERSIST-" + strings.ToUpper(o.Type),
+				Severity:    utils.SeverityHigh,
+				Target:      name,
+				Title:       fmt.Sprintf("%s %s", strings.ToLower(o.Type), strings.Join(o.Flags, ", ")),
+				Evidence:    o.Body,
+				Remediation: "review the definition and drop it if it is not part of the application",
+			})
+		case o.Type == "UDF":
+			findings = append(findings, utils.Finding{
+				ID:          "MYSQL-PERSIST-UDF",
+				Severity:    utils.SeverityMedium,
+				Target:      name,
+				Title:       "user defined function loads native code",
+				Evidence:    o.Detail,
+				Remediation: "DROP FUNCTION " + quoteIdent(o.Name) + " if the library is unknown",
+			})
+		}
+	}
+
+	utils.SortFindings(findings)
+	return findings
+}
@@ -0,0 +1,228 @@
+package mysqlModule
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dryRun    bool
+	assumeYes bool
+	changeLog string
+)
+
+func getHardenCmd() *cobra.Command {
+	hardenCmd := &cobra.Command{
+		Use:   "harden",
+		Short: "Apply common MySQL hardening steps.",
+		Long: `Apply common MySQL hardening steps:
+- Drop anonymous users
+- Drop the test database
+- Disable local_infile
+- Restrict root to localhost
+- Remove users without a password
+
+Each step asks for confirmation unless --yes is given. Use --dry-run to only
+print the SQL that would be run.`,
+		RunE:         runHarden,
+		SilenceUsage: true,
+	}
+	hardenCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the SQL without running it")
+	hardenCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Apply every step without asking")
+	hardenCmd.Flags().StringVar(&changeLog, "log", "ccdc-changes.log", "File to record applied changes in")
+	return hardenCmd
+}
+
+func runHarden(cmd *cobra.Command, args []string) error {
+	password, err := utils.GetPassword()
+	if err != nil {
+		return fmt.Errorf("failed to read password")
+	}
+
+	db, err := connectToDatabase(username, password, host, port, dbName, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("MySQL connection failed: %v", err)
+	}
+
+	runner := &utils.ActionRunner{
+		DryRun:    dryRun,
+		AssumeYes: assumeYes,
+		Log:       utils.NewChangeLog(changeLog, fmt.Sprintf("mysql %s:%d", host, port)),
+		Exec: func(stmt string) error {
+			_, err := db.Exec(stmt)
+			return err
+		},
+	}
+
+	utils.PrintHeader("MYSQL HARDENING")
+	steps := []func(*sql.DB) (utils.Action, error){
+		dropAnonymousUsers,
+		dropTestDatabase,
+		disableLocalInfile,
+		restrictRootToLocalhost,
+		dropPasswordlessUsers,
+	}
+	for _, step := range steps {
+		action, err := step(db)
+		if err != nil {
+			fmt.Printf("\n[!] %v\n", err)
+			continue
+		}
+		if len(action.Statements) == 0 {
+			fmt.Printf("\n[-] %s: nothing to do\n", action.Description)
+			continue
+		}
+		runner.Run(action)
+	}
+
+	runner.PrintSummary()
+	return nil
+}
+
+// queryAccounts returns the 'user'@'host' of every row matched by query,
+// which must select User and Host.
+func queryAccounts(db *sql.DB, query string) ([][2]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts [][2]string
+	for rows.Next() {
+		var user, host string
+		if err := rows.Scan(&user, &host); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, [2]string{user, host})
+	}
+	return accounts, rows.Err()
+}
+
+func dropUsersAction(description string, accounts [][2]string) utils.Action {
+	action := utils.Action{Description: description}
+	for _, a := range accounts {
+		action.Statements = append(action.Statements, fmt.Sprintf("DROP USER %s;", quoteAccount(a[0], a[1])))
+	}
+	return action
+}
+
+func dropAnonymousUsers(db *sql.DB) (utils.Action, error) {
+	accounts, err := queryAccounts(db, "SELECT User, Host FROM mysql.user WHERE User = ''")
+	if err != nil {
+		return utils.Action{}, fmt.Errorf("could not list anonymous users: %v", err)
+	}
+	return dropUsersAction("Drop anonymous users", accounts), nil
+}
+
+func dropTestDatabase(db *sql.DB) (utils.Action, error) {
+	action := utils.Action{Description: "Drop the test database and its privileges"}
+
+	var exists int
+	err := db.QueryRow("SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = 'test'").Scan(&exists)
+	if err != nil {
+		return action, fmt.Errorf("could not check for the test database: %v", err)
+	}
+	if exists > 0 {
+		action.Statements = append(action.Statements, "DROP DATABASE `test`;")
+	}
+
+	var grants int
+	err = db.QueryRow(`SELECT COUNT(*) FROM mysql.db WHERE Db = 'test' OR Db = 'test\\_%'`).Scan(&grants)
+	if err == nil && grants > 0 {
+		action.Statements = append(action.Statements,
+			`DELETE FROM mysql.db WHERE Db = 'test' OR Db = 'test\\_%';`,
+			"FLUSH PRIVILEGES;")
+	}
+	return action, nil
+}
+
+func disableLocalInfile(db *sql.DB) (utils.Action, error) {
+	action := utils.Action{Description: "Disable local_infile (also set local-infile=0 in my.cnf to survive a restart)"}
+
+	var value string
+	if err := db.QueryRow("SELECT @@GLOBAL.local_infile").Scan(&value); err != nil {
+		return action, fmt.Errorf("could not read local_infile: %v", err)
+	}
+	if value != "0" && value != "OFF" {
+		action.Statements = append(action.Statements, "SET GLOBAL local_infile = 0;")
+	}
+	return action, nil
+}
+
+func restrictRootToLocalhost(db *sql.DB) (utils.Action, error) {
+	action := utils.Action{Description: "Restrict root to localhost"}
+	accounts, err := queryAccounts(db,
+		"SELECT User, Host FROM mysql.user WHERE User = 'root' AND Host NOT IN ('localhost', '127.0.0.1', '::1')")
+	if err != nil {
+		return action, fmt.Errorf("could not list root accounts: %v", err)
+	}
+	if len(accounts) == 0 {
+		return action, nil
+	}
+
+	// Dropping the remote root accounts must not leave the server without a
+	// root account, or drop the one this session is using
+	var local int
+	err = db.QueryRow("SELECT COUNT(*) FROM mysql.user WHERE User = 'root' AND Host IN ('localhost', '127.0.0.1')").Scan(&local)
+	if err != nil {
+		return action, fmt.Errorf("could not check for a local root account: %v", err)
+	}
+	if local == 0 {
+		return action, fmt.Errorf("refusing to restrict root to localhost: there is no root@localhost or root@127.0.0.1 to keep")
+	}
+	var current string
+	if err := db.QueryRow("SELECT CURRENT_USER()").Scan(&current); err != nil {
+		return action, fmt.Errorf("could not read the current account: %v", err)
+	}
+
+	var remote [][2]string
+	for _, a := range accounts {
+		if a[0]+"@"+a[1] == current {
+			fmt.Printf("\n[!] Keeping %s, this session is connected as it\n", quoteAccount(a[0], a[1]))
+			continue
+		}
+		remote = append(remote, a)
+	}
+	return dropUsersAction(action.Description, remote), nil
+}
+
+func dropPasswordlessUsers(db *sql.DB) (utils.Action, error) {
+	// Socket authenticated accounts legitimately have no password and MySQL 8
+	// roles are stored as locked accounts without one
+	query := `
+		SELECT User, Host FROM mysql.user
+		WHERE authentication_string = '' AND User <> ''
+		AND plugin NOT IN ('unix_socket', 'auth_socket')`
+
+	// MariaDB roles have no password or plugin either. Only MariaDB has
+	// is_role and only MySQL 5.7+ and MariaDB 10.4+ have account_locked, so
+	// the filters are tried until one the server knows
+	var accounts [][2]string
+	var err error
+	for _, filter := range []string{
+		" AND is_role <> 'Y' AND account_locked <> 'Y'",
+		" AND is_role <> 'Y'",
+		" AND account_locked <> 'Y'",
+		"",
+	} {
+		if accounts, err = queryAccounts(db, query+filter); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return utils.Action{}, fmt.Errorf("could not list passwordless users: %v", err)
+	}
+	accounts = slices.DeleteFunc(accounts, func(a [2]string) bool { return slices.Contains(systemAccounts, a[0]) })
+	return dropUsersAction("Remove users without a password", accounts), nil
+}
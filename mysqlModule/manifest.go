@@ -0,0 +1,63 @@
+package mysqlModule
+
+import (
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func getVerifyCmd() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check a backup against its manifest.",
+		Long: `Every backup is written with a <file>.manifest.json holding its SHA-256,
+size, source server and databases. verify recomputes the checksum and fails if
+the file was modified after the backup was taken.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return utils.RunVerify(file)
+		},
+		SilenceUsage: true,
+	}
+	verifyCmd.Flags().StringVarP(&file, "file", "f", "", "Backup file to verify")
+	verifyCmd.MarkFlagRequired("file")
+	return verifyCmd
+}
+
+// backupManifest describes the server a backup is taken from, and the
+// database when only db was backed up.
+func backupManifest(password, db string) (*utils.Manifest, error) {
+	m := &utils.Manifest{
+		Engine:      "mysql",
+		Host:        host,
+		Port:        port,
+		Compression: compress,
+		Encrypted:   encrypt || recipient != "",
+	}
+	if db != "" {
+		m.Database = db
+		m.Databases = []string{db}
+	}
+
+	conn, err := connectToDatabase(username, password, host, port, dbName, false)
+	if err != nil {
+		return m, err
+	}
+	defer conn.Close()
+
+	if err := conn.QueryRow("SELECT VERSION()").Scan(&m.ServerVersion); err != nil || db != "" {
+		return m, err
+	}
+	rows, err := conn.Query("SHOW DATABASES")
+	if err != nil {
+		return m, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return m, err
+		}
+		m.Databases = append(m.Databases, name)
+	}
+	return m, rows.Err()
+}
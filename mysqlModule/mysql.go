@@ -1,18 +1,22 @@
 package mysqlModule
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"ccdc-cli/utils"
 
-	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +29,25 @@ var (
 	backup         bool
 	restore        bool
 	file           string
+	output         string
+	saveBaseline   string
+	diffBaseline   string
+	failOn         string
+	native         bool
+	compress       string
+	encrypt        bool
+	recipient      string
+	identity       string
+	force          bool
+	preview        bool
+	noSnapshot     bool
+	snapshotDir    string
+	databases      []string
+	tables         []string
+	exclude        []string
+	selector       *utils.Selector
+	backupDir      string
+	retention      utils.RetentionPolicy
 	dbName         string = ""
 	cachedPassword string = ""
 	askedPass      bool   = false
@@ -40,28 +63,91 @@ This Module Contains the Following Functionality:
 - Backup a Database
 - Restore a Database
 - Inventory a Database
+- Harden a Server (mysql harden)
+- Rotate Account Passwords (mysql rotate)
+- Monitor and Kill Sessions (mysql watch)
+- Take Scheduled Backups (mysql backup)
+- Verify a Backup Against its Manifest (mysql verify)
+- Audit Configuration Files (mysql config-audit)
 
 This Command must be run with any of the following flags: -irb`,
 		RunE:         runCmd,
 		SilenceUsage: true,
 	}
-	mysqlCmd.Flags().IntVarP(&port, "port", "p", 3306, "Port to Connect to")
-	mysqlCmd.Flags().StringVarP(&host, "host", "H", "127.0.0.1", "Host to Connect to")
-	mysqlCmd.Flags().StringVarP(&username, "username", "u", "root", "User to Connect as")
+	mysqlCmd.PersistentFlags().IntVarP(&port, "port", "p", 3306, "Port to Connect to")
+	mysqlCmd.PersistentFlags().StringVarP(&host, "host", "H", "127.0.0.1", "Host to Connect to")
+	mysqlCmd.PersistentFlags().StringVarP(&username, "username", "u", "root", "User to Connect as")
 	mysqlCmd.Flags().BoolVarP(&inventory, "inventory", "i", false, "Should run Inventory Check")
 	mysqlCmd.Flags().BoolVarP(&backup, "backup", "b", false, "Should Backup")
 	mysqlCmd.Flags().BoolVarP(&restore, "restore", "r", false, "Should Restore")
-	mysqlCmd.Flags().StringVarP(&file, "file", "f", "", "File to Use for Backup/Restore")
+	mysqlCmd.Flags().StringVarP(&file, "file", "f", "", "File to Use for Backup/Restore, a directory when selecting databases or tables")
+	addBackupFlags(mysqlCmd)
+	mysqlCmd.Flags().StringVar(&identity, "identity", "", "Private key file to decrypt a backup encrypted with --recipient")
+	mysqlCmd.Flags().BoolVar(&force, "force", false, "Restore even if the backup has no manifest or does not match it")
+	mysqlCmd.Flags().BoolVar(&noSnapshot, "no-snapshot", false, "Restore without first taking a safety snapshot of the databases and accounts it overwrites")
+	mysqlCmd.Flags().StringVar(&snapshotDir, "snapshot-dir", "", "Directory for the safety snapshot (default: the directory of -f)")
+	mysqlCmd.Flags().BoolVar(&preview, "preview", false, "With -r, list what the restore would do and what it would overwrite, without restoring")
+	mysqlCmd.Flags().StringVarP(&output, "output", "o", utils.OutputText, "Inventory output format: text, json or yaml")
+	mysqlCmd.Flags().StringVar(&saveBaseline, "save-baseline", "", "Save the inventory to this file as a baseline")
+	mysqlCmd.Flags().StringVar(&diffBaseline, "diff", "", "Compare the inventory against a saved baseline")
+	mysqlCmd.Flags().StringVar(&failOn, "fail-on", "", "Exit with code 2 if any finding is at least this severe: low, medium or high")
 	// mysqlCmd.Flags().StringVarP(&dbName, "dbName", "n", "", "Database name to Connect to")
 
 	mysqlCmd.MarkFlagsMutuallyExclusive("backup", "restore")
+	mysqlCmd.MarkFlagsMutuallyExclusive("file", "backup-dir")
+
+	mysqlCmd.AddCommand(getHardenCmd())
+	mysqlCmd.AddCommand(getBackupCmd())
+	mysqlCmd.AddCommand(getVerifyCmd())
+	mysqlCmd.AddCommand(getRotateCmd())
+	mysqlCmd.AddCommand(getWatchCmd())
+	mysqlCmd.AddCommand(getConfigAuditCmd())
 	return mysqlCmd
 }
 
+// addBackupFlags registers the flags -b shares with the backup subcommand.
+func addBackupFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "Write timestamped backups into this directory instead of -f")
+	cmd.Flags().IntVar(&retention.Keep, "keep", 0, "With --backup-dir, keep only the newest N backups of this server")
+	cmd.Flags().DurationVar(&retention.KeepWithin, "keep-within", 0, "With --backup-dir, keep only backups of this server younger than this, e.g. 6h")
+	cmd.Flags().StringSliceVar(&databases, "databases", nil, "Only backup/restore these databases")
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "Only backup/restore these tables, as database.table")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Skip these databases or database.table tables")
+	cmd.Flags().StringVar(&compress, "compress", "", "Compress the backup as it is written: gzip or zstd")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the backup with a passphrase, or for --recipient")
+	cmd.Flags().StringVar(&recipient, "recipient", "", "Encrypt the backup for this public key (ccdc-pub-... or a file holding it)")
+	cmd.Flags().BoolVar(&native, "native", false, "Backup with the built in dump engine instead of mysqldump")
+}
+
+// parseBackupFlags validates the backup flags and parses the selector.
+func parseBackupFlags() error {
+	if err := utils.ValidateCompression(compress); err != nil {
+		return err
+	}
+	sel, err := utils.ParseSelector(utils.DialectMySQL, databases, tables, exclude)
+	if err != nil {
+		return err
+	}
+	selector = sel
+	return nil
+}
+
 func runCmd(cmd *cobra.Command, args []string) error {
+	if err := utils.ValidateOutputFormat(output); err != nil {
+		return err
+	}
+	if _, _, err := utils.ParseFailOn(failOn); err != nil {
+		return err
+	}
+	if err := parseBackupFlags(); err != nil {
+		return err
+	}
+
 	didGetFlag := false
 	if cmd.Flags().Changed("inventory") {
-		runInventory()
+		if err := runInventory(); err != nil {
+			return err
+		}
 		didGetFlag = true
 	}
 
@@ -79,65 +165,73 @@ func runCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runInventory() {
+func runInventory() error {
 	password, err := utils.GetPassword()
 	if err != nil {
-		fmt.Println("failed to read password")
-		return
+		return fmt.Errorf("failed to read password")
 	}
 
-	if anonymousLoginCheck() != nil {
-		return
+	report := &InventoryReport{Host: host, Port: port}
+
+	anonymous, err := anonymousLoginCheck()
+	if err != nil {
+		return err
 	}
+	report.AnonymousLogin = anonymous
 
 	db, err := connectToDatabase(username, password, host, port, dbName, false)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	defer db.Close()
 
-	if db.Ping() != nil {
-		fmt.Printf("Error: SQL Authentication failed for %s@%s.\n", username, host)
-		return
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("SQL authentication failed for %s@%s: %w", username, host, err)
 	}
-	userAccountsAndAuth(db)
-	userRoleMappings(db)
-	userPrivileges(db)
-	databaseTableInventory(db)
-	securityVars(db)
-}
+	userAccountsAndAuth(db, report)
+	userRoleMappings(db, report)
+	userPrivileges(db, report)
+	databaseTableInventory(db, report)
+	securityVars(db, report)
+	persistenceInventory(db, report)
+	report.Findings = report.collectFindings()
 
-func anonymousLoginCheck() error {
-	db, err := connectToDatabase("", "", host, port, dbName, true)
-	if err != nil {
-		fmt.Println(err)
+	if saveBaseline != "" {
+		if err := utils.SaveSnapshot(saveBaseline, report); err != nil {
+			return fmt.Errorf("failed to save baseline: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Baseline saved to %s\n", saveBaseline)
+	}
+	if diffBaseline != "" {
+		if err := compareWithBaseline(diffBaseline, report); err != nil {
+			return err
+		}
+		return utils.CheckFailOn(report.Findings, failOn)
+	}
+
+	if output == utils.OutputText {
+		printReportText(report)
+	} else if err := utils.WriteStructured(os.Stdout, output, report); err != nil {
 		return err
 	}
-	defer db.Close()
-	utils.PrintHeader("ANONYMOUS LOGIN TEST")
-	err = db.Ping()
+	return utils.CheckFailOn(report.Findings, failOn)
+}
 
+// anonymousLoginCheck reports whether the server accepts a login with an
+// empty user name and password.
+func anonymousLoginCheck() (bool, error) {
+	db, err := connectToDatabase("", "", host, port, dbName, output == utils.OutputText)
 	if err != nil {
-		// fmt.Println(err)
-
-		var mysqlErr *mysql.MySQLError
-		if errors.As(err, &mysqlErr) {
-			if mysqlErr.Number == 1045 {
-				fmt.Println("Anonymous login disabled")
-				return nil
-			}
-		}
-		fmt.Printf("Server at %s allows ANONYMOUS login.\n", host)
-	} else {
-		fmt.Println("Anonymous login disabled")
+		return false, err
 	}
-	return nil
+	defer db.Close()
+
+	// Any failure here (normally error 1045, access denied) means the
+	// anonymous login was refused
+	return db.Ping() == nil, nil
 }
 
-func userAccountsAndAuth(db *sql.DB) {
-	utils.PrintHeader("USER ACCOUNTS & AUTHENITCATION PLUGINS")
-	fmt.Printf("  %-25s | %-15s | %-15s\n", "User@Host", "Plugin", "Password Set")
+func userAccountsAndAuth(db *sql.DB, report *InventoryReport) {
 	query := `
 		SELECT User, Host, plugin, 
 		IF(authentication_string='' OR Password='', 'NO', 'YES') 
@@ -145,7 +239,7 @@ func userAccountsAndAuth(db *sql.DB) {
 
 	rows, err := db.Query(query)
 	if err != nil {
-		fmt.Println("Query Failed.")
+		report.setError(sectionUsers, "Query Failed.")
 		return
 	}
 	defer rows.Close()
@@ -153,86 +247,83 @@ func userAccountsAndAuth(db *sql.DB) {
 	for rows.Next() {
 		var user, host, plugin, passSet string
 		if err := rows.Scan(&user, &host, &plugin, &passSet); err != nil {
-			fmt.Println("Error Reading Rows")
+			report.setError(sectionUsers, "Error Reading Rows")
 			return
 		}
 
-		userHost := fmt.Sprintf("%s@%s", user, host)
-		fmt.Printf("  %-25s | %-15s | %-15s\n", userHost, plugin, passSet)
+		report.Users = append(report.Users, UserAccount{
+			User:        user,
+			Host:        host,
+			Plugin:      plugin,
+			PasswordSet: passSet == "YES",
+		})
 	}
 
 	if err = rows.Err(); err != nil {
-		fmt.Println("Error During Row Interation.")
+		report.setError(sectionUsers, "Error During Row Interation.")
 	}
 }
 
-func userRoleMappings(db *sql.DB) {
-	utils.PrintHeader("ROLE MAPPINGS")
-
+func userRoleMappings(db *sql.DB, report *InventoryReport) {
+	// mysql.roles_mapping only exists on MariaDB, a failed query just means
+	// there are no mappings to report
 	query := `SELECT User, Host, Role FROM mysql.roles_mapping;`
 	rows, err := db.Query(query)
 	if err != nil {
-		fmt.Println("No Specific Role Mappings")
 		return
 	}
 	defer rows.Close()
 
-	found := false
-
 	for rows.Next() {
-		found = true
 		var user, host, role string
 		if err := rows.Scan(&user, &host, &role); err != nil {
-			fmt.Printf("  Error Scanning Row: %s\n", err)
+			continue
 		}
 
-		fmt.Printf("  - User '%s'@'%s' has role: %s\n", user, host, role)
-	}
-
-	if !found {
-		fmt.Println("No Specific Roles Mapped")
+		report.RoleMappings = append(report.RoleMappings, RoleMapping{User: user, Host: host, Role: role})
 	}
 }
 
-func userPrivileges(db *sql.DB) {
-	utils.PrintHeader("Detailed User Privileges (GRANTS)")
-
+func userPrivileges(db *sql.DB, report *InventoryReport) {
 	query := "SELECT User, Host FROM mysql.user"
 	userRows, err := db.Query(query)
 	if err != nil {
-		fmt.Println("Error reading users from db")
+		report.setError(sectionGrants, "Error reading users from db")
 		return
 	}
 	defer userRows.Close()
+
+	var accounts []UserGrants
 	for userRows.Next() {
 		var user, host string
 		if err := userRows.Scan(&user, &host); err != nil {
 			continue
 		}
-		fmt.Printf("  GRANT for '%s'@'%s':\n", user, host)
-		query = fmt.Sprintf("SHOW GRANTS FOR '%s'@'%s'", user, host)
+		accounts = append(accounts, UserGrants{User: user, Host: host})
+	}
+	userRows.Close()
+
+	for i := range accounts {
+		account := &accounts[i]
+		query = fmt.Sprintf("SHOW GRANTS FOR '%s'@'%s'", account.User, account.Host)
 		grantRows, err := db.Query(query)
 		if err != nil {
-			fmt.Println("    |-- [!] Could not retrieve")
-			fmt.Println()
+			account.Error = err.Error()
 			continue
 		}
-		defer grantRows.Close()
 		for grantRows.Next() {
 			var grant string
 			if err := grantRows.Scan(&grant); err != nil {
 				continue
 			}
-			fmt.Printf("    |-- %s\n", grant)
+			account.Grants = append(account.Grants, grant)
 		}
 		grantRows.Close()
-		fmt.Println()
 	}
+	report.Grants = accounts
 }
 
-func databaseTableInventory(db *sql.DB) {
-	utils.PrintHeader("Database and Table Inventory")
-
+func databaseTableInventory(db *sql.DB, report *InventoryReport) {
 	query := `
 									SELECT schema_name
 									FROM information_schema.schemata
@@ -240,26 +331,31 @@ func databaseTableInventory(db *sql.DB) {
 
 	dbRows, err := db.Query(query)
 	if err != nil {
-		fmt.Printf("Error fetching databases: %v\n", err)
+		report.setError(sectionDatabases, fmt.Sprintf("Error fetching databases: %v", err))
+		return
 	}
 	defer dbRows.Close()
 
+	var names []string
 	for dbRows.Next() {
 		var dbName string
 		if err := dbRows.Scan(&dbName); err != nil {
 			continue
 		}
+		names = append(names, dbName)
+	}
+	dbRows.Close()
+
+	for _, dbName := range names {
+		database := Database{Name: dbName}
 
 		var dbSize sql.NullFloat64
 		sizeQuery := fmt.Sprintf(`
 			SELECT ROUND (SUM(data_length + index_length) / 1024 / 1024, 2)
 			FROM information_schema.tables
 			WHERE table_schema='%s'`, dbName)
-		err = db.QueryRow(sizeQuery).Scan(&dbSize)
-		if err != nil {
-			fmt.Printf("  DATABASE: %s (Size: 0 MB)\n", dbName)
-		} else {
-			fmt.Printf("  DATABASE: %s (Size: %.2f MB)\n", dbName, dbSize.Float64)
+		if err := db.QueryRow(sizeQuery).Scan(&dbSize); err == nil {
+			database.SizeMB = dbSize.Float64
 		}
 
 		tableQuery := fmt.Sprintf(`
@@ -272,45 +368,30 @@ func databaseTableInventory(db *sql.DB) {
 
 		tRows, err := db.Query(tableQuery)
 		if err != nil {
-			fmt.Printf("    |-- [1] Could not retrieve tables for %s\n", dbName)
+			database.Error = err.Error()
+			report.Databases = append(report.Databases, database)
 			continue
 		}
-		defer tRows.Close()
 
 		for tRows.Next() {
-			var tName, tEng, tRowsCount, tDate string
-			if err := tRows.Scan(&tName, &tEng, &tRowsCount, &tDate); err != nil {
+			var t Table
+			if err := tRows.Scan(&t.Name, &t.Engine, &t.Rows, &t.Created); err != nil {
 				continue
 			}
-
-			fmt.Printf("    |-- %-25s | %-10s | Rows: %-8s | Created: %s\n", tName, tEng, tRowsCount, tDate)
-
+			database.Tables = append(database.Tables, t)
 		}
 		tRows.Close()
-		fmt.Println()
+		report.Databases = append(report.Databases, database)
 	}
 }
 
-func securityVars(db *sql.DB) {
-	utils.PrintHeader("CRITICAL SECURITY VARIABLES")
-
-	query := `SHOW VARIABLES WHERE Variable_name IN ('local_infile', 'skip_networking', 'have_ssl', 'version')`
-	rows, err := db.Query(query)
+func securityVars(db *sql.DB, report *InventoryReport) {
+	vars, err := showVariables(db)
 	if err != nil {
-		fmt.Printf("Error retrieving security variables", err)
+		report.setError(sectionSecurityVars, fmt.Sprintf("Error retrieving security variables: %v", err))
 		return
 	}
-	defer rows.Close()
-
-	fmt.Printf("  %-25s | %-10s\n", "Variable Name", "Values")
-
-	for rows.Next() {
-		var varName, varValue string
-		if err := rows.Scan(&varName, &varValue); err != nil {
-			continue
-		}
-		fmt.Printf("  %-25s | %-10s\n", varName, varValue)
-	}
+	report.SecurityVars = evaluateSecurityChecks(vars)
 }
 
 // ===========================================================
@@ -319,49 +400,240 @@ func securityVars(db *sql.DB) {
 //
 // ===========================================================
 func runBackup() {
-	if len(file) == 0 {
-		fmt.Println("This command requires -f to be specified")
-		return
-	} else if !utils.CheckCliCmdExist("mysqldump") {
-		fmt.Println("This command requires mysqldump to be in path")
+	job, err := prepareBackup()
+	if err != nil {
+		fmt.Printf("Backup Failed: %s\n", err)
 		return
 	}
+	if err := job.run(context.Background()); err != nil {
+		fmt.Printf("Backup Failed: %s\n", err)
+	}
+}
+
+// backupJob is a backup with its flags checked and its secrets read, so a
+// scheduled backup can run it again without prompting.
+type backupJob struct {
+	password  string
+	useNative bool
+	opts      utils.BackupOptions
+}
+
+// prepareBackup checks the backup flags and reads the password and the
+// backup passphrase.
+func prepareBackup() (*backupJob, error) {
+	if len(file) == 0 && backupDir == "" {
+		return nil, errors.New("this command requires -f or --backup-dir to be specified")
+	}
+	useNative := native
+	if !useNative && !utils.CheckCliCmdExist("mysqldump") {
+		fmt.Println("mysqldump not found in path, using the native dump engine")
+		useNative = true
+	}
 	password, err := utils.GetPassword()
 	if err != nil {
-		fmt.Printf("failed to read password")
-		return
+		return nil, errors.New("failed to read password")
 	}
 
-	ofile, err := os.Create(file)
+	encryption, err := utils.EncryptionFromFlags(encrypt, recipient)
 	if err != nil {
-		fmt.Printf("%s", err)
+		return nil, err
+	}
+	return &backupJob{password: password, useNative: useNative, opts: utils.BackupOptions{Compression: compress, Encrypt: encryption}}, nil
+}
+
+// run takes one backup and prunes --backup-dir once it succeeded.
+func (j *backupJob) run(ctx context.Context) error {
+	target := file
+	if backupDir != "" {
+		if err := os.MkdirAll(backupDir, 0700); err != nil {
+			return err
+		}
+		target = filepath.Join(backupDir, utils.BackupBaseName(host, port, "mysql", time.Now()))
+		if !selector.Active() {
+			target += utils.BackupExtension(j.opts)
+		}
+	}
+
+	if !selector.Active() {
+		if j.useNative {
+			fmt.Printf("Starting Full Mysql backup from %s:%d (native)...\n", host, port)
+		} else {
+			fmt.Printf("Starting Full Mysql backup from %s:%d...\n", host, port)
+		}
+		if err := j.backupTo(ctx, target, ""); err != nil {
+			return err
+		}
+	} else {
+		dbs, err := selectedDatabases(j.password)
+		if err != nil {
+			return err
+		}
+		if len(dbs) == 0 {
+			return errors.New("no databases match the selection")
+		}
+		if err := j.backupDatabases(ctx, target, dbs); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Backup completed successfully")
+	applyRetention()
+	return nil
+}
+
+// backupDatabases writes one file per database in dbs into dir.
+func (j *backupJob) backupDatabases(ctx context.Context, dir string, dbs []string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, db := range dbs {
+		path := filepath.Join(dir, db+utils.BackupExtension(j.opts))
+		fmt.Printf("Backing up %s from %s:%d to %s...\n", db, host, port, path)
+		if err := j.backupTo(ctx, path, db); err != nil {
+			if backupDir != "" {
+				// a partial snapshot would be listed and kept like a good one
+				os.RemoveAll(dir)
+			}
+			return fmt.Errorf("%s: %w", db, err)
+		}
+	}
+	return nil
+}
+
+// applyRetention prunes --backup-dir after a successful backup.
+func applyRetention() {
+	if backupDir == "" {
 		return
 	}
-	defer ofile.Close()
+	removed, err := utils.PruneBackups(backupDir, host, port, "mysql", retention, time.Now())
+	for _, b := range removed {
+		fmt.Printf("Pruned old backup %s\n", b.Path)
+	}
+	if err != nil {
+		fmt.Printf("[WARN] pruning %s failed: %v\n", backupDir, err)
+	}
+}
+
+// selectedDatabases returns the databases a selective backup covers.
+func selectedDatabases(password string) ([]string, error) {
+	candidates := selector.SelectedDatabases()
+	if len(candidates) == 0 {
+		var err error
+		if candidates, err = serverDatabases(password); err != nil {
+			return nil, err
+		}
+	}
+
+	var dbs []string
+	for _, db := range candidates {
+		if selector.IncludesDatabase(db) {
+			dbs = append(dbs, db)
+		}
+	}
+	return dbs, nil
+}
+
+// serverDatabases lists the databases on the server, without the system
+// schemas.
+func serverDatabases(password string) ([]string, error) {
+	db, err := connectToDatabase(username, password, host, port, dbName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SHOW DATABASES")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(skippedSchemas, strings.ToLower(name)) {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+// backupTo writes a backup of the whole server, or of database db when it is
+// set, to path and writes its manifest. The backup is written next to path
+// and only replaces it once complete, a failed backup is removed.
+func (j *backupJob) backupTo(ctx context.Context, path, db string) error {
+	tmp := utils.TempBackupPath(path)
+	out, err := utils.CreateBackup(tmp, j.opts)
+	if err != nil {
+		return err
+	}
+
+	var sel *utils.Selector
+	if db != "" {
+		sel = selector.ForDatabase(db)
+	}
+	if j.useNative {
+		err = nativeBackup(ctx, j.password, out, sel)
+	} else {
+		err = mysqldump(ctx, j.password, out, db, sel)
+	}
+	// closing flushes the compressor, a failure there truncates the backup
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = utils.CommitBackup(path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
 
-	cmd := exec.Command("mysqldump",
+	manifest, err := backupManifest(j.password, db)
+	if err != nil {
+		fmt.Printf("[WARN] could not read server details for the manifest: %v\n", err)
+	}
+	if err := utils.WriteManifest(path, manifest); err != nil {
+		fmt.Printf("[WARN] failed to write the backup manifest, restoring this backup will need --force: %v\n", err)
+		return nil
+	}
+	fmt.Printf("Wrote manifest %s\n", utils.ManifestPath(path))
+	return nil
+}
+
+// mysqldump runs the mysqldump binary into w. Without a selector every
+// database is dumped.
+func mysqldump(ctx context.Context, password string, w io.Writer, db string, sel *utils.Selector) error {
+	args := []string{
 		"-u", username,
-		"-p"+password,
 		"-h", host,
 		"-P", strconv.Itoa(port),
-		"--all-databases",
 		"--events",
 		"--routines",
 		"--single-transaction",
-	)
-
-	cmd.Stdout = ofile
-	cmd.Stderr = os.Stderr
-
-	fmt.Printf("Starting Full Mysql backup from %s:%d...\n", host, port)
-
-	err = cmd.Run()
-	if err != nil {
-		fmt.Printf("Backup Failed: %s\n", err)
-		return
+	}
+	switch {
+	case sel == nil:
+		args = append(args, "--all-databases")
+	case len(sel.Tables) > 0:
+		// a table list dumps no CREATE DATABASE or USE, so add them
+		fmt.Fprintf(w, "CREATE DATABASE IF NOT EXISTS %s;\nUSE %s;\n\n", quoteIdent(db), quoteIdent(db))
+		args = append(args, db)
+		for _, t := range sel.Tables {
+			args = append(args, t.Name)
+		}
+	default:
+		for _, t := range sel.ExcludeTables {
+			args = append(args, "--ignore-table="+db+"."+t.Name)
+		}
+		args = append(args, "--databases", db)
 	}
 
-	fmt.Println("Backup completed successfully")
+	cmd := exec.CommandContext(ctx, "mysqldump", args...)
+	cmd.Env = passwordEnv(password)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
 
 // ===========================================================
@@ -374,7 +646,7 @@ func runRestore() {
 	if len(file) == 0 {
 		fmt.Println("This command requires -f to be specified")
 		return
-	} else if !utils.CheckCliCmdExist("mysql") {
+	} else if !preview && !utils.CheckCliCmdExist("mysql") {
 		fmt.Println("This command requires mysql to be in path")
 		return
 	}
@@ -383,32 +655,105 @@ func runRestore() {
 		fmt.Printf("failed to read password")
 		return
 	}
-	ifile, err := os.Open(file)
+	keys, err := utils.DecryptKeysFromFlags(identity)
+	if err != nil {
+		fmt.Printf("Could not load identity: %v\n", err)
+		return
+	}
+	targets, err := utils.RestoreTargets(file, selector)
 	if err != nil {
-		fmt.Println("Could not open specified file")
+		fmt.Printf("Could not open specified file: %v\n", err)
+		return
+	}
+	if len(targets) == 0 {
+		fmt.Println("No backups match the selection")
 		return
 	}
+
+	if preview {
+		existing := func(*utils.RestorePlan) (map[string]bool, error) { return existingObjects(password) }
+		for _, t := range targets {
+			if err := utils.PreviewRestore(t, "mysql", selector, keys, existing); err != nil {
+				fmt.Printf("Preview Failed: %s\n", err)
+				return
+			}
+		}
+		return
+	}
+
+	snapshot := ""
+	if !noSnapshot {
+		if snapshot, err = safetySnapshot(password, restoresAccounts(targets)); err != nil {
+			fmt.Printf("Restore aborted, the safety snapshot failed: %s\n", err)
+			fmt.Println("Use --no-snapshot to restore without one")
+			return
+		}
+	}
+
+	for _, t := range targets {
+		if err := restoreFrom(t, password, keys); err != nil {
+			fmt.Printf("Restore Failed: %s\n", err)
+			offerRollback(snapshot, password)
+			return
+		}
+	}
+
+	fmt.Println("Restoration completed successfully")
+}
+
+// restoresAccounts reports whether restoring targets can replace the
+// accounts and password hashes on the server. Full dumps carry them in the
+// mysql schema and as CREATE USER statements, a selective restore only
+// keeps the mysql schema.
+func restoresAccounts(targets []utils.RestoreTarget) bool {
+	for _, t := range targets {
+		if t.Database == "" && selector.IncludesDatabase("mysql") {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreFrom loads one backup file into the server, keeping only the
+// selected databases and tables.
+func restoreFrom(t utils.RestoreTarget, password string, keys utils.DecryptKeys) error {
+	if err := utils.CheckBeforeRestore(t.Path, "mysql", force); err != nil {
+		return err
+	}
+	ifile, err := utils.OpenBackup(t.Path, keys)
+	if err != nil {
+		return fmt.Errorf("could not open specified file: %w", err)
+	}
 	defer ifile.Close()
 
+	var input io.Reader = ifile
+	if selector.Active() {
+		input = utils.NewFilterReader(ifile, selector, t.Database)
+	}
+
+	fmt.Printf("Restoring backup from %s...\n", t.Path)
+	return loadDump(input, password)
+}
+
+// loadDump pipes a dump into the mysql client.
+func loadDump(input io.Reader, password string) error {
 	cmd := exec.Command("mysql",
 		"-u", username,
-		"-p"+password,
 		"-h", host,
 		"-P", strconv.Itoa(port),
 	)
 
-	cmd.Stdin = ifile
+	cmd.Env = passwordEnv(password)
+	cmd.Stdin = input
 	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
 
-	fmt.Printf("Restoring backup from %s...\n", file)
-	err = cmd.Run()
-	if err != nil {
-		fmt.Printf("Restore Failed: %s", err)
-		os.Remove(file)
-		return
-	}
-
-	fmt.Println("Restoration completed successfully")
+// passwordEnv returns the environment for a mysql client binary with the
+// password in MYSQL_PWD, which other users can't read the way they can read
+// a -p argument with ps.
+func passwordEnv(password string) []string {
+	return append(os.Environ(), "MYSQL_PWD="+password)
 }
 
 func runDefault() error {
@@ -433,7 +778,7 @@ func runDefault() error {
 }
 
 func connectToDatabase(user string, password string, host string, port int, dbName string, shouldPrintConnecting bool) (*sql.DB, error) {
-	dns := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", username, password, host, port, dbName)
+	dns := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", user, password, host, port, dbName)
 	db, err := sql.Open("mysql", dns)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database")
@@ -0,0 +1,235 @@
+package mysqlModule
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"ccdc-cli/utils"
+)
+
+// PersistenceObject is a trigger, event, routine or UDF that runs code on the
+// server and can be used to keep access.
+type PersistenceObject struct {
+	Type    string   `json:"type" yaml:"type"`
+	Schema  string   `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Name    string   `json:"name" yaml:"name"`
+	Definer string   `json:"definer,omitempty" yaml:"definer,omitempty"`
+	Detail  string   `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Body    string   `json:"body" yaml:"body"`
+	Flags   []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+}
+
+type suspiciousPattern struct {
+	re     *regexp.Regexp
+	reason string
+}
+
+var suspiciousPatterns = []suspiciousPattern{
+	{regexp.MustCompile(`(?i)\b(sys_exec|sys_eval|sys_get|sys_set|lib_mysqludf_\w+)\b|\bsystem\s*\(`), "shells out"},
+	{regexp.MustCompile(`(?i)\binto\s+(outfile|dumpfile)\b`), "writes files with INTO OUTFILE/DUMPFILE"},
+	{regexp.MustCompile(`(?i)\bload_file\s*\(`), "reads files with LOAD_FILE"},
+	{regexp.MustCompile(`(?i)\bgrant\b`), "issues grants"},
+	{regexp.MustCompile("(?i)\\b(create|alter|rename)\\s+user\\b|\\bset\\s+password\\b|\\b(insert|update|replace)\\s+(into\\s+)?`?mysql`?\\.`?(user|global_priv)\\b"), "creates or modifies users"},
+	{regexp.MustCompile(`(?i)\bprepare\b[\s\S]*\bexecute\b`), dynamicSQL},
+}
+
+const dynamicSQL = "runs dynamic SQL"
+
+func flagBody(body string) []string {
+	var flags []string
+	for _, p := range suspiciousPatterns {
+		if p.re.MatchString(body) {
+			flags = append(flags, p.reason)
+		}
+	}
+	return flags
+}
+
+// flagRoutine flags the body of a stored routine. Stock sys routines such as
+// execute_prepared_stmt and table_exists run dynamic SQL themselves, so that
+// pattern is not applied inside sys.
+func flagRoutine(schema, body string) []string {
+	flags := flagBody(body)
+	if schema == "sys" {
+		flags = slices.DeleteFunc(flags, func(f string) bool { return f == dynamicSQL })
+	}
+	return flags
+}
+
+func persistenceInventory(db *sql.DB, report *InventoryReport) {
+	var errs []string
+	for _, collect := range []func(*sql.DB) ([]PersistenceObject, error){
+		collectTriggers, collectEvents, collectRoutines, collectUDFs,
+	} {
+		objects, err := collect(db)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		report.Persistence = append(report.Persistence, objects...)
+	}
+	if len(errs) > 0 {
+		report.setError(sectionPersistence, strings.Join(errs, "; "))
+	}
+}
+
+func collectTriggers(db *sql.DB) ([]PersistenceObject, error) {
+	query := `
+		SELECT TRIGGER_SCHEMA, TRIGGER_NAME, ACTION_TIMING, EVENT_MANIPULATION,
+		EVENT_OBJECT_TABLE, DEFINER, ACTION_STATEMENT
+		FROM information_schema.TRIGGERS
+		ORDER BY TRIGGER_SCHEMA, TRIGGER_NAME`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not read triggers: %v", err)
+	}
+	defer rows.Close()
+
+	var objects []PersistenceObject
+	for rows.Next() {
+		var schema, name, timing, event, table, definer, body string
+		if err := rows.Scan(&schema, &name, &timing, &event, &table, &definer, &body); err != nil {
+			continue
+		}
+		objects = append(objects, PersistenceObject{
+			Type:    "TRIGGER",
+			Schema:  schema,
+			Name:    name,
+			Definer: definer,
+			Detail:  fmt.Sprintf("%s %s ON %s", timing, event, table),
+			Body:    body,
+			Flags:   flagBody(body),
+		})
+	}
+	return objects, rows.Err()
+}
+
+func collectEvents(db *sql.DB) ([]PersistenceObject, error) {
+	query := `
+		SELECT EVENT_SCHEMA, EVENT_NAME, DEFINER, STATUS,
+		COALESCE(CONCAT('EVERY ', INTERVAL_VALUE, ' ', INTERVAL_FIELD), CONCAT('AT ', EXECUTE_AT), ''),
+		EVENT_DEFINITION
+		FROM information_schema.EVENTS
+		ORDER BY EVENT_SCHEMA, EVENT_NAME`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not read events: %v", err)
+	}
+	defer rows.Close()
+
+	var objects []PersistenceObject
+	for rows.Next() {
+		var schema, name, definer, status, schedule, body string
+		if err := rows.Scan(&schema, &name, &definer, &status, &schedule, &body); err != nil {
+			continue
+		}
+		objects = append(objects, PersistenceObject{
+			Type:    "EVENT",
+			Schema:  schema,
+			Name:    name,
+			Definer: definer,
+			Detail:  fmt.Sprintf("%s %s", status, schedule),
+			Body:    body,
+			Flags:   flagBody(body),
+		})
+	}
+	return objects, rows.Err()
+}
+
+func collectRoutines(db *sql.DB) ([]PersistenceObject, error) {
+	query := `
+		SELECT ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE, DEFINER, COALESCE(ROUTINE_DEFINITION, '')
+		FROM information_schema.ROUTINES
+		ORDER BY ROUTINE_SCHEMA, ROUTINE_NAME`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not read routines: %v", err)
+	}
+	defer rows.Close()
+
+	var objects []PersistenceObject
+	for rows.Next() {
+		var schema, name, routineType, definer, body string
+		if err := rows.Scan(&schema, &name, &routineType, &definer, &body); err != nil {
+			continue
+		}
+		flags := flagRoutine(schema, body)
+		// The sys schema ships dozens of helper routines, only report the
+		// ones that look tampered with
+		if schema == "sys" && len(flags) == 0 {
+			continue
+		}
+		objects = append(objects, PersistenceObject{
+			Type:    routineType,
+			Schema:  schema,
+			Name:    name,
+			Definer: definer,
+			Body:    body,
+			Flags:   flags,
+		})
+	}
+	return objects, rows.Err()
+}
+
+func collectUDFs(db *sql.DB) ([]PersistenceObject, error) {
+	rows, err := db.Query("SELECT name, dl, type FROM mysql.func ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("could not read mysql.func: %v", err)
+	}
+	defer rows.Close()
+
+	var objects []PersistenceObject
+	for rows.Next() {
+		var name, library, udfType string
+		if err := rows.Scan(&name, &library, &udfType); err != nil {
+			continue
+		}
+		// Any UDF loads native code into the server
+		flags := []string{"loads native library " + library}
+		flags = append(flags, flagBody(name)...)
+		objects = append(objects, PersistenceObject{
+			Type:   "UDF",
+			Name:   name,
+			Detail: fmt.Sprintf("%s returning %s", library, udfType),
+			Body:   library,
+			Flags:  flags,
+		})
+	}
+	return objects, rows.Err()
+}
+
+func printPersistenceText(r *InventoryReport) {
+	utils.PrintHeader("PERSISTENCE (TRIGGERS, EVENTS, ROUTINES, UDFS)")
+	if msg, ok := r.Errors[sectionPersistence]; ok {
+		fmt.Println(msg)
+	}
+	if len(r.Persistence) == 0 {
+		fmt.Println("No triggers, events, routines or UDFs found")
+		return
+	}
+
+	for _, o := range r.Persistence {
+		marker := "   "
+		if len(o.Flags) > 0 {
+			marker = "[!]"
+		}
+		name := o.Name
+		if o.Schema != "" {
+			name = o.Schema + "." + o.Name
+		}
+		fmt.Printf("  %s %-9s | %-35s | Definer: %s\n", marker, o.Type, name, o.Definer)
+		if o.Detail != "" {
+			fmt.Printf("      |-- %s\n", o.Detail)
+		}
+		fmt.Printf("      |-- %s\n", utils.Truncate(o.Body, 120))
+		for _, flag := range o.Flags {
+			fmt.Printf("      |-- [!] %s\n", flag)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package mysqlModule
+
+import (
+	"slices"
+	"testing"
+)
+
+// executePreparedStmt is the body of sys.execute_prepared_stmt as shipped
+// with MySQL 8.
+const executePreparedStmt = `BEGIN
+    IF (@sys.debug = 'ON') THEN
+        SELECT in_query AS 'Debug';
+    END IF;
+
+    SET @sys.execute_prepared_stmt.sql = in_query;
+
+    PREPARE sys_execute_prepared_stmt FROM @sys.execute_prepared_stmt.sql;
+
+    IF (@sys.debug = 'ON') THEN
+        SELECT @sys.execute_prepared_stmt.sql AS 'Debug';
+    END IF;
+
+    EXECUTE sys_execute_prepared_stmt;
+
+    DEALLOCATE PREPARE sys_execute_prepared_stmt;
+
+    SET @sys.execute_prepared_stmt.sql = NULL;
+END`
+
+func TestFlagRoutine(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		body   string
+		want   []string
+	}{
+		{"stock sys routine", "sys", executePreparedStmt, nil},
+		{"dynamic SQL outside sys", "app", executePreparedStmt, []string{dynamicSQL}},
+		{"tampered sys routine", "sys", "BEGIN SELECT sys_exec('id'); " + executePreparedStmt + " END", []string{"shells out"}},
+		{"grant", "app", "BEGIN GRANT ALL ON *.* TO 'x'@'%'; END", []string{"issues grants"}},
+		{"user change", "app", "BEGIN UPDATE mysql.user SET authentication_string = ''; END", []string{"creates or modifies users"}},
+		{"harmless", "app", "BEGIN SELECT COUNT(*) FROM orders; END", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flagRoutine(tt.schema, tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("flagRoutine = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
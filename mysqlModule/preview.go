@@ -0,0 +1,64 @@
+package mysqlModule
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"ccdc-cli/utils"
+)
+
+// existingObjectQueries list the objects a restore preview compares with,
+// as kind, database and name.
+var existingObjectQueries = []string{
+	`SELECT 'database', SCHEMA_NAME, '' FROM information_schema.SCHEMATA`,
+	`SELECT IF(TABLE_TYPE = 'VIEW', 'view', 'table'), TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES`,
+	`SELECT LOWER(ROUTINE_TYPE), ROUTINE_SCHEMA, ROUTINE_NAME FROM information_schema.ROUTINES`,
+	`SELECT 'trigger', TRIGGER_SCHEMA, TRIGGER_NAME FROM information_schema.TRIGGERS`,
+	`SELECT 'event', EVENT_SCHEMA, EVENT_NAME FROM information_schema.EVENTS`,
+	`SELECT 'account', '', CONCAT(User, '@', Host) FROM mysql.user`,
+}
+
+// existingObjects returns the utils.ObjectKey of every object on the server
+// a restore could overwrite.
+func existingObjects(password string) (map[string]bool, error) {
+	db, err := connectToDatabase(username, password, host, port, dbName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	existing := map[string]bool{}
+	for _, query := range existingObjectQueries {
+		if err := addObjectKeys(db, query, existing); err != nil {
+			return nil, fmt.Errorf("%s: %w", query, err)
+		}
+	}
+	return existing, nil
+}
+
+func addObjectKeys(db *sql.DB, query string, existing map[string]bool) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, schema, name string
+		if err := rows.Scan(&kind, &schema, &name); err != nil {
+			return err
+		}
+		if kind != "account" {
+			existing[utils.ObjectKey(kind, schema, "", name)] = true
+			continue
+		}
+		// roles are accounts too, and dumps may leave out the default host
+		for _, k := range []string{"user", "role"} {
+			existing[utils.ObjectKey(k, "", "", name)] = true
+			if user, ok := strings.CutSuffix(name, "@%"); ok {
+				existing[utils.ObjectKey(k, "", "", user)] = true
+			}
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,23 @@
+package mysqlModule
+
+import (
+	"fmt"
+	"strings"
+)
+
+var literalEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// quoteLiteral returns s as a single quoted MySQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + literalEscaper.Replace(s) + "'"
+}
+
+// quoteIdent returns name as a backtick quoted MySQL identifier.
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteAccount returns the 'user'@'host' form used by account statements.
+func quoteAccount(user, host string) string {
+	return fmt.Sprintf("%s@%s", quoteLiteral(user), quoteLiteral(host))
+}
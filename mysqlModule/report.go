@@ -0,0 +1,166 @@
+package mysqlModule
+
+import (
+	"fmt"
+	"strings"
+
+	"ccdc-cli/utils"
+)
+
+// Section keys used in InventoryReport.Errors.
+const (
+	sectionUsers        = "users"
+	sectionGrants       = "grants"
+	sectionDatabases    = "databases"
+	sectionSecurityVars = "security_variables"
+	sectionPersistence  = "persistence"
+)
+
+type InventoryReport struct {
+	Host           string              `json:"host" yaml:"host"`
+	Port           int                 `json:"port" yaml:"port"`
+	AnonymousLogin bool                `json:"anonymous_login" yaml:"anonymous_login"`
+	Users          []UserAccount       `json:"users" yaml:"users"`
+	RoleMappings   []RoleMapping       `json:"role_mappings" yaml:"role_mappings"`
+	Grants         []UserGrants        `json:"grants" yaml:"grants"`
+	Databases      []Database          `json:"databases" yaml:"databases"`
+	SecurityVars   []SecurityVar       `json:"security_variables" yaml:"security_variables"`
+	Persistence    []PersistenceObject `json:"persistence" yaml:"persistence"`
+	Findings       []utils.Finding     `json:"findings" yaml:"findings"`
+	Errors         map[string]string   `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+type UserAccount struct {
+	User        string `json:"user" yaml:"user"`
+	Host        string `json:"host" yaml:"host"`
+	Plugin      string `json:"plugin" yaml:"plugin"`
+	PasswordSet bool   `json:"password_set" yaml:"password_set"`
+}
+
+type RoleMapping struct {
+	User string `json:"user" yaml:"user"`
+	Host string `json:"host" yaml:"host"`
+	Role string `json:"role" yaml:"role"`
+}
+
+type UserGrants struct {
+	User   string   `json:"user" yaml:"user"`
+	Host   string   `json:"host" yaml:"host"`
+	Grants []string `json:"grants" yaml:"grants"`
+	Error  string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type Database struct {
+	Name   string  `json:"name" yaml:"name"`
+	SizeMB float64 `json:"size_mb" yaml:"size_mb"`
+	Tables []Table `json:"tables" yaml:"tables"`
+	Error  string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type Table struct {
+	Name    string `json:"name" yaml:"name"`
+	Engine  string `json:"engine" yaml:"engine"`
+	Rows    int64  `json:"rows" yaml:"rows"`
+	Created string `json:"created" yaml:"created"`
+}
+
+type SecurityVar struct {
+	Name        string         `json:"name" yaml:"name"`
+	Value       string         `json:"value" yaml:"value"`
+	Expected    string         `json:"expected" yaml:"expected"`
+	Passed      bool           `json:"passed" yaml:"passed"`
+	Severity    utils.Severity `json:"severity" yaml:"severity"`
+	Remediation string         `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+}
+
+func (r *InventoryReport) setError(section, msg string) {
+	if r.Errors == nil {
+		r.Errors = map[string]string{}
+	}
+	r.Errors[section] = msg
+}
+
+func printReportText(r *InventoryReport) {
+	utils.PrintHeader("ANONYMOUS LOGIN TEST")
+	if r.AnonymousLogin {
+		fmt.Printf("Server at %s allows ANONYMOUS login.\n", r.Host)
+	} else {
+		fmt.Println("Anonymous login disabled")
+	}
+
+	utils.PrintHeader("USER ACCOUNTS & AUTHENITCATION PLUGINS")
+	fmt.Printf("  %-25s | %-15s | %-15s\n", "User@Host", "Plugin", "Password Set")
+	for _, u := range r.Users {
+		userHost := fmt.Sprintf("%s@%s", u.User, u.Host)
+		fmt.Printf("  %-25s | %-15s | %-15s\n", userHost, u.Plugin, yesNo(u.PasswordSet))
+	}
+	if msg, ok := r.Errors[sectionUsers]; ok {
+		fmt.Println(msg)
+	}
+
+	utils.PrintHeader("ROLE MAPPINGS")
+	for _, m := range r.RoleMappings {
+		fmt.Printf("  - User '%s'@'%s' has role: %s\n", m.User, m.Host, m.Role)
+	}
+	if len(r.RoleMappings) == 0 {
+		fmt.Println("No Specific Roles Mapped")
+	}
+
+	utils.PrintHeader("Detailed User Privileges (GRANTS)")
+	if msg, ok := r.Errors[sectionGrants]; ok {
+		fmt.Println(msg)
+	}
+	for _, g := range r.Grants {
+		fmt.Printf("  GRANT for '%s'@'%s':\n", g.User, g.Host)
+		if g.Error != "" {
+			fmt.Println("    |-- [!] Could not retrieve")
+		}
+		for _, grant := range g.Grants {
+			fmt.Printf("    |-- %s\n", grant)
+		}
+		fmt.Println()
+	}
+
+	utils.PrintHeader("Database and Table Inventory")
+	if msg, ok := r.Errors[sectionDatabases]; ok {
+		fmt.Println(msg)
+	}
+	for _, d := range r.Databases {
+		fmt.Printf("  DATABASE: %s (Size: %.2f MB)\n", d.Name, d.SizeMB)
+		if d.Error != "" {
+			fmt.Printf("    |-- [1] Could not retrieve tables for %s\n", d.Name)
+			continue
+		}
+		for _, t := range d.Tables {
+			fmt.Printf("    |-- %-25s | %-10s | Rows: %-8d | Created: %s\n", t.Name, t.Engine, t.Rows, t.Created)
+		}
+		fmt.Println()
+	}
+
+	utils.PrintHeader("SECURITY VARIABLE CHECKS")
+	if msg, ok := r.Errors[sectionSecurityVars]; ok {
+		fmt.Println(msg)
+	} else {
+		fmt.Printf("  %-15s %-34s | %-20s | %s\n", "", "Variable Name", "Value", "Expected")
+		for _, v := range r.SecurityVars {
+			status := "PASS"
+			if !v.Passed {
+				status = "FAIL " + strings.ToUpper(v.Severity.String())
+			}
+			fmt.Printf("  [%-13s] %-34s | %-20s | %s\n", status, v.Name, utils.Truncate(v.Value, 20), v.Expected)
+			if !v.Passed && v.Remediation != "" {
+				fmt.Printf("                  |-- %s\n", v.Remediation)
+			}
+		}
+	}
+
+	printPersistenceText(r)
+	utils.PrintFindings(r.Findings)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
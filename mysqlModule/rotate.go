@@ -0,0 +1,182 @@
+package mysqlModule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"ccdc-cli/utils"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotateExclude  []string
+	rotateOutFile  string
+	passwordLength int
+)
+
+// systemAccounts are locked internal accounts that must keep their password.
+var systemAccounts = []string{"mysql.sys", "mysql.session", "mysql.infoschema", "mariadb.sys"}
+
+// passwordlessPlugins authenticate without a password so rotating them is
+// meaningless.
+var passwordlessPlugins = []string{"unix_socket", "auth_socket"}
+
+func getRotateCmd() *cobra.Command {
+	rotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the password of every MySQL account.",
+		Long: `Generate a strong random password for every account in mysql.user and
+apply it with ALTER USER (or SET PASSWORD on older servers).
+
+The new credentials are written to a file only the owner can read. Accounts
+can be skipped with --exclude, given either as 'user' or 'user@host'.`,
+		RunE:         runRotate,
+		SilenceUsage: true,
+	}
+	rotateCmd.Flags().StringSliceVarP(&rotateExclude, "exclude", "e", nil, "Accounts to skip (user or user@host)")
+	rotateCmd.Flags().StringVar(&rotateOutFile, "out", "", "File to write the new credentials to (default mysql-credentials-<timestamp>.txt)")
+	rotateCmd.Flags().IntVar(&passwordLength, "length", 24, "Length of the generated passwords")
+	rotateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the accounts without changing them")
+	rotateCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Rotate without asking for confirmation")
+	rotateCmd.Flags().StringVar(&changeLog, "log", "ccdc-changes.log", "File to record applied changes in")
+	return rotateCmd
+}
+
+func isExcluded(user, host string) bool {
+	return slices.Contains(rotateExclude, user) || slices.Contains(rotateExclude, user+"@"+host)
+}
+
+func runRotate(cmd *cobra.Command, args []string) error {
+	if passwordLength < 12 {
+		return fmt.Errorf("--length must be at least 12")
+	}
+
+	password, err := utils.GetPassword()
+	if err != nil {
+		return fmt.Errorf("failed to read password")
+	}
+
+	db, err := connectToDatabase(username, password, host, port, dbName, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Use a single connection throughout: if our own account is rotated the
+	// pool would not be able to open new ones
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("MySQL connection failed: %v", err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, "SELECT User, Host, plugin FROM mysql.user ORDER BY User, Host")
+	if err != nil {
+		return fmt.Errorf("could not list accounts: %v", err)
+	}
+	var accounts [][2]string
+	for rows.Next() {
+		var user, host, plugin string
+		if err := rows.Scan(&user, &host, &plugin); err != nil {
+			continue
+		}
+		switch {
+		case user == "":
+			fmt.Printf("  [-] Skipping anonymous account @'%s' (drop it with 'mysql harden')\n", host)
+		case slices.Contains(systemAccounts, user):
+		case slices.Contains(passwordlessPlugins, plugin):
+			fmt.Printf("  [-] Skipping '%s'@'%s' (%s has no password)\n", user, host, plugin)
+		case isExcluded(user, host):
+			fmt.Printf("  [-] Skipping '%s'@'%s' (excluded)\n", user, host)
+		default:
+			accounts = append(accounts, [2]string{user, host})
+		}
+	}
+	rows.Close()
+
+	utils.PrintHeader("PASSWORD ROTATION")
+	for _, a := range accounts {
+		fmt.Printf("  |-- '%s'@'%s'\n", a[0], a[1])
+	}
+	if len(accounts) == 0 {
+		fmt.Println("No accounts to rotate")
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("Dry run: %d account(s) would be rotated\n", len(accounts))
+		return nil
+	}
+	if !assumeYes && !utils.Confirm(fmt.Sprintf("Rotate %d account(s)?", len(accounts))) {
+		return nil
+	}
+
+	if rotateOutFile == "" {
+		rotateOutFile = fmt.Sprintf("mysql-credentials-%s.txt", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	out, err := utils.CreatePrivateFile(rotateOutFile)
+	if err != nil {
+		return fmt.Errorf("could not create credentials file: %v", err)
+	}
+	defer out.Close()
+	fmt.Fprintf(out, "# MySQL %s:%d rotated %s\n", host, port, time.Now().UTC().Format(time.RFC3339))
+
+	log := utils.NewChangeLog(changeLog, fmt.Sprintf("mysql %s:%d", host, port))
+	failed := 0
+	for _, a := range accounts {
+		newPassword, err := utils.GeneratePassword(passwordLength)
+		if err != nil {
+			return err
+		}
+
+		account := quoteAccount(a[0], a[1])
+		if err := setPassword(ctx, conn, account, newPassword); err != nil {
+			fmt.Printf("  [!] %s: %v\n", account, err)
+			log.Record("FAILED", "Rotate password for "+account, nil)
+			failed++
+			continue
+		}
+
+		// Write each credential as soon as it is applied so a later failure
+		// can't leave an account with an unknown password
+		if _, err := fmt.Fprintf(out, "%s@%s\t%s\n", a[0], a[1], newPassword); err != nil {
+			return fmt.Errorf("could not write credentials file: %v", err)
+		}
+		out.Sync()
+		log.Record("APPLIED", "Rotate password for "+account, nil)
+		fmt.Printf("  [+] %s\n", account)
+	}
+
+	fmt.Printf("Rotated %d of %d account(s), credentials written to %s\n", len(accounts)-failed, len(accounts), rotateOutFile)
+	if isRotated(accounts, username) {
+		fmt.Printf("Note: the password for %s was rotated, use the new one from %s\n", username, rotateOutFile)
+	}
+	return nil
+}
+
+func isRotated(accounts [][2]string, user string) bool {
+	for _, a := range accounts {
+		if a[0] == user {
+			return true
+		}
+	}
+	return false
+}
+
+// setPassword uses ALTER USER and falls back to SET PASSWORD for servers that
+// predate it (MySQL < 5.7.6, MariaDB < 10.2).
+func setPassword(ctx context.Context, conn *sql.Conn, account, password string) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER USER %s IDENTIFIED BY %s", account, quoteLiteral(password)))
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("SET PASSWORD FOR %s = PASSWORD(%s)", account, quoteLiteral(password)))
+	}
+	return err
+}
@@ -0,0 +1,270 @@
+package mysqlModule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"ccdc-cli/utils"
+)
+
+// safetySnapshot backs up the databases on the server a restore is about to
+// overwrite, one file each, into a new directory next to the backup. With
+// accounts set the accounts and their grants are saved too. It returns ""
+// when nothing on the server is affected.
+func safetySnapshot(password string, accounts bool) (string, error) {
+	all, err := serverDatabases(password)
+	if err != nil {
+		return "", err
+	}
+	var dbs []string
+	for _, db := range all {
+		if selector.IncludesDatabase(db) {
+			dbs = append(dbs, db)
+		}
+	}
+	if len(dbs) == 0 && !accounts {
+		fmt.Println("No existing databases are affected, skipping the safety snapshot")
+		return "", nil
+	}
+
+	dir := snapshotDir
+	if dir == "" {
+		dir = filepath.Dir(filepath.Clean(file))
+	}
+	path := filepath.Join(dir, utils.SnapshotName(host, port, "mysql", time.Now()))
+	job := &backupJob{password: password, useNative: !utils.CheckCliCmdExist("mysqldump")}
+	fmt.Printf("Taking a safety snapshot of %s into %s\n", strings.Join(dbs, ", "), path)
+	if err := job.backupDatabases(context.Background(), path, dbs); err != nil {
+		os.RemoveAll(path)
+		return "", err
+	}
+	if !accounts {
+		fmt.Println("Safety snapshot complete, accounts and grants are not part of it")
+		return path, nil
+	}
+	if err := snapshotAccounts(password, path); err != nil {
+		os.RemoveAll(path)
+		return "", fmt.Errorf("could not save the accounts: %w", err)
+	}
+	fmt.Println("Safety snapshot complete, accounts, password hashes and grants are saved too")
+	return path, nil
+}
+
+// accountsFile holds the accounts saved by a safety snapshot.
+const accountsFile = "accounts.json"
+
+// savedAccount is an account as it was before a full restore, which loads
+// the accounts and password hashes of the backup.
+type savedAccount struct {
+	User   string   `json:"user"`
+	Host   string   `json:"host"`
+	Role   bool     `json:"role,omitempty"`
+	Create string   `json:"create,omitempty"`
+	Grants []string `json:"grants"`
+}
+
+func (a savedAccount) account() dumpAccount {
+	return dumpAccount{user: a.User, host: a.Host, role: a.Role}
+}
+
+// defaultRoleClause is the DEFAULT ROLE list of a MySQL 8 SHOW CREATE USER,
+// which can only be set once the roles are granted.
+var defaultRoleClause = regexp.MustCompile(`\s+DEFAULT ROLE\s+` + quotedAccount + `(?:\s*,\s*` + quotedAccount + `)*`)
+
+const quotedAccount = "`(?:[^`]|``)*`@`(?:[^`]|``)*`"
+
+// accountConn opens a single connection with a dumper on it to read and
+// change accounts.
+func accountConn(ctx context.Context, password string) (*dumper, func(), error) {
+	db, err := connectToDatabase(username, password, host, port, dbName, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return &dumper{ctx: ctx, conn: conn}, func() { conn.Close(); db.Close() }, nil
+}
+
+// snapshotAccounts saves every account with its definition and grants into
+// the snapshot directory.
+func snapshotAccounts(password, dir string) error {
+	d, done, err := accountConn(context.Background(), password)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	accounts, err := d.queryAccounts()
+	if err != nil {
+		return err
+	}
+	// ignored where the variable doesn't exist, as in dumpUsers
+	d.conn.ExecContext(d.ctx, "SET SESSION print_identified_with_as_hex = ON")
+
+	var saved []savedAccount
+	for _, a := range accounts {
+		s := savedAccount{User: a.user, Host: a.host, Role: a.role}
+		if !a.role {
+			if s.Create, err = d.showCreate("SHOW CREATE USER "+a.name(), 0); err != nil {
+				return fmt.Errorf("%s: %w", a.name(), err)
+			}
+		}
+		if s.Grants, err = d.queryStrings("SHOW GRANTS FOR " + a.name()); err != nil {
+			return fmt.Errorf("%s: %w", a.name(), err)
+		}
+		saved = append(saved, s)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, accountsFile), data, 0600)
+}
+
+// accountRollback returns the statements that put the saved accounts back:
+// accounts the restore added are dropped, saved ones are created, their
+// privileges replaced and their password hashes set back. self is the
+// account running them as CURRENT_USER() returns it, it is neither dropped
+// nor has its privileges revoked.
+func accountRollback(saved []savedAccount, current []dumpAccount, self string) []string {
+	isSelf := func(a dumpAccount) bool { return a.user+"@"+a.host == self }
+	keep := map[string]bool{}
+	for _, s := range saved {
+		keep[s.account().name()] = true
+	}
+
+	var stmts []string
+	for _, a := range current {
+		if keep[a.name()] || isSelf(a) {
+			continue
+		}
+		if a.role {
+			stmts = append(stmts, "DROP ROLE "+a.name())
+		} else {
+			stmts = append(stmts, "DROP USER "+a.name())
+		}
+	}
+	for _, s := range saved {
+		if s.Role {
+			stmts = append(stmts, "CREATE ROLE IF NOT EXISTS "+s.account().name())
+			continue
+		}
+		create := defaultRoleClause.ReplaceAllString(s.Create, "")
+		stmts = append(stmts, strings.Replace(create, "CREATE USER ", "CREATE USER IF NOT EXISTS ", 1))
+	}
+	for _, s := range saved {
+		if !isSelf(s.account()) {
+			stmts = append(stmts, "REVOKE ALL PRIVILEGES, GRANT OPTION FROM "+s.account().name())
+		}
+		stmts = append(stmts, s.Grants...)
+	}
+	for _, s := range saved {
+		if !s.Role {
+			stmts = append(stmts, strings.Replace(s.Create, "CREATE USER ", "ALTER USER ", 1))
+		}
+	}
+	return append(stmts, "FLUSH PRIVILEGES")
+}
+
+// rollbackAccounts puts back the accounts saved by snapshotAccounts, if the
+// snapshot has them.
+func rollbackAccounts(password, snapshot string) error {
+	data, err := os.ReadFile(filepath.Join(snapshot, accountsFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var saved []savedAccount
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid %s: %w", accountsFile, err)
+	}
+
+	d, done, err := accountConn(context.Background(), password)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	current, err := d.queryAccounts()
+	if err != nil {
+		return err
+	}
+	var self string
+	if err := d.conn.QueryRowContext(d.ctx, "SELECT CURRENT_USER()").Scan(&self); err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolling back %d accounts and their grants\n", len(saved))
+	for _, stmt := range accountRollback(saved, current, self) {
+		if _, err := d.conn.ExecContext(d.ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", utils.Truncate(stmt, 80), err)
+		}
+	}
+	return nil
+}
+
+// offerRollback asks to put the databases and accounts saved by
+// safetySnapshot back after a failed restore. Databases restored whole are dropped first so nothing
+// the failed restore created is left behind.
+func offerRollback(snapshot, password string) {
+	if snapshot == "" {
+		return
+	}
+	if !utils.Confirm(fmt.Sprintf("Roll back to the safety snapshot %s?", snapshot)) {
+		fmt.Printf("Not rolling back, the snapshot is kept in %s\n", snapshot)
+		return
+	}
+	targets, err := utils.RestoreTargets(snapshot, nil)
+	if err == nil {
+		for _, t := range targets {
+			if err = rollbackDatabase(t, password); err != nil {
+				err = fmt.Errorf("%s: %w", t.Database, err)
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = rollbackAccounts(password, snapshot)
+	}
+	if err != nil {
+		fmt.Printf("Rollback Failed: %s\n", err)
+		fmt.Printf("The snapshot is kept in %s\n", snapshot)
+		return
+	}
+	fmt.Printf("Rolled back to the safety snapshot %s\n", snapshot)
+}
+
+func rollbackDatabase(t utils.RestoreTarget, password string) error {
+	if err := utils.CheckBeforeRestore(t.Path, "mysql", false); err != nil {
+		return err
+	}
+	in, err := utils.OpenBackup(t.Path, utils.DecryptKeys{})
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if !selector.NarrowsDatabase(t.Database) {
+		db, err := connectToDatabase(username, password, host, port, dbName, false)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("DROP DATABASE IF EXISTS " + quoteIdent(t.Database))
+		db.Close()
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Rolling back %s from %s...\n", t.Database, t.Path)
+	return loadDump(in, password)
+}
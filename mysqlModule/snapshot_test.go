@@ -0,0 +1,42 @@
+package mysqlModule
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAccountRollback(t *testing.T) {
+	saved := []savedAccount{
+		{User: "root", Host: "localhost", Create: "CREATE USER `root`@`localhost` IDENTIFIED WITH 'caching_sha2_password' AS 0x24 REQUIRE NONE",
+			Grants: []string{"GRANT ALL PRIVILEGES ON *.* TO `root`@`localhost` WITH GRANT OPTION"}},
+		{User: "app", Host: "%", Create: "CREATE USER `app`@`%` IDENTIFIED WITH 'caching_sha2_password' AS 0x25 DEFAULT ROLE `reader`@`%`,`writer`@`%` REQUIRE NONE",
+			Grants: []string{"GRANT USAGE ON *.* TO `app`@`%`", "GRANT `reader`@`%`,`writer`@`%` TO `app`@`%`"}},
+		{User: "auditor", Role: true, Grants: []string{"GRANT SELECT ON *.* TO `auditor`"}},
+	}
+	current := []dumpAccount{
+		{user: "root", host: "localhost"},
+		{user: "app", host: "%"},
+		{user: "backdoor", host: "%"},
+		{user: "oldrole", role: true},
+	}
+
+	want := []string{
+		"DROP USER 'backdoor'@'%'",
+		"DROP ROLE 'oldrole'",
+		"CREATE USER IF NOT EXISTS `root`@`localhost` IDENTIFIED WITH 'caching_sha2_password' AS 0x24 REQUIRE NONE",
+		"CREATE USER IF NOT EXISTS `app`@`%` IDENTIFIED WITH 'caching_sha2_password' AS 0x25 REQUIRE NONE",
+		"CREATE ROLE IF NOT EXISTS 'auditor'",
+		"GRANT ALL PRIVILEGES ON *.* TO `root`@`localhost` WITH GRANT OPTION",
+		"REVOKE ALL PRIVILEGES, GRANT OPTION FROM 'app'@'%'",
+		"GRANT USAGE ON *.* TO `app`@`%`",
+		"GRANT `reader`@`%`,`writer`@`%` TO `app`@`%`",
+		"REVOKE ALL PRIVILEGES, GRANT OPTION FROM 'auditor'",
+		"GRANT SELECT ON *.* TO `auditor`",
+		"ALTER USER `root`@`localhost` IDENTIFIED WITH 'caching_sha2_password' AS 0x24 REQUIRE NONE",
+		"ALTER USER `app`@`%` IDENTIFIED WITH 'caching_sha2_password' AS 0x25 DEFAULT ROLE `reader`@`%`,`writer`@`%` REQUIRE NONE",
+		"FLUSH PRIVILEGES",
+	}
+	if got := accountRollback(saved, current, "root@localhost"); !slices.Equal(got, want) {
+		t.Errorf("accountRollback =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,254 @@
+package mysqlModule
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval time.Duration
+	killIDs       []int64
+	killUsers     []string
+	killHosts     []string
+)
+
+type session struct {
+	ID      int64
+	User    string
+	Host    string
+	DB      sql.NullString
+	Command string
+	Time    int64
+	State   sql.NullString
+	Info    sql.NullString
+}
+
+// clientHost strips the port from a PROCESSLIST host column.
+func (s session) clientHost() string {
+	if h, _, err := net.SplitHostPort(s.Host); err == nil {
+		return h
+	}
+	return s.Host
+}
+
+func getWatchCmd() *cobra.Command {
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Monitor and kill live MySQL sessions.",
+		Long: `Poll the process list and print every session with its running statement.
+Sessions from users or hosts not seen before are highlighted.
+
+Connections can be killed with --kill, --kill-user and --kill-host, or while
+watching by typing one of:
+  k <id>      kill the connection with this id
+  u <user>    kill every connection from this user
+  h <host>    kill every connection from this host
+  q           quit`,
+		RunE:         runWatch,
+		SilenceUsage: true,
+	}
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 5*time.Second, "Time between polls")
+	watchCmd.Flags().Int64SliceVar(&killIDs, "kill", nil, "Kill the connections with these ids and exit")
+	watchCmd.Flags().StringSliceVar(&killUsers, "kill-user", nil, "Kill every connection from these users and exit")
+	watchCmd.Flags().StringSliceVar(&killHosts, "kill-host", nil, "Kill every connection from these hosts and exit")
+	return watchCmd
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	password, err := utils.GetPassword()
+	if err != nil {
+		return fmt.Errorf("failed to read password")
+	}
+
+	db, err := connectToDatabase(username, password, host, port, dbName, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("MySQL connection failed: %v", err)
+	}
+
+	if len(killIDs) > 0 || len(killUsers) > 0 || len(killHosts) > 0 {
+		for _, id := range killIDs {
+			killSession(db, id)
+		}
+		for _, user := range killUsers {
+			killMatching(db, func(s session) bool { return s.User == user })
+		}
+		for _, h := range killHosts {
+			killMatching(db, func(s session) bool { return s.clientHost() == h })
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	seenUsers := map[string]bool{}
+	seenHosts := map[string]bool{}
+	seenSessions := map[int64]bool{}
+	first := true
+
+	commands := utils.CommandLines()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		sessions, err := listSessions(db)
+		if err != nil {
+			fmt.Printf("Error reading process list: %v\n", err)
+		} else {
+			printSessions(sessions, seenUsers, seenHosts, seenSessions, first)
+			first = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case line, ok := <-commands:
+			if !ok {
+				commands = nil
+				continue
+			}
+			if !handleWatchCommand(db, line) {
+				return nil
+			}
+		}
+	}
+}
+
+func listSessions(db *sql.DB) ([]session, error) {
+	query := `
+		SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO
+		FROM information_schema.PROCESSLIST
+		WHERE ID <> CONNECTION_ID()
+		ORDER BY ID`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []session
+	for rows.Next() {
+		var s session
+		if err := rows.Scan(&s.ID, &s.User, &s.Host, &s.DB, &s.Command, &s.Time, &s.State, &s.Info); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// printSessions prints the process list and marks users, hosts and sessions
+// that were not present in earlier polls. The first poll only records what
+// is already connected.
+func printSessions(sessions []session, seenUsers, seenHosts map[string]bool, seenSessions map[int64]bool, first bool) {
+	utils.PrintHeader(fmt.Sprintf("MYSQL SESSIONS @ %s", time.Now().Format("15:04:05")))
+	fmt.Printf("  %-4s %-8s | %-16s | %-22s | %-12s | %-8s | %-6s | %s\n", "", "ID", "User", "Host", "DB", "Command", "Time", "Statement")
+
+	for _, s := range sessions {
+		var flags []string
+		if !first && !seenUsers[s.User] {
+			flags = append(flags, "NEW USER")
+		}
+		if !first && !seenHosts[s.clientHost()] {
+			flags = append(flags, "NEW HOST")
+		}
+		marker := "    "
+		if !seenSessions[s.ID] && !first {
+			marker = "[+] "
+		}
+		if len(flags) > 0 {
+			marker = "[!] "
+		}
+
+		statement := s.Info.String
+		if statement == "" {
+			statement = s.State.String
+		}
+		fmt.Printf("  %s %-8d | %-16s | %-22s | %-12s | %-8s | %-6d | %s\n",
+			marker, s.ID, s.User, s.Host, s.DB.String, s.Command, s.Time, utils.Truncate(statement, 80))
+		if len(flags) > 0 {
+			fmt.Printf("       |-- %s: %s@%s\n", strings.Join(flags, ", "), s.User, s.clientHost())
+		}
+
+		seenUsers[s.User] = true
+		seenHosts[s.clientHost()] = true
+		seenSessions[s.ID] = true
+	}
+	fmt.Println("\n  Commands: k <id> | u <user> | h <host> | q")
+}
+
+// handleWatchCommand runs a command typed during watch and reports whether
+// watching should continue.
+func handleWatchCommand(db *sql.DB, line string) bool {
+	fields := strings.Fields(line)
+	if fields[0] == "q" {
+		return false
+	}
+	if len(fields) != 2 {
+		fmt.Println("Usage: k <id> | u <user> | h <host> | q")
+		return true
+	}
+
+	switch fields[0] {
+	case "k":
+		id, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid connection id: %s\n", fields[1])
+			return true
+		}
+		killSession(db, id)
+	case "u":
+		killMatching(db, func(s session) bool { return s.User == fields[1] })
+	case "h":
+		killMatching(db, func(s session) bool { return s.clientHost() == fields[1] })
+	default:
+		fmt.Println("Usage: k <id> | u <user> | h <host> | q")
+	}
+	return true
+}
+
+func killSession(db *sql.DB, id int64) {
+	if _, err := db.Exec(fmt.Sprintf("KILL %d", id)); err != nil {
+		fmt.Printf("  [!] Could not kill %d: %v\n", id, err)
+		return
+	}
+	fmt.Printf("  [+] Killed connection %d\n", id)
+}
+
+func killMatching(db *sql.DB, match func(session) bool) {
+	sessions, err := listSessions(db)
+	if err != nil {
+		fmt.Printf("Error reading process list: %v\n", err)
+		return
+	}
+
+	killed := 0
+	for _, s := range sessions {
+		if match(s) {
+			killSession(db, s.ID)
+			killed++
+		}
+	}
+	if killed == 0 {
+		fmt.Println("  No matching connections")
+	}
+}
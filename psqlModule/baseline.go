@@ -0,0 +1,118 @@
+package psqlModule
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"ccdc-cli/utils"
+)
+
+// snapshot flattens the report into key/value maps per diff category.
+func (r *InventoryReport) snapshot() map[string]map[string]string {
+	s := map[string]map[string]string{
+		"role":        {},
+		"data access": {},
+		"database":    {},
+		"table":       {},
+		"persistence": {},
+		"server role": {},
+		"hba rule":    {},
+		"setting":     {},
+	}
+
+	for _, role := range r.Roles {
+		s["role"][role.Name] = fmt.Sprintf("super=%s nopass=%s login=%s",
+			yesNo(role.Superuser), yesNo(role.NoPassword), yesNo(role.CanLogin))
+	}
+	for _, access := range r.DataAccess {
+		for _, u := range access.Users {
+			s["data access"][access.Database+"/"+u.User] = fmt.Sprintf("conn=%s read=%s write=%s",
+				yesNo(u.Connect), yesNo(u.Read), yesNo(u.Write))
+		}
+	}
+	for _, p := range r.Persistence {
+		for _, t := range p.EventTriggers {
+			s["persistence"][p.Database+" event trigger "+t.Name] = t.Event + " -> " + t.Function
+		}
+		for _, t := range p.Triggers {
+			s["persistence"][p.Database+" trigger "+t.Table+"."+t.Name] = t.Function + " " + t.FunctionHash
+		}
+		for _, f := range p.UntrustedFunctions {
+			s["persistence"][p.Database+" function "+f.Schema+"."+f.Name] = f.Language + " " + utils.Fingerprint(f.Body)
+		}
+		for _, e := range p.Extensions {
+			s["persistence"][p.Database+" extension "+e.Name] = e.Version
+		}
+	}
+	for _, m := range r.ServerRoleMembers {
+		s["server role"][m.Member+" in "+m.Role] = ""
+	}
+	if r.HBA != nil {
+		// pg_hba.conf is first match wins, so a rule's position is part of
+		// what it does. Positions count rules, not lines, so edits to
+		// comments don't show up as changes
+		for i, rule := range r.HBA.Rules {
+			key := fmt.Sprintf("#%d %s %s %s %s", i+1, rule.Type, strings.Join(rule.Databases, ","), strings.Join(rule.Users, ","), rule.Address)
+			s["hba rule"][key] = strings.Join(append([]string{rule.Method}, rule.Options...), " ")
+		}
+	}
+	for _, setting := range r.Settings {
+		s["setting"][setting.Name] = setting.Value + " (" + setting.Source + ")"
+	}
+	for _, e := range r.AlterSystem {
+		s["setting"]["ALTER SYSTEM "+e.Name] = e.Value
+	}
+	for _, d := range r.Databases {
+		s["database"][d.Name] = ""
+		for _, t := range d.Tables {
+			s["table"][d.Name+"."+t.Schema+"."+t.Name] = ""
+		}
+	}
+	return s
+}
+
+// securityCategories lists the diff categories that make the command fail.
+// New or dropped databases and tables are reported but are routine.
+var securityCategories = map[string]bool{
+	"role":        true,
+	"data access": true,
+	"persistence": true,
+	"server role": true,
+	"hba rule":    true,
+	"setting":     true,
+}
+
+var diffCategoryOrder = []string{"role", "data access", "server role", "persistence", "hba rule", "setting", "database", "table"}
+
+func diffReports(base, current *InventoryReport) []utils.Change {
+	baseSnap := base.snapshot()
+	currentSnap := current.snapshot()
+
+	var changes []utils.Change
+	for _, category := range diffCategoryOrder {
+		changes = append(changes, utils.DiffSnapshots(category, securityCategories[category], baseSnap[category], currentSnap[category])...)
+	}
+	return changes
+}
+
+// compareWithBaseline diffs report against the baseline stored in path and
+// returns an error when a security relevant change was found.
+func compareWithBaseline(path string, report *InventoryReport) error {
+	var base InventoryReport
+	if err := utils.LoadSnapshot(path, &base); err != nil {
+		return err
+	}
+
+	changes := diffReports(&base, report)
+	if output == utils.OutputText {
+		utils.PrintChanges(changes)
+	} else if err := utils.WriteStructured(os.Stdout, output, changes); err != nil {
+		return err
+	}
+
+	if utils.HasSecurityChange(changes) {
+		return fmt.Errorf("security relevant changes detected since baseline %s", path)
+	}
+	return nil
+}
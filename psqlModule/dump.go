@@ -0,0 +1,626 @@
+package psqlModule
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// userSchemas filters pg_namespace n down to schemas that belong in a dump.
+const userSchemas = `n.nspname NOT IN ('pg_catalog', 'information_schema')
+	AND n.nspname !~ '^pg_toast' AND n.nspname !~ '^pg_temp_'`
+
+// nativeDumpHeader starts every dump written by nativeBackup.
+const nativeDumpHeader = "--\n-- ccdc-cli native PostgreSQL dump"
+
+// notExtensionMember excludes objects created by an extension, they are
+// recreated by CREATE EXTENSION.
+func notExtensionMember(catalog, oid string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM pg_depend e
+		WHERE e.classid = '%s'::regclass AND e.objid = %s AND e.deptype = 'e')`, catalog, oid)
+}
+
+// aclQuery returns a query that rebuilds the privileges stored in acl for
+// every object in from matching where. kind and object are SQL expressions
+// giving the GRANT object type and name.
+func aclQuery(kind, object, acl, from, where string) string {
+	return fmt.Sprintf(`
+	SELECT format('REVOKE ALL ON %%s %%s FROM PUBLIC;', x.kind, x.object) || string_agg(
+		format(E'\nGRANT %%s ON %%s %%s TO %%s%%s;', x.privilege_type, x.kind, x.object,
+			CASE WHEN x.grantee = 0 THEN 'PUBLIC' ELSE quote_ident(pg_get_userbyid(x.grantee)) END,
+			CASE WHEN x.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END),
+		'' ORDER BY x.grantee, x.privilege_type)
+	FROM (SELECT %s AS kind, %s AS object, a.*
+		FROM %s CROSS JOIN LATERAL aclexplode(%s) a WHERE %s) x
+	GROUP BY x.kind, x.object
+	ORDER BY x.object`, kind, object, from, acl, where)
+}
+
+// pgDumper writes a plain SQL dump of the whole cluster in the layout of
+// pg_dumpall. Each database is read inside one repeatable read transaction.
+type pgDumper struct {
+	ctx context.Context
+	w   *bufio.Writer
+	// version is the server_version_num of the server
+	version int
+}
+
+// minNativeVersion is the oldest server the native engine can read, the
+// catalog queries use pg_attribute.attgenerated from PostgreSQL 12.
+const minNativeVersion = 120000
+
+func (d *pgDumper) printf(format string, args ...any) {
+	fmt.Fprintf(d.w, format, args...)
+}
+
+// emit writes every statement returned by query under a section comment.
+func (d *pgDumper) emit(tx pgx.Tx, section, query string, args ...any) error {
+	rows, err := tx.Query(d.ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", section, err)
+	}
+	stmts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("%s: %w", section, err)
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+	d.printf("--\n-- %s\n--\n\n", section)
+	for _, stmt := range stmts {
+		d.printf("%s\n", stmt)
+	}
+	d.printf("\n")
+	return nil
+}
+
+// nativeBackup dumps roles, databases and their contents to w without
+// pg_dumpall. The output is loaded with psql connected to postgres. With an
+// active selector only the selected databases are dumped, without roles.
+func nativeBackup(ctx context.Context, password string, w io.Writer, sel *utils.Selector) error {
+	d := &pgDumper{ctx: ctx, w: bufio.NewWriterSize(w, 1<<16)}
+
+	db, err := connectToDatabaseDB(username, password, host, port, "postgres", false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRow(ctx, "SHOW server_version_num").Scan(&version); err != nil {
+		return err
+	}
+	if d.version, _ = strconv.Atoi(version); d.version < minNativeVersion {
+		return fmt.Errorf("the native engine needs PostgreSQL 12 or later, the server is %s, install pg_dump instead", version)
+	}
+
+	d.printf(nativeDumpHeader+"\n-- Host: %s:%d    Date: %s\n--\n\n",
+		host, port, time.Now().UTC().Format(time.RFC3339))
+	d.printf("SET client_encoding = 'UTF8';\nSET standard_conforming_strings = on;\n\n")
+
+	tx, err := beginDumpTx(d.ctx, db)
+	if err != nil {
+		return err
+	}
+	var databases []string
+	if sel.Active() {
+		// roles and database settings are instance wide, a partial backup
+		// leaves them out
+		databases, err = queryDatabases(d.ctx, tx)
+	} else {
+		databases, err = d.dumpGlobals(tx)
+	}
+	tx.Rollback(d.ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range databases {
+		if !sel.IncludesDatabase(name) {
+			continue
+		}
+		fmt.Printf("  |-- Dumping %s\n", name)
+		if err := d.dumpDatabase(password, name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	d.printf("--\n-- Dump completed %s\n--\n", time.Now().UTC().Format(time.RFC3339))
+	return d.w.Flush()
+}
+
+func beginDumpTx(ctx context.Context, db *pgxpool.Pool) (pgx.Tx, error) {
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	// an empty search_path makes every name in the generated DDL schema
+	// qualified, the fixed styles make COPY output load on any server
+	for _, stmt := range []string{
+		"SELECT pg_catalog.set_config('search_path', '', true)",
+		"SET LOCAL DateStyle = ISO",
+		"SET LOCAL IntervalStyle = postgres",
+		"SET LOCAL extra_float_digits = 3",
+	} {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			tx.Rollback(ctx)
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// dumpGlobals writes roles, role memberships and the CREATE DATABASE
+// statements, and returns the databases to dump.
+func (d *pgDumper) dumpGlobals(tx pgx.Tx) ([]string, error) {
+	roleQuery := `
+	SELECT format('DO $ccdc$BEGIN CREATE ROLE %%I; EXCEPTION WHEN duplicate_object THEN NULL; END$ccdc$;', r.rolname)
+		|| E'\n' || format('ALTER ROLE %%I WITH %%s %%s %%s %%s %%s %%s %%s CONNECTION LIMIT %%s%%s%%s;', r.rolname,
+			CASE WHEN r.rolsuper THEN 'SUPERUSER' ELSE 'NOSUPERUSER' END,
+			CASE WHEN r.rolinherit THEN 'INHERIT' ELSE 'NOINHERIT' END,
+			CASE WHEN r.rolcreaterole THEN 'CREATEROLE' ELSE 'NOCREATEROLE' END,
+			CASE WHEN r.rolcreatedb THEN 'CREATEDB' ELSE 'NOCREATEDB' END,
+			CASE WHEN r.rolcanlogin THEN 'LOGIN' ELSE 'NOLOGIN' END,
+			CASE WHEN r.rolreplication THEN 'REPLICATION' ELSE 'NOREPLICATION' END,
+			CASE WHEN r.rolbypassrls THEN 'BYPASSRLS' ELSE 'NOBYPASSRLS' END,
+			r.rolconnlimit,
+			CASE WHEN %s IS NOT NULL THEN ' PASSWORD ' || quote_literal(%[1]s) ELSE '' END,
+			CASE WHEN r.rolvaliduntil IS NOT NULL THEN ' VALID UNTIL ' || quote_literal(r.rolvaliduntil::text) ELSE '' END)
+	FROM %s r WHERE r.rolname !~ '^pg_' ORDER BY r.rolname`
+
+	// password hashes are only readable by superusers through pg_authid
+	if _, err := tx.Exec(d.ctx, "SAVEPOINT roles"); err != nil {
+		return nil, err
+	}
+	if err := d.emit(tx, "Roles", fmt.Sprintf(roleQuery, "r.rolpassword", "pg_authid")); err != nil {
+		if _, rbErr := tx.Exec(d.ctx, "ROLLBACK TO SAVEPOINT roles"); rbErr != nil {
+			return nil, rbErr
+		}
+		d.printf("-- pg_authid is not readable, roles are dumped without passwords\n\n")
+		if err := d.emit(tx, "Roles", fmt.Sprintf(roleQuery, "NULL::text", "pg_roles")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.emit(tx, "Role memberships", `
+	SELECT format('GRANT %I TO %I%s;', r.rolname, m.rolname,
+		CASE WHEN a.admin_option THEN ' WITH ADMIN OPTION' ELSE '' END)
+	FROM pg_auth_members a
+	JOIN pg_roles r ON r.oid = a.roleid
+	JOIN pg_roles m ON m.oid = a.member
+	WHERE m.rolname !~ '^pg_'
+	ORDER BY r.rolname, m.rolname`); err != nil {
+		return nil, err
+	}
+
+	// CREATE DATABASE can't run inside a DO block, \gexec only runs it when
+	// the database is missing
+	if err := d.emit(tx, "Databases", `
+	SELECT format(E'SELECT %L WHERE NOT EXISTS (SELECT FROM pg_database WHERE datname = %L)\\gexec',
+		format('CREATE DATABASE %I WITH TEMPLATE = template0 ENCODING = %L LC_COLLATE = %L LC_CTYPE = %L',
+			d.datname, pg_encoding_to_char(d.encoding), d.datcollate, d.datctype), d.datname)
+		|| E'\n' || format('ALTER DATABASE %I OWNER TO %I;', d.datname, pg_get_userbyid(d.datdba))
+	FROM pg_database d WHERE d.datallowconn AND NOT d.datistemplate
+	ORDER BY d.datname`); err != nil {
+		return nil, err
+	}
+
+	if err := d.emit(tx, "Database privileges", aclQuery("'DATABASE'", "quote_ident(d.datname)", "d.datacl",
+		"pg_database d", "d.datallowconn AND NOT d.datistemplate")); err != nil {
+		return nil, err
+	}
+
+	return queryDatabases(d.ctx, tx)
+}
+
+// queryDatabases returns the databases that can be connected to and dumped.
+func queryDatabases(ctx context.Context, tx pgx.Tx) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+	SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+var connValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// connectLine returns a psql \connect meta-command for database name.
+func connectLine(name string) string {
+	conninfo := "dbname='" + connValueEscaper.Replace(name) + "'"
+	return `\connect -reuse-previous=on "` + strings.ReplaceAll(conninfo, `"`, `""`) + `"`
+}
+
+type dumpTable struct {
+	name    string
+	kind    string
+	create  string
+	columns string
+}
+
+func (d *pgDumper) dumpDatabase(password, name string) error {
+	db, err := connectToDatabaseDB(username, password, host, port, name, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := beginDumpTx(d.ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(d.ctx)
+
+	d.printf("--\n-- Database %s\n--\n\n", quoteIdent(name))
+	d.printf("%s\n\n", connectLine(name))
+	d.printf("SET statement_timeout = 0;\nSET lock_timeout = 0;\nSET client_encoding = 'UTF8';\n")
+	d.printf("SET standard_conforming_strings = on;\nSELECT pg_catalog.set_config('search_path', '', false);\n")
+	d.printf("SET check_function_bodies = false;\nSET DateStyle = ISO;\nSET client_min_messages = warning;\n\n")
+
+	steps := []struct {
+		section string
+		query   string
+	}{
+		{"Schemas", `
+		SELECT format('CREATE SCHEMA IF NOT EXISTS %I;', n.nspname) || E'\n'
+			|| format('ALTER SCHEMA %I OWNER TO %I;', n.nspname, pg_get_userbyid(n.nspowner))
+		FROM pg_namespace n WHERE ` + userSchemas + ` AND ` + notExtensionMember("pg_namespace", "n.oid") + `
+		ORDER BY n.nspname`},
+		{"Extensions", `
+		SELECT format('CREATE EXTENSION IF NOT EXISTS %I WITH SCHEMA %I;', x.extname, n.nspname)
+		FROM pg_extension x JOIN pg_namespace n ON n.oid = x.extnamespace
+		ORDER BY x.oid`},
+		{"Types", `
+		SELECT CASE t.typtype
+			WHEN 'e' THEN format('CREATE TYPE %I.%I AS ENUM (%s);', n.nspname, t.typname,
+				(SELECT string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder)
+				 FROM pg_enum e WHERE e.enumtypid = t.oid))
+			WHEN 'd' THEN format('CREATE DOMAIN %I.%I AS %s%s%s%s%s;', n.nspname, t.typname,
+				format_type(t.typbasetype, t.typtypmod),
+				CASE WHEN t.typcollation <> 0 AND t.typcollation <> b.typcollation THEN
+					(SELECT format(' COLLATE %I.%I', cn.nspname, co.collname) FROM pg_collation co
+					 JOIN pg_namespace cn ON cn.oid = co.collnamespace WHERE co.oid = t.typcollation)
+				ELSE '' END,
+				CASE WHEN t.typdefaultbin IS NOT NULL THEN ' DEFAULT ' || pg_get_expr(t.typdefaultbin, 0) ELSE '' END,
+				CASE WHEN t.typnotnull THEN ' NOT NULL' ELSE '' END,
+				COALESCE((SELECT string_agg(format(' CONSTRAINT %I %s', co.conname, pg_get_constraintdef(co.oid)), '' ORDER BY co.conname)
+					FROM pg_constraint co WHERE co.contypid = t.oid AND co.contype = 'c'), ''))
+			WHEN 'c' THEN format('CREATE TYPE %I.%I AS (%s);', n.nspname, t.typname,
+				COALESCE((SELECT string_agg(format('%I %s', a.attname, format_type(a.atttypid, a.atttypmod)), ', ' ORDER BY a.attnum)
+					FROM pg_attribute a WHERE a.attrelid = t.typrelid AND a.attnum > 0 AND NOT a.attisdropped), ''))
+			ELSE format('CREATE TYPE %I.%I AS RANGE (SUBTYPE = %s%s);', n.nspname, t.typname,
+				format_type(r.rngsubtype, NULL),
+				CASE WHEN r.rngsubdiff::oid <> 0 THEN ', SUBTYPE_DIFF = ' || r.rngsubdiff::text ELSE '' END)
+			END || E'\n'
+			|| format('ALTER %s %I.%I OWNER TO %I;', CASE WHEN t.typtype = 'd' THEN 'DOMAIN' ELSE 'TYPE' END,
+				n.nspname, t.typname, pg_get_userbyid(t.typowner))
+		FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+		LEFT JOIN pg_type b ON b.oid = t.typbasetype
+		LEFT JOIN pg_range r ON r.rngtypid = t.oid
+		LEFT JOIN pg_class tc ON tc.oid = t.typrelid
+		WHERE (t.typtype IN ('e', 'd', 'r') OR (t.typtype = 'c' AND tc.relkind = 'c'))
+		AND ` + userSchemas + ` AND ` + notExtensionMember("pg_type", "t.oid") + `
+		ORDER BY t.oid`},
+		{"Sequences", `
+		SELECT format('CREATE SEQUENCE IF NOT EXISTS %I.%I AS %s INCREMENT BY %s MINVALUE %s MAXVALUE %s START WITH %s CACHE %s%s;',
+			n.nspname, c.relname, format_type(s.seqtypid, NULL), s.seqincrement, s.seqmin, s.seqmax,
+			s.seqstart, s.seqcache, CASE WHEN s.seqcycle THEN ' CYCLE' ELSE '' END) || E'\n'
+			|| format('ALTER SEQUENCE %I.%I OWNER TO %I;', n.nspname, c.relname, pg_get_userbyid(c.relowner))
+		FROM pg_sequence s JOIN pg_class c ON c.oid = s.seqrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE ` + userSchemas + ` AND NOT EXISTS (SELECT 1 FROM pg_depend e
+			WHERE e.classid = 'pg_class'::regclass AND e.objid = c.oid AND e.deptype IN ('i', 'e'))
+		ORDER BY n.nspname, c.relname`},
+	}
+	for _, step := range steps {
+		if err := d.emit(tx, step.section, step.query); err != nil {
+			return err
+		}
+	}
+
+	tables, err := d.queryTables(tx)
+	if err != nil {
+		return err
+	}
+	if len(tables) > 0 {
+		d.printf("--\n-- Tables\n--\n\n")
+	}
+	for _, t := range tables {
+		d.printf("%s\n\n", t.create)
+	}
+
+	steps = []struct {
+		section string
+		query   string
+	}{
+		{"Functions", `
+		SELECT pg_get_functiondef(p.oid) || E';\n'
+			|| format('ALTER ROUTINE %s OWNER TO %I;', p.oid::regprocedure, pg_get_userbyid(p.proowner))
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.prokind IN ('f', 'p') AND ` + userSchemas + ` AND ` + notExtensionMember("pg_proc", "p.oid") + `
+		ORDER BY p.oid`},
+		{"Views", `
+		SELECT CASE WHEN c.relkind = 'm'
+			THEN format(E'CREATE MATERIALIZED VIEW %I.%I AS\n%s\nWITH NO DATA;', n.nspname, c.relname, rtrim(pg_get_viewdef(c.oid), ';'))
+			ELSE format(E'CREATE VIEW %I.%I AS\n%s', n.nspname, c.relname, pg_get_viewdef(c.oid)) END || E'\n'
+			|| format('ALTER %s %I.%I OWNER TO %I;', CASE WHEN c.relkind = 'm' THEN 'MATERIALIZED VIEW' ELSE 'VIEW' END,
+				n.nspname, c.relname, pg_get_userbyid(c.relowner))
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY c.oid`},
+		{"Column defaults", `
+		SELECT format('ALTER TABLE ONLY %I.%I ALTER COLUMN %I SET DEFAULT %s;',
+			n.nspname, c.relname, a.attname, pg_get_expr(ad.adbin, ad.adrelid))
+		FROM pg_attrdef ad
+		JOIN pg_attribute a ON a.attrelid = ad.adrelid AND a.attnum = ad.adnum
+		JOIN pg_class c ON c.oid = ad.adrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE a.attgenerated = '' AND c.relkind IN ('r', 'p') AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY n.nspname, c.relname, a.attnum`},
+		{"Sequence ownership", `
+		SELECT format('ALTER SEQUENCE %I.%I OWNED BY %I.%I.%I;', sn.nspname, s.relname, tn.nspname, t.relname, a.attname)
+		FROM pg_depend dep
+		JOIN pg_class s ON s.oid = dep.objid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class t ON t.oid = dep.refobjid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = dep.refobjsubid
+		WHERE dep.classid = 'pg_class'::regclass AND dep.refclassid = 'pg_class'::regclass AND dep.deptype = 'a'
+		AND sn.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY sn.nspname, s.relname`},
+	}
+	for _, step := range steps {
+		if err := d.emit(tx, step.section, step.query); err != nil {
+			return err
+		}
+	}
+
+	if err := d.dumpTableData(tx, tables); err != nil {
+		return err
+	}
+
+	steps = []struct {
+		section string
+		query   string
+	}{
+		{"Sequence values", `
+		SELECT format('SELECT pg_catalog.setval(%L, %s, true);', format('%I.%I', s.schemaname, s.sequencename), s.last_value)
+		FROM pg_sequences s
+		JOIN pg_namespace n ON n.nspname = s.schemaname
+		JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = s.sequencename
+		WHERE s.last_value IS NOT NULL AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY 1`},
+		{"Constraints", `
+		SELECT format('ALTER TABLE %s%I.%I ADD CONSTRAINT %I %s;', CASE WHEN c.relkind = 'p' THEN '' ELSE 'ONLY ' END,
+			n.nspname, c.relname, co.conname, pg_get_constraintdef(co.oid))
+		FROM pg_constraint co
+		JOIN pg_class c ON c.oid = co.conrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE co.contype IN ('p', 'u', 'x', 'c', 'f') AND co.conparentid = 0 AND co.conislocal
+		AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY co.contype = 'f', n.nspname, c.relname, co.conname`},
+		{"Indexes", `
+		SELECT pg_get_indexdef(i.indexrelid) || ';'
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_class c ON c.oid = i.indrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'm') AND NOT ic.relispartition
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint co WHERE co.conindid = i.indexrelid AND co.contype IN ('p', 'u', 'x'))
+		AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY n.nspname, c.relname, ic.relname`},
+		{"Materialized view data", `
+		SELECT format('REFRESH MATERIALIZED VIEW %I.%I;', n.nspname, c.relname)
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'm' AND c.relispopulated AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY c.oid`},
+		{"Triggers", `
+		SELECT pg_get_triggerdef(t.oid) || ';' || CASE t.tgenabled
+			WHEN 'D' THEN format(E'\nALTER TABLE %I.%I DISABLE TRIGGER %I;', n.nspname, c.relname, t.tgname)
+			WHEN 'A' THEN format(E'\nALTER TABLE %I.%I ENABLE ALWAYS TRIGGER %I;', n.nspname, c.relname, t.tgname)
+			WHEN 'R' THEN format(E'\nALTER TABLE %I.%I ENABLE REPLICA TRIGGER %I;', n.nspname, c.relname, t.tgname)
+			ELSE '' END
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal` + d.clonedTriggerFilter() + `
+		AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY n.nspname, c.relname, t.tgname`},
+		{"Row level security", `
+		SELECT format('ALTER TABLE %I.%I ENABLE ROW LEVEL SECURITY;', n.nspname, c.relname)
+			|| CASE WHEN c.relforcerowsecurity
+				THEN format(E'\nALTER TABLE %I.%I FORCE ROW LEVEL SECURITY;', n.nspname, c.relname) ELSE '' END
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relrowsecurity AND c.relkind IN ('r', 'p')
+		AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY n.nspname, c.relname`},
+		{"Policies", `
+		SELECT format('CREATE POLICY %I ON %I.%I AS %s FOR %s TO %s%s%s;', p.polname, n.nspname, c.relname,
+			CASE WHEN p.polpermissive THEN 'PERMISSIVE' ELSE 'RESTRICTIVE' END,
+			CASE p.polcmd WHEN 'r' THEN 'SELECT' WHEN 'a' THEN 'INSERT' WHEN 'w' THEN 'UPDATE'
+				WHEN 'd' THEN 'DELETE' ELSE 'ALL' END,
+			(SELECT string_agg(CASE WHEN r = 0 THEN 'PUBLIC' ELSE quote_ident(pg_get_userbyid(r)) END, ', ')
+			 FROM unnest(p.polroles) r),
+			CASE WHEN p.polqual IS NOT NULL THEN ' USING (' || pg_get_expr(p.polqual, p.polrelid) || ')' ELSE '' END,
+			CASE WHEN p.polwithcheck IS NOT NULL THEN ' WITH CHECK (' || pg_get_expr(p.polwithcheck, p.polrelid) || ')' ELSE '' END)
+		FROM pg_policy p
+		JOIN pg_class c ON c.oid = p.polrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		ORDER BY n.nspname, c.relname, p.polname`},
+		{"Schema privileges", aclQuery("'SCHEMA'", "quote_ident(n.nspname)", "n.nspacl",
+			"pg_namespace n", userSchemas+" AND "+notExtensionMember("pg_namespace", "n.oid"))},
+		{"Table, view and sequence privileges", aclQuery(
+			"CASE WHEN c.relkind = 'S' THEN 'SEQUENCE' ELSE 'TABLE' END",
+			"format('%I.%I', n.nspname, c.relname)", "c.relacl",
+			"pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace",
+			"c.relkind IN ('r', 'p', 'v', 'm', 'S') AND "+userSchemas+" AND "+notExtensionMember("pg_class", "c.oid"))},
+		{"Function privileges", aclQuery("'ROUTINE'", "p.oid::regprocedure::text", "p.proacl",
+			"pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace",
+			"p.prokind IN ('f', 'p') AND "+userSchemas+" AND "+notExtensionMember("pg_proc", "p.oid"))},
+		{"Comments", `
+		SELECT format('COMMENT ON %s %s IS %L;', CASE
+			WHEN o.type LIKE '% column' THEN 'COLUMN'
+			WHEN o.type = 'table constraint' THEN 'CONSTRAINT'
+			ELSE upper(o.type) END, o.identity, d.description)
+		FROM pg_description d CROSS JOIN LATERAL pg_identify_object(d.classoid, d.objoid, d.objsubid) o
+		WHERE o.type IN ('schema', 'table', 'table column', 'view', 'view column', 'materialized view',
+			'materialized view column', 'sequence', 'index', 'function', 'procedure', 'type', 'domain',
+			'composite type column', 'trigger', 'policy', 'table constraint')
+		AND COALESCE(o.schema, o.identity) NOT IN ('pg_catalog', 'information_schema')
+		AND COALESCE(o.schema, o.identity) !~ '^pg_toast' AND COALESCE(o.schema, o.identity) !~ '^pg_temp_'
+		AND NOT EXISTS (SELECT 1 FROM pg_depend e
+			WHERE e.classid = d.classoid AND e.objid = d.objoid AND e.deptype = 'e')
+		ORDER BY o.type, o.identity`},
+	}
+	for _, step := range steps {
+		if err := d.emit(tx, step.section, step.query); err != nil {
+			return err
+		}
+	}
+	d.warnSkipped(tx, name)
+	return nil
+}
+
+// clonedTriggerFilter leaves out the triggers partitions inherit from their
+// parent, PostgreSQL 13 marks them with tgparentid instead of tgisinternal.
+func (d *pgDumper) clonedTriggerFilter() string {
+	if d.version >= 130000 {
+		return " AND t.tgparentid = 0"
+	}
+	return ""
+}
+
+// skippedObjects counts the objects of a database the native engine does
+// not dump.
+var skippedObjects = `
+	SELECT x.kind, x.count FROM (VALUES
+		('aggregates', (SELECT count(*) FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE p.prokind = 'a' AND ` + userSchemas + ` AND ` + notExtensionMember("pg_proc", "p.oid") + `)),
+		('rules', (SELECT count(*) FROM pg_rewrite r JOIN pg_class c ON c.oid = r.ev_class
+			JOIN pg_namespace n ON n.oid = c.relnamespace WHERE r.rulename <> '_RETURN' AND ` + userSchemas + `)),
+		('event triggers', (SELECT count(*) FROM pg_event_trigger x
+			WHERE ` + notExtensionMember("pg_event_trigger", "x.oid") + `)),
+		('foreign tables', (SELECT count(*) FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE c.relkind = 'f' AND ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `)),
+		('base types', (SELECT count(*) FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+			WHERE t.typtype = 'b' AND t.typcategory <> 'A' AND ` + userSchemas + ` AND ` + notExtensionMember("pg_type", "t.oid") + `)),
+		('operators', (SELECT count(*) FROM pg_operator o JOIN pg_namespace n ON n.oid = o.oprnamespace
+			WHERE ` + userSchemas + ` AND ` + notExtensionMember("pg_operator", "o.oid") + `)),
+		('casts', (SELECT count(*) FROM pg_cast c WHERE c.oid >= 16384 AND ` + notExtensionMember("pg_cast", "c.oid") + `)),
+		('collations', (SELECT count(*) FROM pg_collation co JOIN pg_namespace n ON n.oid = co.collnamespace
+			WHERE ` + userSchemas + ` AND ` + notExtensionMember("pg_collation", "co.oid") + `)),
+		('text search configurations', (SELECT count(*) FROM pg_ts_config c JOIN pg_namespace n ON n.oid = c.cfgnamespace
+			WHERE ` + userSchemas + ` AND ` + notExtensionMember("pg_ts_config", "c.oid") + `)),
+		('extended statistics', (SELECT count(*) FROM pg_statistic_ext s JOIN pg_namespace n ON n.oid = s.stxnamespace
+			WHERE ` + userSchemas + `)),
+		('publications', (SELECT count(*) FROM pg_publication)),
+		('large objects', (SELECT count(*) FROM pg_largeobject_metadata))
+	) x(kind, count) WHERE x.count > 0`
+
+// warnSkipped warns about the objects of database name that are not in the
+// dump, in the output and in the dump itself.
+func (d *pgDumper) warnSkipped(tx pgx.Tx, name string) {
+	rows, err := tx.Query(d.ctx, skippedObjects)
+	if err != nil {
+		fmt.Printf("[WARN] %s: could not check for objects the native engine does not dump: %v\n", name, err)
+		return
+	}
+	var skipped []string
+	for rows.Next() {
+		var kind string
+		var count int64
+		if err := rows.Scan(&kind, &count); err != nil {
+			break
+		}
+		skipped = append(skipped, fmt.Sprintf("%d %s", count, kind))
+	}
+	rows.Close()
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Printf("[WARN] %s: not dumped by the native engine, use pg_dump to keep them: %s\n", name, strings.Join(skipped, ", "))
+	d.printf("-- Not dumped: %s\n\n", strings.Join(skipped, ", "))
+}
+
+// queryTables returns the CREATE TABLE statement of every table, partitioned
+// parents before their partitions. Defaults and constraints are added later.
+func (d *pgDumper) queryTables(tx pgx.Tx) ([]dumpTable, error) {
+	query := `
+	WITH RECURSIVE levels(oid, level) AS (
+		SELECT c.oid, 0 FROM pg_class c WHERE c.relkind IN ('r', 'p') AND NOT c.relispartition
+		UNION ALL
+		SELECT i.inhrelid, l.level + 1 FROM levels l
+		JOIN pg_inherits i ON i.inhparent = l.oid
+		JOIN pg_class c ON c.oid = i.inhrelid AND c.relispartition
+	)
+	SELECT format('%I.%I', n.nspname, c.relname), c.relkind::text,
+		CASE WHEN c.relispartition THEN
+			format('CREATE TABLE %I.%I PARTITION OF %s %s', n.nspname, c.relname,
+				(SELECT i.inhparent::regclass::text FROM pg_inherits i WHERE i.inhrelid = c.oid),
+				pg_get_expr(c.relpartbound, c.oid))
+		ELSE
+			format(E'CREATE %sTABLE %I.%I (%s\n)', CASE WHEN c.relpersistence = 'u' THEN 'UNLOGGED ' ELSE '' END,
+				n.nspname, c.relname,
+				COALESCE((SELECT string_agg(format(E'\n    %I %s%s%s%s%s', a.attname, format_type(a.atttypid, a.atttypmod),
+					CASE WHEN a.attcollation <> 0 AND a.attcollation <> t.typcollation THEN
+						(SELECT format(' COLLATE %I.%I', cn.nspname, co.collname) FROM pg_collation co
+						 JOIN pg_namespace cn ON cn.oid = co.collnamespace WHERE co.oid = a.attcollation)
+					ELSE '' END,
+					CASE a.attidentity WHEN 'a' THEN ' GENERATED ALWAYS AS IDENTITY'
+						WHEN 'd' THEN ' GENERATED BY DEFAULT AS IDENTITY' ELSE '' END,
+					CASE WHEN a.attgenerated = 's' THEN ' GENERATED ALWAYS AS (' || pg_get_expr(ad.adbin, ad.adrelid) || ') STORED' ELSE '' END,
+					CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END), ',' ORDER BY a.attnum)
+				FROM pg_attribute a
+				JOIN pg_type t ON t.oid = a.atttypid
+				LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+				WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped), ''))
+		END
+		|| CASE WHEN c.relkind = 'p' THEN ' PARTITION BY ' || pg_get_partkeydef(c.oid) ELSE '' END
+		|| E';\n' || format('ALTER TABLE %I.%I OWNER TO %I;', n.nspname, c.relname, pg_get_userbyid(c.relowner)),
+		COALESCE((SELECT string_agg(quote_ident(a.attname), ', ' ORDER BY a.attnum) FROM pg_attribute a
+			WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''), '')
+	FROM levels l
+	JOIN pg_class c ON c.oid = l.oid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE ` + userSchemas + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY l.level, n.nspname, c.relname`
+
+	rows, err := tx.Query(d.ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("Tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []dumpTable
+	for rows.Next() {
+		var t dumpTable
+		if err := rows.Scan(&t.name, &t.kind, &t.create, &t.columns); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// dumpTableData streams every table with COPY TO STDOUT into a COPY FROM
+// stdin block.
+func (d *pgDumper) dumpTableData(tx pgx.Tx, tables []dumpTable) error {
+	for _, t := range tables {
+		// partitioned parents hold no rows, the partitions are copied
+		if t.kind == "p" || t.columns == "" {
+			continue
+		}
+		d.printf("--\n-- Data for %s\n--\n\n", t.name)
+		d.printf("COPY %s (%s) FROM stdin;\n", t.name, t.columns)
+		copySQL := fmt.Sprintf("COPY %s (%s) TO STDOUT", t.name, t.columns)
+		if _, err := tx.Conn().PgConn().CopyTo(d.ctx, d.w, copySQL); err != nil {
+			return fmt.Errorf("copying %s: %w", t.name, err)
+		}
+		d.printf("\\.\n\n")
+	}
+	return nil
+}
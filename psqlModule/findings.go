@@ -0,0 +1,160 @@
+package psqlModule
+
+import (
+	"fmt"
+	"strings"
+
+	"ccdc-cli/utils"
+)
+
+// collectFindings turns the inventory into findings, most severe first.
+func (r *InventoryReport) collectFindings() []utils.Finding {
+	target := fmt.Sprintf("%s:%d", r.Host, r.Port)
+	var findings []utils.Finding
+
+	for _, role := range r.Roles {
+		if role.Superuser && role.Name != "postgres" {
+			findings = append(findings, utils.Finding{
+				ID:          "PG-ROLE-SUPERUSER",
+				Severity:    utils.SeverityHigh,
+				Target:      role.Name,
+				Title:       "role other than postgres has SUPERUSER",
+				Remediation: "ALTER ROLE " + quoteIdent(role.Name) + " NOSUPERUSER",
+			})
+		}
+		if role.CanLogin && role.NoPassword {
+			findings = append(findings, utils.Finding{
+				ID:          "PG-ROLE-NOPASS",
+				Severity:    utils.SeverityMedium,
+				Target:      role.Name,
+				Title:       "login role has no password and relies on pg_hba.conf alone",
+				Remediation: "set a password with psql rotate or ALTER ROLE " + quoteIdent(role.Name) + " NOLOGIN",
+			})
+		}
+	}
+
+	for _, m := range r.ServerRoleMembers {
+		findings = append(findings, utils.Finding{
+			ID:          "PG-SERVER-ROLE",
+			Severity:    utils.SeverityHigh,
+			Target:      m.Member,
+			Title:       "member of " + m.Role + " can reach the server's files or programs",
+			Remediation: fmt.Sprintf("REVOKE %s FROM %s", m.Role, quoteIdent(m.Member)),
+		})
+	}
+
+	for _, p := range r.Persistence {
+		for _, t := range p.EventTriggers {
+			findings = append(findings, utils.Finding{
+				ID:          "PG-PERSIST-EVENT-TRIGGER",
+				Severity:    utils.SeverityHigh,
+				Target:      p.Database + "." + t.Name,
+				Title:       fmt.Sprintf("event trigger runs %s on %s", t.Function, t.Event),
+				Evidence:    "owner " + t.Owner,
+				Remediation: "DROP EVENT TRIGGER " + quoteIdent(t.Name) + " if it is not part of the application",
+			})
+		}
+		for _, t := range p.Triggers {
+			if len(t.Flags) == 0 {
+				continue
+			}
+			findings = append(findings, utils.Finding{
+				ID:          "PG-PERSIST-TRIGGER",
+				Severity:    utils.SeverityHigh,
+				Target:      fmt.Sprintf("%s.%s.%s", p.Database, t.Table, t.Name),
+				Title:       "trigger " + strings.Join(t.Flags, ", "),
+				Evidence:    t.Definition,
+				Remediation: "review " + t.Function + " and drop the trigger if it is not part of the application",
+			})
+		}
+		for _, f := range p.UntrustedFunctions {
+			severity := utils.SeverityMedium
+			title := "function in untrusted language " + f.Language
+			if len(f.Flags) > 0 {
+				severity = utils.SeverityHigh
+				title += " " + strings.Join(f.Flags, ", ")
+			}
+			findings = append(findings, utils.Finding{
+				ID:          "PG-PERSIST-FUNCTION",
+				Severity:    severity,
+				Target:      fmt.Sprintf("%s.%s.%s", p.Database, f.Schema, f.Name),
+				Title:       title,
+				Evidence:    f.Body,
+				Remediation: "review the function and drop it if it is not part of the application",
+			})
+		}
+		for _, e := range p.Extensions {
+			if !e.Risky {
+				continue
+			}
+			findings = append(findings, utils.Finding{
+				ID:          "PG-PERSIST-EXTENSION",
+				Severity:    utils.SeverityMedium,
+				Target:      p.Database + "." + e.Name,
+				Title:       "extension gives access to files, programs or other servers",
+				Remediation: "DROP EXTENSION " + quoteIdent(e.Name) + " if it is not needed",
+			})
+		}
+	}
+
+	if r.HBA != nil {
+		for _, rule := range r.HBA.Rules {
+			if rule.Error != "" {
+				findings = append(findings, utils.Finding{
+					ID:          "PG-HBA-ERROR",
+					Severity:    utils.SeverityMedium,
+					Target:      fmt.Sprintf("%s:%d", r.HBA.File, rule.Line),
+					Title:       "pg_hba.conf line could not be audited",
+					Evidence:    rule.Error,
+					Remediation: "fix or review the line by hand, a pg_hba.conf with errors can't be reloaded",
+				})
+			}
+			for _, flag := range rule.Flags {
+				severity := utils.SeverityMedium
+				if rule.Method == "trust" && rule.Type != "local" {
+					severity = utils.SeverityCritical
+				} else if rule.Method == "trust" || rule.Method == "password" {
+					severity = utils.SeverityHigh
+				}
+				findings = append(findings, utils.Finding{
+					ID:       "PG-HBA-RULE",
+					Severity: severity,
+					Target:   fmt.Sprintf("%s:%d", r.HBA.File, rule.Line),
+					Title:    flag,
+					Evidence: fmt.Sprintf("%s %s %s %s %s", rule.Type, strings.Join(rule.Databases, ","),
+						strings.Join(rule.Users, ","), rule.Address, rule.Method),
+					Remediation: "edit pg_hba.conf and reload with SELECT pg_reload_conf()",
+				})
+			}
+		}
+		for _, m := range r.HBA.Ident {
+			for _, flag := range m.Flags {
+				findings = append(findings, utils.Finding{
+					ID:          "PG-IDENT-MAP",
+					Severity:    utils.SeverityMedium,
+					Target:      fmt.Sprintf("%s:%d", r.HBA.IdentFile, m.Line),
+					Title:       flag,
+					Evidence:    fmt.Sprintf("%s %s %s", m.Map, m.SystemUser, m.DBUser),
+					Remediation: "map system users to specific roles in pg_ident.conf",
+				})
+			}
+		}
+	}
+
+	for _, s := range r.Settings {
+		if s.Passed {
+			continue
+		}
+		findings = append(findings, utils.Finding{
+			ID:          "PG-SETTING-" + strings.ToUpper(strings.ReplaceAll(s.Name, "_", "-")),
+			Severity:    s.Severity,
+			Target:      target,
+			Title:       s.Note,
+			Evidence:    fmt.Sprintf("%s = %s (%s)", s.Name, s.Value, s.Source),
+			Remediation: fmt.Sprintf("ALTER SYSTEM RESET %s or fix it in postgresql.conf, then reload", s.Name),
+		})
+	}
+
+	utils.SortFindings(findings)
+	return findings
+}
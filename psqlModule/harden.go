@@ -0,0 +1,215 @@
+package psqlModule
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dryRun         bool
+	assumeYes      bool
+	changeLog      string
+	keepSuperusers []string
+)
+
+func getHardenCmd() *cobra.Command {
+	hardenCmd := &cobra.Command{
+		Use:   "harden",
+		Short: "Apply common PostgreSQL hardening steps.",
+		Long: `Apply common PostgreSQL hardening steps:
+- Revoke CREATE on the public schema from PUBLIC in every database
+- Revoke CONNECT on every database from PUBLIC
+- Remove SUPERUSER from every role not in --keep-superuser
+- Set password_encryption to scram-sha-256
+- Disable login for roles without a password
+
+Each step asks for confirmation unless --yes is given. Use --dry-run to only
+print the SQL that would be run.`,
+		RunE:         runHarden,
+		SilenceUsage: true,
+	}
+	hardenCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the SQL without running it")
+	hardenCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Apply every step without asking")
+	hardenCmd.Flags().StringVar(&changeLog, "log", "ccdc-changes.log", "File to record applied changes in")
+	hardenCmd.Flags().StringSliceVar(&keepSuperusers, "keep-superuser", []string{"postgres"}, "Roles allowed to keep SUPERUSER")
+	return hardenCmd
+}
+
+func runHarden(cmd *cobra.Command, args []string) error {
+	password, err := utils.GetPassword()
+	if err != nil {
+		return fmt.Errorf("failed to read password")
+	}
+
+	db, err := connectToDatabase(username, password, host, port)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	runner := &utils.ActionRunner{
+		DryRun:    dryRun,
+		AssumeYes: assumeYes,
+		Log:       utils.NewChangeLog(changeLog, fmt.Sprintf("psql %s:%d", host, port)),
+		Exec:      poolExec(db),
+	}
+
+	utils.PrintHeader("POSTGRESQL HARDENING")
+
+	databases, err := listDatabases(db)
+	if err != nil {
+		return fmt.Errorf("could not list databases: %v", err)
+	}
+	for _, dbName := range databases {
+		db2, err := connectToDatabaseDB(username, password, host, port, dbName, false)
+		if err != nil {
+			fmt.Printf("\n[!] Unable to connect to %s: %v\n", dbName, err)
+			continue
+		}
+		action, err := revokePublicSchemaCreate(db2, dbName)
+		runAction(runner, action, err)
+		db2.Close()
+	}
+
+	steps := []func(*pgxpool.Pool) (utils.Action, error){
+		revokePublicConnect,
+		removeSuperusers,
+		enforceScram,
+		disablePasswordlessLogin,
+	}
+	for _, step := range steps {
+		action, err := step(db)
+		runAction(runner, action, err)
+	}
+
+	runner.PrintSummary()
+	return nil
+}
+
+func runAction(runner *utils.ActionRunner, action utils.Action, err error) {
+	if err != nil {
+		fmt.Printf("\n[!] %s: %v\n", action.Description, err)
+		return
+	}
+	if len(action.Statements) == 0 {
+		fmt.Printf("\n[-] %s: nothing to do\n", action.Description)
+		return
+	}
+	runner.Run(action)
+}
+
+func poolExec(db *pgxpool.Pool) func(string) error {
+	return func(stmt string) error {
+		_, err := db.Exec(context.Background(), stmt)
+		return err
+	}
+}
+
+// quoteIdent returns name as a double quoted PostgreSQL identifier.
+func quoteIdent(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// queryNames returns the first column of every row matched by query.
+func queryNames(db *pgxpool.Pool, query string) ([]string, error) {
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func revokePublicSchemaCreate(db *pgxpool.Pool, dbName string) (utils.Action, error) {
+	action := utils.Action{
+		Description: fmt.Sprintf("Revoke CREATE on schema public from PUBLIC in %s", dbName),
+		// The statement only affects the database it is run in, so it has
+		// to go through this database's connection
+		Exec: poolExec(db),
+	}
+
+	query := `
+	SELECT COUNT(*) FROM pg_namespace
+	WHERE nspname = 'public' AND has_schema_privilege('public', oid, 'CREATE');`
+
+	var count int
+	if err := db.QueryRow(context.Background(), query).Scan(&count); err != nil {
+		return action, err
+	}
+	if count > 0 {
+		action.Statements = append(action.Statements, "REVOKE CREATE ON SCHEMA public FROM PUBLIC;")
+	}
+	return action, nil
+}
+
+func revokePublicConnect(db *pgxpool.Pool) (utils.Action, error) {
+	action := utils.Action{Description: "Revoke CONNECT on every database from PUBLIC (grant CONNECT to application roles afterwards)"}
+
+	names, err := queryNames(db, `
+	SELECT datname FROM pg_database
+	WHERE datistemplate = false AND has_database_privilege('public', oid, 'CONNECT');`)
+	if err != nil {
+		return action, err
+	}
+	for _, name := range names {
+		action.Statements = append(action.Statements, fmt.Sprintf("REVOKE CONNECT ON DATABASE %s FROM PUBLIC;", quoteIdent(name)))
+	}
+	return action, nil
+}
+
+func removeSuperusers(db *pgxpool.Pool) (utils.Action, error) {
+	action := utils.Action{Description: "Remove SUPERUSER from roles outside the allowlist"}
+
+	// Never demote the role we are connected as, it would lock us out of
+	// the remaining steps
+	names, err := queryNames(db, `SELECT rolname FROM pg_roles WHERE rolsuper AND rolname <> current_user ORDER BY rolname;`)
+	if err != nil {
+		return action, err
+	}
+	for _, name := range names {
+		if slices.Contains(keepSuperusers, name) {
+			continue
+		}
+		action.Statements = append(action.Statements, fmt.Sprintf("ALTER ROLE %s NOSUPERUSER;", quoteIdent(name)))
+	}
+	return action, nil
+}
+
+func enforceScram(db *pgxpool.Pool) (utils.Action, error) {
+	action := utils.Action{Description: "Set password_encryption to scram-sha-256 (existing md5 passwords need to be reset)"}
+
+	var value string
+	if err := db.QueryRow(context.Background(), "SHOW password_encryption;").Scan(&value); err != nil {
+		return action, err
+	}
+	if value != "scram-sha-256" {
+		action.Statements = append(action.Statements,
+			"ALTER SYSTEM SET password_encryption = 'scram-sha-256';",
+			"SELECT pg_reload_conf();")
+	}
+	return action, nil
+}
+
+func disablePasswordlessLogin(db *pgxpool.Pool) (utils.Action, error) {
+	action := utils.Action{Description: "Disable login for roles without a password"}
+
+	// pg_roles masks every password as ********, only pg_authid tells
+	// whether one is set
+	names, err := queryNames(db, `
+	SELECT rolname FROM pg_authid
+	WHERE rolcanlogin AND rolpassword IS NULL AND rolname <> current_user
+	ORDER BY rolname;`)
+	if err != nil {
+		return action, fmt.Errorf("could not read pg_authid to find roles without a password (superuser required): %v", err)
+	}
+	for _, name := range names {
+		action.Statements = append(action.Statements, fmt.Sprintf("ALTER ROLE %s NOLOGIN;", quoteIdent(name)))
+	}
+	return action, nil
+}
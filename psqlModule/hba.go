@@ -0,0 +1,432 @@
+package psqlModule
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HBAAudit is the parsed pg_hba.conf and pg_ident.conf of the server.
+type HBAAudit struct {
+	File      string         `json:"file" yaml:"file"`
+	Source    string         `json:"source" yaml:"source"`
+	Rules     []HBARule      `json:"rules" yaml:"rules"`
+	IdentFile string         `json:"ident_file" yaml:"ident_file"`
+	Ident     []IdentMapping `json:"ident" yaml:"ident"`
+	Error     string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type HBARule struct {
+	Line      int      `json:"line" yaml:"line"`
+	Type      string   `json:"type" yaml:"type"`
+	Databases []string `json:"databases" yaml:"databases"`
+	Users     []string `json:"users" yaml:"users"`
+	Address   string   `json:"address,omitempty" yaml:"address,omitempty"`
+	Method    string   `json:"method" yaml:"method"`
+	Options   []string `json:"options,omitempty" yaml:"options,omitempty"`
+	Error     string   `json:"error,omitempty" yaml:"error,omitempty"`
+	Flags     []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+}
+
+type IdentMapping struct {
+	Line       int      `json:"line" yaml:"line"`
+	Map        string   `json:"map" yaml:"map"`
+	SystemUser string   `json:"system_user" yaml:"system_user"`
+	DBUser     string   `json:"db_user" yaml:"db_user"`
+	Flags      []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+}
+
+// methodStrength orders authentication methods from weakest to strongest so
+// shadowed rules can be detected.
+var methodStrength = map[string]int{
+	"trust":         0,
+	"password":      1,
+	"md5":           2,
+	"ident":         2,
+	"peer":          3,
+	"scram-sha-256": 3,
+	"gss":           3,
+	"sspi":          3,
+	"ldap":          3,
+	"radius":        3,
+	"pam":           3,
+	"bsd":           3,
+	"cert":          4,
+	"reject":        5,
+}
+
+func hbaAudit(db *pgxpool.Pool, report *InventoryReport) {
+	audit := &HBAAudit{File: hbaFile, IdentFile: identFile}
+	report.HBA = audit
+	ctx := context.Background()
+
+	if audit.File == "" {
+		db.QueryRow(ctx, "SELECT setting FROM pg_settings WHERE name = 'hba_file';").Scan(&audit.File)
+	}
+	if audit.IdentFile == "" {
+		db.QueryRow(ctx, "SELECT setting FROM pg_settings WHERE name = 'ident_file';").Scan(&audit.IdentFile)
+	}
+
+	var err error
+	if hbaFile == "" {
+		audit.Source = "pg_hba_file_rules"
+		audit.Rules, err = queryHBARules(db)
+	}
+	// Older servers and roles without access to the view fall back to
+	// reading the file, which works when we run on the database host
+	if hbaFile != "" || err != nil {
+		audit.Source = "file"
+		audit.Rules, err = parseHBAFile(audit.File)
+	}
+	if err != nil {
+		audit.Error = fmt.Sprintf("could not read hba rules: %v", err)
+	}
+	flagHBARules(audit.Rules)
+
+	if identFile == "" {
+		audit.Ident, err = queryIdentMappings(db)
+	}
+	if identFile != "" || err != nil {
+		audit.Ident, err = parseIdentFile(audit.IdentFile)
+	}
+	if err == nil {
+		flagIdentMappings(audit.Ident)
+	}
+}
+
+// queryHBARules reads the rules from pg_hba_file_rules. Lines the server
+// could not parse have only their error set and are kept, they become
+// findings.
+func queryHBARules(db *pgxpool.Pool) ([]HBARule, error) {
+	query := `
+	SELECT line_number, COALESCE(type, ''), COALESCE(database, '{}'), COALESCE(user_name, '{}'),
+	COALESCE(address, ''), COALESCE(netmask, ''), COALESCE(auth_method, ''),
+	COALESCE(options, '{}'), COALESCE(error, '')
+	FROM pg_hba_file_rules ORDER BY line_number;`
+
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []HBARule
+	for rows.Next() {
+		var r HBARule
+		var netmask string
+		if err := rows.Scan(&r.Line, &r.Type, &r.Databases, &r.Users, &r.Address, &netmask, &r.Method, &r.Options, &r.Error); err != nil {
+			return nil, err
+		}
+		r.Address = joinNetmask(r.Address, netmask)
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// joinNetmask converts an address and netmask pair into CIDR notation.
+func joinNetmask(address, netmask string) string {
+	if netmask == "" {
+		return address
+	}
+	addr, err := netip.ParseAddr(address)
+	mask, merr := netip.ParseAddr(netmask)
+	if err != nil || merr != nil {
+		return address
+	}
+	bits := 0
+	for _, b := range mask.AsSlice() {
+		for ; b&0x80 != 0; b <<= 1 {
+			bits++
+		}
+	}
+	return netip.PrefixFrom(addr, bits).String()
+}
+
+// splitConfigFields splits a pg_hba.conf/pg_ident.conf line into fields,
+// honouring double quotes and dropping comments.
+func splitConfigFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	inQuotes, hasField := false, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case c == '#' && !inQuotes:
+			if hasField {
+				fields = append(fields, field.String())
+			}
+			return fields
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if hasField {
+				fields = append(fields, field.String())
+				field.Reset()
+				hasField = false
+			}
+		default:
+			field.WriteRune(c)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// readConfigLines returns the non-empty logical lines of a config file with
+// their line numbers, joining lines that end in a backslash.
+func readConfigLines(path string) ([]int, [][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var numbers []int
+	var lines [][]string
+	scanner := bufio.NewScanner(f)
+	lineNo, start := 0, 0
+	var pending string
+	for scanner.Scan() {
+		lineNo++
+		text := scanner.Text()
+		if pending == "" {
+			start = lineNo
+		}
+		if strings.HasSuffix(text, `\`) {
+			pending += strings.TrimSuffix(text, `\`) + " "
+			continue
+		}
+		text = pending + text
+		pending = ""
+		if fields := splitConfigFields(text); len(fields) > 0 {
+			numbers = append(numbers, start)
+			lines = append(lines, fields)
+		}
+	}
+	return numbers, lines, scanner.Err()
+}
+
+func parseHBAFile(path string) ([]HBARule, error) {
+	numbers, lines, err := readConfigLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []HBARule
+	for i, fields := range lines {
+		r := HBARule{Line: numbers[i], Type: fields[0]}
+		if strings.HasPrefix(r.Type, "include") {
+			r.Error = "include directives are not followed: " + strings.Join(fields, " ")
+			rules = append(rules, r)
+			continue
+		}
+
+		rest := fields[1:]
+		minFields := 3
+		if r.Type != "local" {
+			minFields = 4
+		}
+		if len(rest) < minFields {
+			r.Error = "malformed rule: " + strings.Join(fields, " ")
+			rules = append(rules, r)
+			continue
+		}
+
+		r.Databases = strings.Split(rest[0], ",")
+		r.Users = strings.Split(rest[1], ",")
+		rest = rest[2:]
+		if r.Type != "local" {
+			r.Address = rest[0]
+			rest = rest[1:]
+			// An IP address may be followed by a separate netmask field
+			if _, err := netip.ParseAddr(r.Address); err == nil && len(rest) > 1 {
+				if _, err := netip.ParseAddr(rest[0]); err == nil {
+					r.Address = joinNetmask(r.Address, rest[0])
+					rest = rest[1:]
+				}
+			}
+		}
+		r.Method = rest[0]
+		r.Options = rest[1:]
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func queryIdentMappings(db *pgxpool.Pool) ([]IdentMapping, error) {
+	query := `
+	SELECT line_number, COALESCE(map_name, ''), COALESCE(sys_name, ''), COALESCE(pg_username, '')
+	FROM pg_ident_file_mappings WHERE error IS NULL ORDER BY line_number;`
+
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []IdentMapping
+	for rows.Next() {
+		var m IdentMapping
+		if err := rows.Scan(&m.Line, &m.Map, &m.SystemUser, &m.DBUser); err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
+
+func parseIdentFile(path string) ([]IdentMapping, error) {
+	numbers, lines, err := readConfigLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []IdentMapping
+	for i, fields := range lines {
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "include") {
+			continue
+		}
+		mappings = append(mappings, IdentMapping{Line: numbers[i], Map: fields[0], SystemUser: fields[1], DBUser: fields[2]})
+	}
+	return mappings, nil
+}
+
+func isOpenAddress(address string) bool {
+	switch address {
+	case "all", "0.0.0.0/0", "::/0", "::0/0":
+		return true
+	}
+	return false
+}
+
+func flagHBARules(rules []HBARule) {
+	for i := range rules {
+		r := &rules[i]
+		if r.Error != "" {
+			continue
+		}
+		switch r.Method {
+		case "trust":
+			r.Flags = append(r.Flags, "trust allows login without any password")
+		case "password":
+			r.Flags = append(r.Flags, "password sends passwords in cleartext")
+		}
+		if isOpenAddress(r.Address) {
+			r.Flags = append(r.Flags, "open to every client address")
+		}
+		if slices.Contains(r.Databases, "all") && slices.Contains(r.Users, "all") && r.Method != "reject" {
+			r.Flags = append(r.Flags, "matches all databases and all users")
+		}
+	}
+
+	// A rule shadows every later rule it fully covers, since the first match
+	// wins. This is only a problem when the later rule is stricter
+	for i := range rules {
+		for j := i + 1; j < len(rules); j++ {
+			a, b := &rules[i], &rules[j]
+			if a.Error != "" || b.Error != "" || !hbaRuleCovers(*a, *b) {
+				continue
+			}
+			if methodStrength[a.Method] < methodStrength[b.Method] {
+				a.Flags = append(a.Flags, fmt.Sprintf("shadows stricter %s rule on line %d", b.Method, b.Line))
+			} else {
+				b.Flags = append(b.Flags, fmt.Sprintf("never matches, shadowed by line %d", a.Line))
+			}
+		}
+	}
+}
+
+// hbaRuleCovers reports whether every connection matched by b is matched by a.
+func hbaRuleCovers(a, b HBARule) bool {
+	switch {
+	case a.Type == b.Type:
+	case a.Type == "host" && strings.HasPrefix(b.Type, "host"):
+	default:
+		return false
+	}
+
+	// "all" does not match replication connections
+	coversList := func(outer, inner []string) bool {
+		if slices.Contains(outer, "all") && !slices.Contains(inner, "replication") {
+			return true
+		}
+		for _, v := range inner {
+			if !slices.Contains(outer, v) {
+				return false
+			}
+		}
+		return true
+	}
+	if !coversList(a.Databases, b.Databases) || !coversList(a.Users, b.Users) {
+		return false
+	}
+
+	if a.Type == "local" || a.Address == "all" || a.Address == b.Address {
+		return true
+	}
+	outer, err := netip.ParsePrefix(a.Address)
+	if err != nil {
+		return false
+	}
+	inner, err := netip.ParsePrefix(b.Address)
+	if err != nil {
+		return false
+	}
+	return outer.Bits() <= inner.Bits() && outer.Contains(inner.Addr())
+}
+
+func flagIdentMappings(mappings []IdentMapping) {
+	for i := range mappings {
+		m := &mappings[i]
+		if m.DBUser == "all" {
+			m.Flags = append(m.Flags, "maps onto every database role")
+		}
+		if strings.HasPrefix(m.SystemUser, "/") && !strings.Contains(m.DBUser, `\1`) {
+			m.Flags = append(m.Flags, fmt.Sprintf("regular expression maps many system users onto %s", m.DBUser))
+		}
+	}
+}
+
+func printHBAText(r *InventoryReport) {
+	utils.PrintHeader("PG_HBA.CONF AUDIT")
+	audit := r.HBA
+	if audit == nil {
+		return
+	}
+	fmt.Printf("  File: %s (read from %s)\n", audit.File, audit.Source)
+	if audit.Error != "" {
+		fmt.Println(audit.Error)
+	}
+	for _, rule := range audit.Rules {
+		if rule.Error != "" {
+			fmt.Printf("  [?] Line %-4d | %s\n", rule.Line, rule.Error)
+			continue
+		}
+		fmt.Printf("  %s Line %-4d | %-9s | %-15s | %-15s | %-18s | %s\n", marker(rule.Flags), rule.Line, rule.Type,
+			strings.Join(rule.Databases, ","), strings.Join(rule.Users, ","), rule.Address, rule.Method)
+		for _, flag := range rule.Flags {
+			fmt.Printf("        |-- [!] %s\n", flag)
+		}
+	}
+
+	if len(audit.Ident) > 0 {
+		fmt.Printf("\n  Ident File: %s\n", audit.IdentFile)
+		for _, m := range audit.Ident {
+			fmt.Printf("  %s Line %-4d | %-15s | %-25s -> %s\n", marker(m.Flags), m.Line, m.Map, m.SystemUser, m.DBUser)
+			for _, flag := range m.Flags {
+				fmt.Printf("        |-- [!] %s\n", flag)
+			}
+		}
+	}
+}
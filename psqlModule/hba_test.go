@@ -0,0 +1,121 @@
+package psqlModule
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestHBARuleCovers(t *testing.T) {
+	rule := func(typ, db, user, addr string) HBARule {
+		return HBARule{Type: typ, Databases: []string{db}, Users: []string{user}, Address: addr}
+	}
+	tests := []struct {
+		name string
+		a, b HBARule
+		want bool
+	}{
+		{"open host covers hostssl", rule("host", "all", "all", "0.0.0.0/0"), rule("hostssl", "app", "bob", "10.0.0.0/8"), true},
+		{"hostssl does not cover host", rule("hostssl", "all", "all", "0.0.0.0/0"), rule("host", "app", "bob", "10.0.0.0/8"), false},
+		{"local does not cover host", rule("local", "all", "all", ""), rule("host", "app", "bob", "10.0.0.0/8"), false},
+		{"local covers local", rule("local", "all", "all", ""), rule("local", "app", "bob", ""), true},
+		{"all does not match replication", rule("host", "all", "all", "all"), rule("host", "replication", "bob", "all"), false},
+		{"named database", rule("host", "app", "all", "all"), rule("host", "other", "bob", "all"), false},
+		{"wider range", rule("host", "all", "all", "10.0.0.0/8"), rule("host", "all", "all", "10.1.2.0/24"), true},
+		{"narrower range", rule("host", "all", "all", "10.1.2.0/24"), rule("host", "all", "all", "10.0.0.0/8"), false},
+		{"disjoint range", rule("host", "all", "all", "10.0.0.0/8"), rule("host", "all", "all", "192.168.0.0/16"), false},
+		{"same keyword", rule("host", "all", "all", "samenet"), rule("host", "all", "all", "samenet"), true},
+		{"hostname", rule("host", "all", "all", "db.example.com"), rule("host", "all", "all", "10.0.0.1/32"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hbaRuleCovers(tt.a, tt.b); got != tt.want {
+				t.Errorf("hbaRuleCovers = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagHBARules(t *testing.T) {
+	rules := []HBARule{
+		{Line: 1, Type: "host", Databases: []string{"all"}, Users: []string{"all"}, Address: "0.0.0.0/0", Method: "trust"},
+		{Line: 2, Type: "host", Databases: []string{"app"}, Users: []string{"bob"}, Address: "10.0.0.0/8", Method: "scram-sha-256"},
+		{Line: 3, Type: "local", Databases: []string{"all"}, Users: []string{"all"}, Method: "peer"},
+		{Line: 4, Type: "local", Databases: []string{"all"}, Users: []string{"all"}, Method: "md5"},
+		{Line: 5, Type: "host", Databases: []string{"app"}, Users: []string{"bob"}, Address: "10.0.0.0/8", Method: "password"},
+		{Line: 6, Error: "malformed rule: host all"},
+	}
+	flagHBARules(rules)
+
+	want := [][]string{
+		{
+			"trust allows login without any password",
+			"open to every client address",
+			"matches all databases and all users",
+			"shadows stricter scram-sha-256 rule on line 2",
+			"shadows stricter password rule on line 5",
+		},
+		nil,
+		{"matches all databases and all users"},
+		{"matches all databases and all users", "never matches, shadowed by line 3"},
+		{"password sends passwords in cleartext", "never matches, shadowed by line 2"},
+		nil,
+	}
+	for i, r := range rules {
+		if !slices.Equal(r.Flags, want[i]) {
+			t.Errorf("line %d flags:\n got %q\nwant %q", r.Line, r.Flags, want[i])
+		}
+	}
+}
+
+func TestSplitConfigFields(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"local   all\tall   peer", []string{"local", "all", "all", "peer"}},
+		{`host "my db" all all md5 # note`, []string{"host", "my db", "all", "all", "md5"}},
+		{`host "#not a comment" x`, []string{"host", "#not a comment", "x"}},
+		{`host "" x`, []string{"host", "", "x"}},
+		{"   # only a comment", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := splitConfigFields(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("splitConfigFields(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseHBAFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pg_hba.conf")
+	conf := `# TYPE  DATABASE  USER  ADDRESS  METHOD
+local   all       all             peer
+
+host    "my db",app  all  192.168.1.0  255.255.255.0  md5   # netmask form
+hostssl all  +admins  10.0.0.0/8 \
+    scram-sha-256 clientcert=verify-full
+host    all
+include_if_exists extra.conf
+`
+	if err := os.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := parseHBAFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []HBARule{
+		{Line: 2, Type: "local", Databases: []string{"all"}, Users: []string{"all"}, Method: "peer", Options: []string{}},
+		{Line: 4, Type: "host", Databases: []string{"my db", "app"}, Users: []string{"all"}, Address: "192.168.1.0/24", Method: "md5", Options: []string{}},
+		{Line: 5, Type: "hostssl", Databases: []string{"all"}, Users: []string{"+admins"}, Address: "10.0.0.0/8", Method: "scram-sha-256", Options: []string{"clientcert=verify-full"}},
+		{Line: 7, Type: "host", Error: "malformed rule: host all"},
+		{Line: 8, Type: "include_if_exists", Error: "include directives are not followed: include_if_exists extra.conf"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("parseHBAFile:\n got %+v\nwant %+v", rules, want)
+	}
+}
@@ -0,0 +1,66 @@
+package psqlModule
+
+import (
+	"context"
+
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func getVerifyCmd() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check a backup against its manifest.",
+		Long: `Every backup is written with a <file>.manifest.json holding its SHA-256,
+size, source server and databases. verify recomputes the checksum and fails if
+the file was modified after the backup was taken.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return utils.RunVerify(file)
+		},
+		SilenceUsage: true,
+	}
+	verifyCmd.Flags().StringVarP(&file, "file", "f", "", "Backup file to verify")
+	verifyCmd.MarkFlagRequired("file")
+	return verifyCmd
+}
+
+// backupManifest describes the server a backup is taken from, and the
+// database when only db was backed up.
+func backupManifest(password, db string) (*utils.Manifest, error) {
+	m := &utils.Manifest{
+		Engine:      "postgres",
+		Host:        host,
+		Port:        port,
+		Compression: compress,
+		Encrypted:   encrypt || recipient != "",
+	}
+	if db != "" {
+		m.Database = db
+		m.Databases = []string{db}
+	}
+
+	pool, err := connectToDatabaseDB(username, password, host, port, "postgres", false)
+	if err != nil {
+		return m, err
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	if err := pool.QueryRow(ctx, "SHOW server_version").Scan(&m.ServerVersion); err != nil || db != "" {
+		return m, err
+	}
+	rows, err := pool.Query(ctx, "SELECT datname FROM pg_database WHERE NOT datistemplate ORDER BY datname")
+	if err != nil {
+		return m, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return m, err
+		}
+		m.Databases = append(m.Databases, name)
+	}
+	return m, rows.Err()
+}
@@ -0,0 +1,304 @@
+package psqlModule
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DatabasePersistence holds the objects in one database that can run code on
+// the server: triggers, functions in untrusted languages and extensions.
+type DatabasePersistence struct {
+	Database           string         `json:"database" yaml:"database"`
+	EventTriggers      []EventTrigger `json:"event_triggers" yaml:"event_triggers"`
+	Triggers           []Trigger      `json:"triggers" yaml:"triggers"`
+	UntrustedFunctions []Function     `json:"untrusted_functions" yaml:"untrusted_functions"`
+	Extensions         []Extension    `json:"extensions" yaml:"extensions"`
+	Error              string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type EventTrigger struct {
+	Name     string `json:"name" yaml:"name"`
+	Event    string `json:"event" yaml:"event"`
+	Function string `json:"function" yaml:"function"`
+	Owner    string `json:"owner" yaml:"owner"`
+	Enabled  string `json:"enabled" yaml:"enabled"`
+}
+
+type Trigger struct {
+	Name       string `json:"name" yaml:"name"`
+	Table      string `json:"table" yaml:"table"`
+	Function   string `json:"function" yaml:"function"`
+	Language   string `json:"language" yaml:"language"`
+	Definition string `json:"definition" yaml:"definition"`
+	// FunctionHash is the utils.Fingerprint of the trigger function's source
+	FunctionHash string   `json:"function_hash" yaml:"function_hash"`
+	Flags        []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+}
+
+type Function struct {
+	Schema          string   `json:"schema" yaml:"schema"`
+	Name            string   `json:"name" yaml:"name"`
+	Language        string   `json:"language" yaml:"language"`
+	Owner           string   `json:"owner" yaml:"owner"`
+	SecurityDefiner bool     `json:"security_definer" yaml:"security_definer"`
+	Body            string   `json:"body" yaml:"body"`
+	Flags           []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+}
+
+type Extension struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	Schema  string `json:"schema" yaml:"schema"`
+	Risky   bool   `json:"risky" yaml:"risky"`
+}
+
+type ServerRoleMember struct {
+	Role   string `json:"role" yaml:"role"`
+	Member string `json:"member" yaml:"member"`
+}
+
+type suspiciousPattern struct {
+	re     *regexp.Regexp
+	reason string
+}
+
+var suspiciousPatterns = []suspiciousPattern{
+	{regexp.MustCompile(`(?i)\bcopy\b[\s\S]*\bprogram\b`), "runs COPY ... PROGRAM"},
+	{regexp.MustCompile(`(?i)\b(os\.system|os\.popen|subprocess|system\s*\(|exec\s*\(|qx\s*[{(/]|popen)`), "shells out"},
+	{regexp.MustCompile(`(?i)\b(pg_read_file|pg_read_binary_file|lo_import|lo_export|pg_ls_dir)\s*\(`), "accesses server files"},
+	{regexp.MustCompile(`(?i)\b(socket|urllib|requests\.|LWP::|IO::Socket)`), "opens network connections"},
+	{regexp.MustCompile(`(?i)\b(create|alter)\s+(role|user)\b|\bgrant\b`), "creates roles or grants privileges"},
+}
+
+func flagBody(body string) []string {
+	var flags []string
+	for _, p := range suspiciousPatterns {
+		if p.re.MatchString(body) {
+			flags = append(flags, p.reason)
+		}
+	}
+	return flags
+}
+
+// riskyExtensions give access to files, programs or other servers.
+var riskyExtensions = map[string]bool{
+	"adminpack":    true,
+	"dblink":       true,
+	"file_fdw":     true,
+	"postgres_fdw": true,
+	"plpython3u":   true,
+	"plpythonu":    true,
+	"plperlu":      true,
+	"pltclu":       true,
+	"lo":           true,
+}
+
+func persistenceInventory(db *pgxpool.Pool, password string, report *InventoryReport) {
+	members, err := serverRoleMembers(db)
+	if err != nil {
+		report.setError(sectionPersistence, fmt.Sprintf("Error reading server role members: %v", err))
+	}
+	report.ServerRoleMembers = members
+
+	databases, err := listDatabases(db)
+	if err != nil {
+		report.setError(sectionPersistence, fmt.Sprintf("Error querying database: %v", err))
+		return
+	}
+
+	for _, dbName := range databases {
+		persistence := DatabasePersistence{Database: dbName}
+
+		db2, err := connectToDatabaseDB(username, password, host, port, dbName, false)
+		if err != nil {
+			persistence.Error = err.Error()
+			report.Persistence = append(report.Persistence, persistence)
+			continue
+		}
+		if err := collectPersistence(db2, &persistence); err != nil {
+			persistence.Error = err.Error()
+		}
+		db2.Close()
+		report.Persistence = append(report.Persistence, persistence)
+	}
+}
+
+func serverRoleMembers(db *pgxpool.Pool) ([]ServerRoleMember, error) {
+	query := `
+	SELECT r.rolname, m.rolname
+	FROM pg_auth_members am
+	JOIN pg_roles r ON r.oid = am.roleid
+	JOIN pg_roles m ON m.oid = am.member
+	WHERE r.rolname IN ('pg_execute_server_program', 'pg_read_server_files', 'pg_write_server_files')
+	ORDER BY r.rolname, m.rolname;`
+
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []ServerRoleMember
+	for rows.Next() {
+		var m ServerRoleMember
+		if err := rows.Scan(&m.Role, &m.Member); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func collectPersistence(db *pgxpool.Pool, p *DatabasePersistence) error {
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, `
+	SELECT evtname, evtevent, evtfoid::regproc::text, pg_get_userbyid(evtowner), evtenabled::text
+	FROM pg_event_trigger ORDER BY evtname;`)
+	if err != nil {
+		return fmt.Errorf("could not read event triggers: %w", err)
+	}
+	for rows.Next() {
+		var t EventTrigger
+		if err := rows.Scan(&t.Name, &t.Event, &t.Function, &t.Owner, &t.Enabled); err != nil {
+			continue
+		}
+		p.EventTriggers = append(p.EventTriggers, t)
+	}
+	rows.Close()
+
+	rows, err = db.Query(ctx, `
+	SELECT t.tgname, t.tgrelid::regclass::text, t.tgfoid::regproc::text, l.lanname,
+	NOT l.lanpltrusted, p.prosecdef, p.prosrc, pg_get_triggerdef(t.oid)
+	FROM pg_trigger t
+	JOIN pg_proc p ON p.oid = t.tgfoid
+	JOIN pg_language l ON l.oid = p.prolang
+	WHERE NOT t.tgisinternal
+	ORDER BY 2, 1;`)
+	if err != nil {
+		return fmt.Errorf("could not read triggers: %w", err)
+	}
+	for rows.Next() {
+		var t Trigger
+		var untrusted, secdef bool
+		var body string
+		if err := rows.Scan(&t.Name, &t.Table, &t.Function, &t.Language, &untrusted, &secdef, &body, &t.Definition); err != nil {
+			continue
+		}
+		if untrusted {
+			t.Flags = append(t.Flags, "function is written in untrusted language "+t.Language)
+		}
+		if secdef {
+			t.Flags = append(t.Flags, "function is SECURITY DEFINER")
+		}
+		t.Flags = append(t.Flags, flagBody(body)...)
+		t.FunctionHash = utils.Fingerprint(body)
+		p.Triggers = append(p.Triggers, t)
+	}
+	rows.Close()
+
+	// Functions that belong to an extension are installed by the extension
+	// itself and not interesting here
+	rows, err = db.Query(ctx, `
+	SELECT n.nspname, p.proname, l.lanname, pg_get_userbyid(p.proowner), p.prosecdef,
+	CASE WHEN l.lanname = 'c' THEN COALESCE(p.probin, '') || ':' || p.prosrc ELSE p.prosrc END
+	FROM pg_proc p
+	JOIN pg_language l ON l.oid = p.prolang
+	JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE NOT l.lanpltrusted AND l.lanname <> 'internal'
+	AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+	AND NOT EXISTS (SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')
+	ORDER BY 1, 2;`)
+	if err != nil {
+		return fmt.Errorf("could not read functions: %w", err)
+	}
+	for rows.Next() {
+		var f Function
+		if err := rows.Scan(&f.Schema, &f.Name, &f.Language, &f.Owner, &f.SecurityDefiner, &f.Body); err != nil {
+			continue
+		}
+		f.Flags = flagBody(f.Body)
+		if f.SecurityDefiner {
+			f.Flags = append(f.Flags, "SECURITY DEFINER")
+		}
+		p.UntrustedFunctions = append(p.UntrustedFunctions, f)
+	}
+	rows.Close()
+
+	rows, err = db.Query(ctx, `
+	SELECT e.extname, e.extversion, n.nspname
+	FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace
+	ORDER BY 1;`)
+	if err != nil {
+		return fmt.Errorf("could not read extensions: %w", err)
+	}
+	for rows.Next() {
+		var e Extension
+		if err := rows.Scan(&e.Name, &e.Version, &e.Schema); err != nil {
+			continue
+		}
+		e.Risky = riskyExtensions[e.Name]
+		p.Extensions = append(p.Extensions, e)
+	}
+	rows.Close()
+	return nil
+}
+
+func printPersistenceText(r *InventoryReport) {
+	utils.PrintHeader("SERVER FILE AND PROGRAM ACCESS ROLES")
+	if msg, ok := r.Errors[sectionPersistence]; ok {
+		fmt.Println(msg)
+	}
+	for _, m := range r.ServerRoleMembers {
+		fmt.Printf("  [!] %-30s is a member of %s\n", m.Member, m.Role)
+	}
+	if len(r.ServerRoleMembers) == 0 {
+		fmt.Println("No members of pg_execute_server_program, pg_read_server_files or pg_write_server_files")
+	}
+
+	utils.PrintHeader("PERSISTENCE (TRIGGERS, UNTRUSTED FUNCTIONS, EXTENSIONS)")
+	for _, p := range r.Persistence {
+		fmt.Printf("  |-- Database: %s\n", p.Database)
+		if p.Error != "" {
+			fmt.Printf("        |-- Error: %s\n", p.Error)
+			continue
+		}
+		for _, t := range p.EventTriggers {
+			fmt.Printf("        |-- [!] EVENT TRIGGER %-25s | ON %s -> %s | Owner: %s | Enabled: %s\n",
+				t.Name, t.Event, t.Function, t.Owner, t.Enabled)
+		}
+		for _, t := range p.Triggers {
+			fmt.Printf("        |-- %s TRIGGER %-25s | %s -> %s (%s)\n", marker(t.Flags), t.Name, t.Table, t.Function, t.Language)
+			for _, flag := range t.Flags {
+				fmt.Printf("              |-- [!] %s\n", flag)
+			}
+		}
+		for _, f := range p.UntrustedFunctions {
+			fmt.Printf("        |-- [!] FUNCTION %-25s | %s | Owner: %s\n", f.Schema+"."+f.Name, f.Language, f.Owner)
+			fmt.Printf("              |-- %s\n", utils.Truncate(f.Body, 120))
+			for _, flag := range f.Flags {
+				fmt.Printf("              |-- [!] %s\n", flag)
+			}
+		}
+		for _, e := range p.Extensions {
+			m := "   "
+			if e.Risky {
+				m = "[!]"
+			}
+			fmt.Printf("        |-- %s EXTENSION %-23s | %s (schema %s)\n", m, e.Name, e.Version, e.Schema)
+		}
+	}
+}
+
+func marker(flags []string) string {
+	if len(flags) > 0 {
+		return "[!]"
+	}
+	return "   "
+}
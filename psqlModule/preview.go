@@ -0,0 +1,102 @@
+package psqlModule
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// databaseObjectsQuery lists the objects of one database a restore preview
+// compares with, as kind, schema and name.
+const databaseObjectsQuery = `
+SELECT CASE c.relkind WHEN 'v' THEN 'view' WHEN 'm' THEN 'materialized view' WHEN 'S' THEN 'sequence' ELSE 'table' END,
+	n.nspname, c.relname
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p', 'f', 'v', 'm', 'S')
+	AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg\_toast%'
+UNION ALL
+SELECT CASE p.prokind WHEN 'p' THEN 'procedure' WHEN 'a' THEN 'aggregate' ELSE 'function' END,
+	n.nspname, p.proname
+FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')
+UNION ALL
+SELECT 'trigger', n.nspname, t.tgname
+FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE NOT t.tgisinternal
+UNION ALL
+SELECT CASE t.typtype WHEN 'd' THEN 'domain' ELSE 'type' END, n.nspname, t.typname
+FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+WHERE t.typtype IN ('c', 'd', 'e', 'r', 'm')
+	AND (t.typrelid = 0 OR (SELECT relkind FROM pg_class WHERE oid = t.typrelid) = 'c')
+	AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+UNION ALL
+SELECT 'schema', '', nspname FROM pg_namespace
+WHERE nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'
+UNION ALL
+SELECT 'extension', '', extname FROM pg_extension`
+
+// existingObjects returns the utils.ObjectKey of every role and database on
+// the server, and of the objects in the databases plan restores into.
+func existingObjects(password string, plan *utils.RestorePlan) (map[string]bool, error) {
+	db, err := connectToDatabaseDB(username, password, host, port, "postgres", false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	existing := map[string]bool{}
+	roles, err := queryNames(db, "SELECT rolname FROM pg_roles")
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		existing[utils.ObjectKey("role", "", "", r)] = true
+	}
+	databases, err := queryNames(db, "SELECT datname FROM pg_database WHERE datallowconn")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range databases {
+		existing[utils.ObjectKey("database", name, "", "")] = true
+	}
+
+	for _, name := range plan.Databases() {
+		if !slices.Contains(databases, name) {
+			continue
+		}
+		dbPool := db
+		if name != "postgres" {
+			if dbPool, err = connectToDatabaseDB(username, password, host, port, name, false); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		err := addObjectKeys(dbPool, name, existing)
+		if dbPool != db {
+			dbPool.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return existing, nil
+}
+
+func addObjectKeys(db *pgxpool.Pool, database string, existing map[string]bool) error {
+	rows, err := db.Query(context.Background(), databaseObjectsQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, schema, name string
+		if err := rows.Scan(&kind, &schema, &name); err != nil {
+			return err
+		}
+		existing[utils.ObjectKey(kind, database, schema, name)] = true
+	}
+	return rows.Err()
+}
@@ -1,12 +1,17 @@
 package psqlModule
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"ccdc-cli/utils"
@@ -23,6 +28,28 @@ var (
 	backup    bool
 	restore   bool
 	file      string
+	output    string
+
+	saveBaseline string
+	diffBaseline string
+	failOn       string
+	native       bool
+	compress     string
+	encrypt      bool
+	recipient    string
+	identity     string
+	force        bool
+	preview      bool
+	noSnapshot   bool
+	snapshotDir  string
+	databases    []string
+	tables       []string
+	exclude      []string
+	selector     *utils.Selector
+	backupDir    string
+	retention    utils.RetentionPolicy
+	hbaFile      string
+	identFile    string
 )
 
 func GetpsqlCmd() *cobra.Command {
@@ -35,27 +62,90 @@ This Module Contains the Following Functionality:
 - Backup a Database
 - Restore a Database
 - Inventory a Database
+- Harden a Server (psql harden)
+- Rotate Role Passwords (psql rotate)
+- Monitor and Terminate Sessions (psql watch)
+- Take Scheduled Backups (psql backup)
+- Verify a Backup Against its Manifest (psql verify)
 
 This Command must be run with any of the following flags: -irb`,
 		RunE:         runCmd,
 		SilenceUsage: true,
 	}
-	psqlCmd.Flags().IntVarP(&port, "port", "p", 5432, "Port to Connect to")
-	psqlCmd.Flags().StringVarP(&host, "host", "H", "127.0.0.1", "Host to Connect to")
-	psqlCmd.Flags().StringVarP(&username, "username", "u", "postgres", "User to Connect as")
+	psqlCmd.PersistentFlags().IntVarP(&port, "port", "p", 5432, "Port to Connect to")
+	psqlCmd.PersistentFlags().StringVarP(&host, "host", "H", "127.0.0.1", "Host to Connect to")
+	psqlCmd.PersistentFlags().StringVarP(&username, "username", "u", "postgres", "User to Connect as")
 	psqlCmd.Flags().BoolVarP(&inventory, "inventory", "i", false, "Should run Inventory Check")
 	psqlCmd.Flags().BoolVarP(&backup, "backup", "b", false, "Should Backup")
 	psqlCmd.Flags().BoolVarP(&restore, "restore", "r", false, "Should Restore")
-	psqlCmd.Flags().StringVarP(&file, "file", "f", "", "File to Use for Backup/Restore")
+	psqlCmd.Flags().StringVarP(&file, "file", "f", "", "File to Use for Backup/Restore, a directory when selecting databases or tables")
+	addBackupFlags(psqlCmd)
+	psqlCmd.Flags().StringVar(&identity, "identity", "", "Private key file to decrypt a backup encrypted with --recipient")
+	psqlCmd.Flags().BoolVar(&force, "force", false, "Restore even if the backup has no manifest or does not match it")
+	psqlCmd.Flags().BoolVar(&noSnapshot, "no-snapshot", false, "Restore without first taking a safety snapshot of the databases it overwrites")
+	psqlCmd.Flags().StringVar(&snapshotDir, "snapshot-dir", "", "Directory for the safety snapshot (default: the directory of -f)")
+	psqlCmd.Flags().BoolVar(&preview, "preview", false, "With -r, list what the restore would do and what it would overwrite, without restoring")
+	psqlCmd.Flags().StringVarP(&output, "output", "o", utils.OutputText, "Inventory output format: text, json or yaml")
+	psqlCmd.Flags().StringVar(&saveBaseline, "save-baseline", "", "Save the inventory to this file as a baseline")
+	psqlCmd.Flags().StringVar(&diffBaseline, "diff", "", "Compare the inventory against a saved baseline")
+	psqlCmd.Flags().StringVar(&failOn, "fail-on", "", "Exit with code 2 if any finding is at least this severe: low, medium or high")
+	psqlCmd.Flags().StringVar(&hbaFile, "hba-file", "", "Audit this pg_hba.conf instead of the server's active rules")
+	psqlCmd.Flags().StringVar(&identFile, "ident-file", "", "Audit this pg_ident.conf instead of the server's active mappings")
 
 	psqlCmd.MarkFlagsMutuallyExclusive("backup", "restore")
+	psqlCmd.MarkFlagsMutuallyExclusive("file", "backup-dir")
+
+	psqlCmd.AddCommand(getHardenCmd())
+	psqlCmd.AddCommand(getBackupCmd())
+	psqlCmd.AddCommand(getVerifyCmd())
+	psqlCmd.AddCommand(getRotateCmd())
+	psqlCmd.AddCommand(getWatchCmd())
 	return psqlCmd
 }
 
+// addBackupFlags registers the flags -b shares with the backup subcommand.
+func addBackupFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "Write timestamped backups into this directory instead of -f")
+	cmd.Flags().IntVar(&retention.Keep, "keep", 0, "With --backup-dir, keep only the newest N backups of this server")
+	cmd.Flags().DurationVar(&retention.KeepWithin, "keep-within", 0, "With --backup-dir, keep only backups of this server younger than this, e.g. 6h")
+	cmd.Flags().StringSliceVar(&databases, "databases", nil, "Only backup/restore these databases")
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "Only backup/restore these tables, as database.schema.table or database.table for public")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Skip these databases or tables")
+	cmd.Flags().StringVar(&compress, "compress", "", "Compress the backup as it is written: gzip or zstd")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the backup with a passphrase, or for --recipient")
+	cmd.Flags().StringVar(&recipient, "recipient", "", "Encrypt the backup for this public key (ccdc-pub-... or a file holding it)")
+	cmd.Flags().BoolVar(&native, "native", false, "Backup with the built in dump engine instead of pg_dumpall (PostgreSQL 12+)")
+}
+
+// parseBackupFlags validates the backup flags and parses the selector.
+func parseBackupFlags() error {
+	if err := utils.ValidateCompression(compress); err != nil {
+		return err
+	}
+	sel, err := utils.ParseSelector(utils.DialectPostgres, databases, tables, exclude)
+	if err != nil {
+		return err
+	}
+	selector = sel
+	return nil
+}
+
 func runCmd(cmd *cobra.Command, args []string) error {
+	if err := utils.ValidateOutputFormat(output); err != nil {
+		return err
+	}
+	if _, _, err := utils.ParseFailOn(failOn); err != nil {
+		return err
+	}
+	if err := parseBackupFlags(); err != nil {
+		return err
+	}
+
 	didGetFlag := false
 	if cmd.Flags().Changed("inventory") {
-		runInventory()
+		if err := runInventory(); err != nil {
+			return err
+		}
 		didGetFlag = true
 	}
 
@@ -73,181 +163,193 @@ func runCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runInventory() {
+func runInventory() error {
 	password, err := utils.GetPassword()
 	if err != nil {
-		fmt.Println("Error Reading Password")
-		return
+		return fmt.Errorf("failed to read password")
 	}
 
-	db, err := connectToDatabase(username, password, host, port)
+	db, err := connectToDatabaseDB(username, password, host, port, "postgres", output == utils.OutputText)
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		return
+		return err
 	}
 	defer db.Close()
 
-	userAccounts(db)
-	dataAccessPermissions(db)
-	instanceInventory(db)
+	report := &InventoryReport{Host: host, Port: port}
+	userAccounts(db, report)
+	dataAccessPermissions(db, password, report)
+	instanceInventory(db, password, report)
+	persistenceInventory(db, password, report)
+	hbaAudit(db, report)
+	settingsAudit(db, report)
+	report.Findings = report.collectFindings()
+
+	if saveBaseline != "" {
+		if err := utils.SaveSnapshot(saveBaseline, report); err != nil {
+			return fmt.Errorf("failed to save baseline: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Baseline saved to %s\n", saveBaseline)
+	}
+	if diffBaseline != "" {
+		if err := compareWithBaseline(diffBaseline, report); err != nil {
+			return err
+		}
+		return utils.CheckFailOn(report.Findings, failOn)
+	}
+
+	if output == utils.OutputText {
+		printReportText(report)
+	} else if err := utils.WriteStructured(os.Stdout, output, report); err != nil {
+		return err
+	}
+	return utils.CheckFailOn(report.Findings, failOn)
 }
 
-func userAccounts(db *pgxpool.Pool) {
-	utils.PrintHeader("USER ACCOUNTS")
+func userAccounts(db *pgxpool.Pool, report *InventoryReport) {
+	// pg_roles masks every password as ********, only pg_authid shows which
+	// roles have none. It needs superuser, without it no role is reported as
+	// passwordless.
 	query := `
-	SELECT rolname,
-	CASE WHEN rolsuper THEN 'YES' ELSE 'NO' END,
-	CASE WHEN rolpassword IS NULL THEN 'YES' ELSE 'NO' END,
-	CASE WHEN rolcanlogin THEN 'YES' ELSE 'NO' END
-	FROM pg_roles ORDER BY rolcanlogin DESC;`
+	SELECT rolname, rolsuper, rolpassword IS NULL, rolcanlogin
+	FROM pg_authid ORDER BY rolcanlogin DESC;`
 
 	rows, err := db.Query(context.Background(), query)
 	if err != nil {
-		fmt.Printf("Error querying database: %v\n", err)
+		report.setError(sectionRoles, fmt.Sprintf("Passwordless roles not checked, pg_authid requires superuser: %v", err))
+		rows, err = db.Query(context.Background(), `
+		SELECT rolname, rolsuper, false, rolcanlogin
+		FROM pg_roles ORDER BY rolcanlogin DESC;`)
+	}
+	if err != nil {
+		report.setError(sectionRoles, fmt.Sprintf("Error querying database: %v", err))
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var rname, rsup, rnop, rlog string
-		if err := rows.Scan(&rname, &rsup, &rnop, &rlog); err != nil {
-			fmt.Printf("Error reading user: %v\n", err)
+		var role Role
+		if err := rows.Scan(&role.Name, &role.Superuser, &role.NoPassword, &role.CanLogin); err != nil {
 			continue
 		}
-		fmt.Printf("  |-- %-30s | Super: %-3s | NoPass: %-3s | Login: %s\n", rname, rsup, rnop, rlog)
+		report.Roles = append(report.Roles, role)
 	}
 }
 
-func dataAccessPermissions(db *pgxpool.Pool) {
-	password, err := utils.GetPassword()
-	if err != nil {
-		fmt.Println("Error Reading Password")
-		return
-	}
-
-	utils.PrintHeader("DATA ACCESS PERMISSIONS")
+// listDatabases returns the names of every non-template database.
+func listDatabases(db *pgxpool.Pool) ([]string, error) {
 	query := `
 	SELECT datname 
 	FROM pg_database
 	WHERE datistemplate = false;`
 
-	drows, err := db.Query(context.Background(), query)
+	rows, err := db.Query(context.Background(), query)
 	if err != nil {
-		fmt.Printf("Error querying database: %v\n", err)
-		return
+		return nil, err
 	}
-	defer drows.Close()
+	defer rows.Close()
 
-	for drows.Next() {
-		var dname string
-		if err := drows.Scan(&dname); err != nil {
-			fmt.Printf("Error reading databases: %v\n", err)
-			continue
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
 		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func dataAccessPermissions(db *pgxpool.Pool, password string, report *InventoryReport) {
+	databases, err := listDatabases(db)
+	if err != nil {
+		report.setError(sectionDataAccess, fmt.Sprintf("Error querying database: %v", err))
+		return
+	}
+
+	query := `
+	SELECT r.rolname,
+	has_database_privilege(r.rolname, current_database(), 'CONNECT'),
+	EXISTS (SELECT 1 FROM information_schema.table_privileges
+		WHERE grantee = r.rolname AND privilege_type = 'SELECT') OR r.rolsuper,
+	EXISTS (SELECT 1 FROM information_schema.table_privileges
+		WHERE grantee = r.rolname AND privilege_type IN ('INSERT','UPDATE','DELETE')) OR r.rolsuper
+	FROM pg_roles r WHERE r.rolcanlogin = true;`
+
+	for _, dname := range databases {
+		access := DatabaseAccess{Database: dname}
+
 		db2, err := connectToDatabaseDB(username, password, host, port, dname, false)
 		if err != nil {
-			fmt.Printf("  |-- Unable to connect to %s\n", dname)
+			access.Error = err.Error()
+			report.DataAccess = append(report.DataAccess, access)
 			continue
 		}
-		defer db2.Close()
-		query = `
-		SELECT current_database(), r.rolname,
-		CASE WHEN has_database_privilege(r.rolname, current_database(), 'CONNECT') THEN 'YES' ELSE 'NO' END,
-		CASE WHEN EXISTS (SELECT 1 FROM information_schema.table_privileges
-			WHERE grantee = r.rolname AND privilege_type = 'SELECT')
-			OR r.rolsuper THEN 'YES' ELSE 'NO' END,
-		CASE WHEN EXISTS (SELECT 1 FROM information_schema.table_privileges
-			WHERE grantee = r.rolname AND privilege_type IN ('INSERT','UPDATE','DELETE'))
-			OR r.rolsuper THEN 'YES' ELSE 'NO' END
-		FROM pg_roles r WHERE r.rolcanlogin = true;`
 
 		arows, err := db2.Query(context.Background(), query)
 		if err != nil {
-			fmt.Printf("Error reading tables: %v\n", err)
+			access.Error = err.Error()
+			report.DataAccess = append(report.DataAccess, access)
+			db2.Close()
 			continue
 		}
-		defer arows.Close()
-		fmt.Printf("  |-- Database: %s\n", dname)
 		for arows.Next() {
-			var dbName, uname, uconn, uread, uwrite string
-			if err := arows.Scan(&dbName, &uname, &uconn, &uread, &uwrite); err != nil {
-				fmt.Printf("Error scanning tables: %v\n", err)
+			var entry AccessEntry
+			if err := arows.Scan(&entry.User, &entry.Connect, &entry.Read, &entry.Write); err != nil {
 				continue
 			}
-			if uconn == "YES" || uread == "YES" {
-				fmt.Printf("        |-- User: %-15s | Conn: %-3s | Read: %-3s | Write: %s\n", uname, uconn, uread, uwrite)
-			}
+			access.Users = append(access.Users, entry)
 		}
 		arows.Close()
 		db2.Close()
+		report.DataAccess = append(report.DataAccess, access)
 	}
 }
 
-func instanceInventory(db *pgxpool.Pool) {
-	password, err := utils.GetPassword()
-	if err != nil {
-		fmt.Println("Error Reading Password")
-		return
-	}
-
-	utils.PrintHeader("INSTANCE CONTENT INVENTORY")
-	query := `
-	SELECT datname 
-	FROM pg_database
-	WHERE datistemplate = false;`
-
-	drows, err := db.Query(context.Background(), query)
+func instanceInventory(db *pgxpool.Pool, password string, report *InventoryReport) {
+	databases, err := listDatabases(db)
 	if err != nil {
-		fmt.Printf("Error querying database: %v\n", err)
+		report.setError(sectionDatabases, fmt.Sprintf("Error querying database: %v", err))
 		return
 	}
-	defer drows.Close()
 
-	for drows.Next() {
-		var dbName string
-		if err := drows.Scan(&dbName); err != nil {
-			fmt.Printf("  |-- Error With Query: %s", err)
-			continue
-		}
+	tableQuery := `
+	SELECT c.relname, n.nspname, pg_size_pretty(pg_total_relation_size(c.oid))::text
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind = 'r' AND n.nspname = 'public' LIMIT 5;`
 
-		query = fmt.Sprintf("SELECT pg_size_pretty(pg_database_size('%s'))::text;", dbName)
+	for _, dbName := range databases {
+		database := Database{Name: dbName}
 
-		var dsize string
-		err = db.QueryRow(context.Background(), query).Scan(&dsize)
-		if err != nil {
-			fmt.Printf("  |-- Error querying %s: %v\n", dbName, err)
+		query := "SELECT pg_size_pretty(pg_database_size($1))::text;"
+		if err := db.QueryRow(context.Background(), query, dbName).Scan(&database.Size); err != nil {
+			database.Error = err.Error()
+			report.Databases = append(report.Databases, database)
 			continue
 		}
-		fmt.Printf("  |-- DATABASE: %s (SIZE: %s)\n", dbName, dsize)
 
 		db2, err := connectToDatabaseDB(username, password, host, port, dbName, false)
 		if err != nil {
-			fmt.Printf("Error connecting for tables: %v\n", err)
+			database.Error = err.Error()
+			report.Databases = append(report.Databases, database)
 			continue
 		}
-		defer db2.Close()
-
-		query = `
-		SELECT c.relname, n.nspname, pg_size_pretty(pg_total_relation_size(c.oid))::text
-		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
-		WHERE c.relkind = 'r' AND n.nspname = 'public' LIMIT 5;`
 
-		trows, err := db2.Query(context.Background(), query)
+		trows, err := db2.Query(context.Background(), tableQuery)
 		if err != nil {
-			fmt.Printf("Error querying for tables: %v\n", err)
+			database.Error = err.Error()
+			report.Databases = append(report.Databases, database)
+			db2.Close()
 			continue
 		}
-		defer trows.Close()
-
 		for trows.Next() {
-			var tname, tns, tsize string
-			if err := trows.Scan(&tname, &tns, &tsize); err != nil {
-				fmt.Printf("Error scanning for tables: %v\n", err)
+			var t Table
+			if err := trows.Scan(&t.Name, &t.Schema, &t.Size); err != nil {
 				continue
 			}
-			fmt.Printf("        |-- %-35s | Size: %s\n", tname, tsize)
+			database.Tables = append(database.Tables, t)
 		}
 		trows.Close()
 		db2.Close()
+		report.Databases = append(report.Databases, database)
 	}
 }
 
@@ -257,7 +359,7 @@ func connectToDatabase(username, password, host string, port int) (*pgxpool.Pool
 
 func connectToDatabaseDB(username, password, host string, port int, dbname string, shouldPrint bool) (*pgxpool.Pool, error) {
 	if shouldPrint {
-		fmt.Printf("Connecting to database: '%s' at %s:%d", dbname, host, port)
+		fmt.Printf("Connecting to database: '%s' at %s:%d\n", dbname, host, port)
 	}
 
 	userInfo := url.UserPassword(username, password)
@@ -286,7 +388,7 @@ func connectToDatabaseDB(username, password, host string, port int, dbname strin
 }
 
 func runRestore() {
-	if !utils.CheckCliCmdExist("psql") {
+	if !preview && !utils.CheckCliCmdExist("psql") {
 		fmt.Println("This command requires 'psql' to be in path")
 		return
 	} else if len(file) == 0 {
@@ -300,71 +402,407 @@ func runRestore() {
 		return
 	}
 
-	ifile, err := os.Open(file)
+	keys, err := utils.DecryptKeysFromFlags(identity)
+	if err != nil {
+		fmt.Printf("Failed to load identity: %v\n", err)
+		return
+	}
+	targets, err := utils.RestoreTargets(file, selector)
 	if err != nil {
-		fmt.Printf("Failed to open backup file: %v", err)
+		fmt.Printf("Failed to open backup file: %v\n", err)
+		return
+	}
+	if len(targets) == 0 {
+		fmt.Println("No backups match the selection")
 		return
 	}
+
+	if preview {
+		existing := func(plan *utils.RestorePlan) (map[string]bool, error) { return existingObjects(password, plan) }
+		for _, t := range targets {
+			if err := utils.PreviewRestore(t, "postgres", selector, keys, existing); err != nil {
+				fmt.Printf("Preview failed: %v\n", err)
+				return
+			}
+		}
+		return
+	}
+
+	snapshot := ""
+	if !noSnapshot {
+		if snapshot, err = safetySnapshot(password); err != nil {
+			fmt.Printf("Restore aborted, the safety snapshot failed: %v\n", err)
+			fmt.Println("Use --no-snapshot to restore without one")
+			return
+		}
+	}
+
+	for _, t := range targets {
+		if err := restoreFrom(t, password, keys); err != nil {
+			fmt.Printf("Restore failed: %v\n", err)
+			offerRollback(snapshot, password)
+			return
+		}
+	}
+	fmt.Println("Restoration completed successfully!")
+}
+
+// restoreFrom loads one backup file with psql, keeping only the selected
+// databases and tables. Backups of a single database are loaded into that
+// database, which is created first if it is missing.
+func restoreFrom(t utils.RestoreTarget, password string, keys utils.DecryptKeys) error {
+	if err := utils.CheckBeforeRestore(t.Path, "postgres", force); err != nil {
+		return err
+	}
+	ifile, err := utils.OpenBackup(t.Path, keys)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
 	defer ifile.Close()
 
-	cmd := exec.Command("psql",
+	target := "postgres"
+	if t.Database != "" {
+		if err := ensureDatabase(password, t.Database); err != nil {
+			return err
+		}
+		target = t.Database
+	}
+
+	br := bufio.NewReader(ifile)
+	strict := t.Database != "" && !isNativeDump(br)
+	var input io.Reader = br
+	if selector.Active() {
+		input = utils.NewFilterReader(br, selector, t.Database)
+	}
+
+	fmt.Printf("Starting restoration of %s into %s\n", t.Path, target)
+	return loadDump(input, target, password, strict)
+}
+
+// isNativeDump reports whether the dump read by r was written by
+// nativeBackup.
+func isNativeDump(r *bufio.Reader) bool {
+	head, _ := r.Peek(len(nativeDumpHeader))
+	return string(head) == nativeDumpHeader
+}
+
+// loadDump pipes a dump into psql connected to database target. A strict
+// load, used for pg_dump files of one database, stops at the first error
+// inside a single transaction so a failed load changes nothing. pg_dumpall
+// and native dumps switch databases with \connect and hit expected errors
+// such as roles that already exist, they are loaded to the end and fail if
+// psql reported any other error.
+func loadDump(input io.Reader, target, password string, strict bool) error {
+	args := []string{
 		"-h", host,
 		"-p", strconv.Itoa(port),
 		"-U", username,
-		"-d", "postgres")
+		"-d", target,
+	}
+	if strict {
+		args = append(args, "-v", "ON_ERROR_STOP=1", "--single-transaction")
+	}
+	cmd := exec.Command("psql", args...)
 
 	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", password))
 
-	cmd.Stdin = ifile
-	cmd.Stderr = os.Stderr
+	errs := &psqlErrors{w: os.Stderr}
+	cmd.Stdin = input
+	cmd.Stderr = errs
 	cmd.Stdout = os.Stdout
-
-	fmt.Printf("Starting full restoration frum %s\n", file)
 	if err := cmd.Run(); err != nil {
-		fmt.Printf("Restore failed: %v\n", err)
-		return
+		return err
 	}
-	fmt.Println("Restoration completed successfully!")
+	errs.flush()
+	if errs.count > 0 {
+		return fmt.Errorf("psql reported %d error(s)", errs.count)
+	}
+	return nil
+}
+
+// psqlErrors copies psql's stderr to w and counts the ERROR lines other than
+// objects that already exist.
+type psqlErrors struct {
+	w     io.Writer
+	line  []byte
+	count int
+}
+
+func (e *psqlErrors) Write(p []byte) (int, error) {
+	e.w.Write(p)
+	for _, b := range p {
+		if b != '\n' {
+			e.line = append(e.line, b)
+			continue
+		}
+		e.flush()
+	}
+	return len(p), nil
+}
+
+// flush counts the line read so far.
+func (e *psqlErrors) flush() {
+	line := string(e.line)
+	e.line = e.line[:0]
+	if strings.Contains(line, "ERROR:") && !strings.Contains(line, "already exists") {
+		e.count++
+	}
+}
+
+// ensureDatabase creates database name if it does not exist.
+func ensureDatabase(password, name string) error {
+	db, err := connectToDatabaseDB(username, password, host, port, maintenanceDB(name), false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	var exists bool
+	if err := db.QueryRow(ctx, "SELECT EXISTS (SELECT FROM pg_database WHERE datname = $1)", name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	fmt.Printf("Creating database %s\n", name)
+	_, err = db.Exec(ctx, "CREATE DATABASE "+quoteIdent(name))
+	return err
 }
 
 func runBackup() {
-	if !utils.CheckCliCmdExist("pg_dumpall") {
-		fmt.Println("This command requires 'pg_dumpall' to be in path")
-		return
-	} else if len(file) == 0 {
-		fmt.Println("This command requires the -f flag to be set")
+	job, err := prepareBackup()
+	if err != nil {
+		fmt.Printf("Backup Failed: %v\n", err)
 		return
 	}
+	if err := job.run(context.Background()); err != nil {
+		fmt.Printf("Backup Failed: %v\n", err)
+	}
+}
+
+// backupJob is a backup with its flags checked and its secrets read, so a
+// scheduled backup can run it again without prompting.
+type backupJob struct {
+	password  string
+	useNative bool
+	opts      utils.BackupOptions
+}
+
+// prepareBackup checks the backup flags and reads the password and the
+// backup passphrase.
+func prepareBackup() (*backupJob, error) {
+	if len(file) == 0 && backupDir == "" {
+		return nil, errors.New("this command requires the -f or --backup-dir flag to be set")
+	}
+	useNative := native
+	tool := "pg_dumpall"
+	if selector.Active() {
+		tool = "pg_dump"
+	}
+	if !useNative && !utils.CheckCliCmdExist(tool) {
+		fmt.Printf("%s not found in path, using the native dump engine\n", tool)
+		useNative = true
+	}
 
 	password, err := utils.GetPassword()
 	if err != nil {
-		fmt.Println("Failed to read password!")
+		return nil, errors.New("failed to read password")
+	}
+
+	encryption, err := utils.EncryptionFromFlags(encrypt, recipient)
+	if err != nil {
+		return nil, err
+	}
+	return &backupJob{password: password, useNative: useNative, opts: utils.BackupOptions{Compression: compress, Encrypt: encryption}}, nil
+}
+
+// run takes one backup and prunes --backup-dir once it succeeded.
+func (j *backupJob) run(ctx context.Context) error {
+	target := file
+	if backupDir != "" {
+		if err := os.MkdirAll(backupDir, 0700); err != nil {
+			return err
+		}
+		target = filepath.Join(backupDir, utils.BackupBaseName(host, port, "postgres", time.Now()))
+		if !selector.Active() {
+			target += utils.BackupExtension(j.opts)
+		}
+	}
+
+	if selector.Active() {
+		dbs, err := selectedDatabases(j.password)
+		if err != nil {
+			return err
+		}
+		if len(dbs) == 0 {
+			return errors.New("no databases match the selection")
+		}
+		if err := j.backupDatabases(ctx, target, dbs); err != nil {
+			return err
+		}
+		applyRetention()
+		return nil
+	}
+
+	if j.useNative {
+		fmt.Printf("Backing up instance from %s:%d (native)\n", host, port)
+	} else {
+		fmt.Printf("Backing up instance from %s:%d\n", host, port)
+	}
+	if err := j.backupTo(ctx, target, ""); err != nil {
+		return err
+	}
+	fmt.Printf("Created Backup: %s\n", target)
+	applyRetention()
+	return nil
+}
+
+// backupDatabases writes one pg_dump file per database in dbs into dir.
+func (j *backupJob) backupDatabases(ctx context.Context, dir string, dbs []string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, db := range dbs {
+		path := filepath.Join(dir, db+utils.BackupExtension(j.opts))
+		fmt.Printf("Backing up database %s from %s:%d\n", db, host, port)
+		if err := j.backupTo(ctx, path, db); err != nil {
+			if backupDir != "" {
+				// a partial snapshot would be listed and kept like a good one
+				os.RemoveAll(dir)
+			}
+			return fmt.Errorf("%s: %w", db, err)
+		}
+		fmt.Printf("Created Backup: %s\n", path)
+	}
+	return nil
+}
+
+// applyRetention prunes --backup-dir after a successful backup.
+func applyRetention() {
+	if backupDir == "" {
 		return
 	}
+	removed, err := utils.PruneBackups(backupDir, host, port, "postgres", retention, time.Now())
+	for _, b := range removed {
+		fmt.Printf("Pruned old backup %s\n", b.Path)
+	}
+	if err != nil {
+		fmt.Printf("[WARN] pruning %s failed: %v\n", backupDir, err)
+	}
+}
 
-	cmd := exec.Command("pg_dumpall",
-		"-h", host,
-		"-p", strconv.Itoa(port),
-		"-U", username)
+// selectedDatabases returns the databases a selective backup covers.
+func selectedDatabases(password string) ([]string, error) {
+	candidates := selector.SelectedDatabases()
+	if len(candidates) == 0 {
+		var err error
+		if candidates, err = serverDatabases(password); err != nil {
+			return nil, err
+		}
+	}
 
-	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", password))
+	var dbs []string
+	for _, db := range candidates {
+		if selector.IncludesDatabase(db) {
+			dbs = append(dbs, db)
+		}
+	}
+	return dbs, nil
+}
 
-	ofile, err := os.Create(file)
+// serverDatabases lists the databases on the server that can be dumped.
+func serverDatabases(password string) ([]string, error) {
+	db, err := connectToDatabaseDB(username, password, host, port, "postgres", false)
 	if err != nil {
-		fmt.Printf("Failed to create backup file: %v\n", err)
-		return
+		return nil, err
 	}
-	defer ofile.Close()
+	defer db.Close()
+	return queryNames(db, `
+	SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname`)
+}
 
-	cmd.Stdout = ofile
-	cmd.Stderr = os.Stderr
+// backupTo writes a backup of the whole instance, or of database db when it
+// is set, to path and writes its manifest. The backup is written next to
+// path and only replaces it once complete, a failed backup is removed.
+func (j *backupJob) backupTo(ctx context.Context, path, db string) error {
+	tmp := utils.TempBackupPath(path)
+	out, err := utils.CreateBackup(tmp, j.opts)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
 
-	fmt.Printf("Backing up instance from %s:%d", host, port)
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Backup Failed: %v\n", err)
-		os.Remove(file)
-		return
+	var sel *utils.Selector
+	if db != "" {
+		sel = selector.ForDatabase(db)
 	}
+	if j.useNative {
+		var w io.WriteCloser = nopWriteCloser{out}
+		if sel.NarrowsDatabase(db) {
+			// the native engine dumps whole databases, the filter drops the
+			// tables that weren't selected
+			w = utils.NewFilterWriter(out, sel, db)
+		}
+		err = nativeBackup(ctx, j.password, w, sel)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	} else {
+		err = pgDump(ctx, j.password, out, db, sel)
+	}
+	// closing flushes the compressor, a failure there truncates the backup
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = utils.CommitBackup(path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	manifest, err := backupManifest(j.password, db)
+	if err != nil {
+		fmt.Printf("[WARN] could not read server details for the manifest: %v\n", err)
+	}
+	if err := utils.WriteManifest(path, manifest); err != nil {
+		fmt.Printf("[WARN] failed to write the backup manifest, restoring this backup will need --force: %v\n", err)
+		return nil
+	}
+	fmt.Printf("Wrote manifest %s\n", utils.ManifestPath(path))
+	return nil
+}
 
-	fmt.Printf("Created Backup: %s\n", file)
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// pgDump runs pg_dumpall into w, or pg_dump for database db when it is set.
+// Single database dumps drop and recreate their objects, so they are loaded
+// into an existing database.
+func pgDump(ctx context.Context, password string, w io.Writer, db string, sel *utils.Selector) error {
+	args := []string{
+		"-h", host,
+		"-p", strconv.Itoa(port),
+		"-U", username,
+	}
+	tool := "pg_dumpall"
+	if db != "" {
+		tool = "pg_dump"
+		args = append(args, "--clean", "--if-exists")
+		for _, t := range sel.Tables {
+			args = append(args, "--table="+quoteIdent(t.Schema)+"."+quoteIdent(t.Name))
+		}
+		for _, t := range sel.ExcludeTables {
+			args = append(args, "--exclude-table="+quoteIdent(t.Schema)+"."+quoteIdent(t.Name))
+		}
+		args = append(args, "--dbname="+db)
+	}
+
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", password))
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
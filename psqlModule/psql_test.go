@@ -0,0 +1,45 @@
+package psqlModule
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPsqlErrors(t *testing.T) {
+	stderr := `psql:<stdin>:12: ERROR:  role "postgres" already exists
+psql:<stdin>:40: NOTICE:  table "t" does not exist, skipping
+psql:<stdin>:51: ERROR:  relation "missing" does not exist
+psql:<stdin>:52: ERROR:  syntax error at or near "x"`
+
+	errs := &psqlErrors{w: io.Discard}
+	// psql's output arrives in arbitrary chunks
+	for i := 0; i < len(stderr); i += 7 {
+		errs.Write([]byte(stderr[i:min(i+7, len(stderr))]))
+	}
+	errs.flush()
+	if errs.count != 2 {
+		t.Errorf("counted %d errors, want 2", errs.count)
+	}
+}
+
+func TestIsNativeDump(t *testing.T) {
+	tests := []struct {
+		dump string
+		want bool
+	}{
+		{nativeDumpHeader + "\n-- Host: db:5432\n", true},
+		{"--\n-- PostgreSQL database dump\n--\n", false},
+		{"--", false},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.dump))
+		if got := isNativeDump(r); got != tt.want {
+			t.Errorf("isNativeDump(%q) = %t, want %t", tt.dump, got, tt.want)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != tt.dump {
+			t.Errorf("isNativeDump consumed the dump")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package psqlModule
+
+import (
+	"fmt"
+
+	"ccdc-cli/utils"
+)
+
+// Section keys used in InventoryReport.Errors.
+const (
+	sectionRoles       = "roles"
+	sectionDataAccess  = "data_access"
+	sectionDatabases   = "databases"
+	sectionPersistence = "persistence"
+	sectionSettings    = "settings"
+)
+
+type InventoryReport struct {
+	Host              string                `json:"host" yaml:"host"`
+	Port              int                   `json:"port" yaml:"port"`
+	Roles             []Role                `json:"roles" yaml:"roles"`
+	DataAccess        []DatabaseAccess      `json:"data_access" yaml:"data_access"`
+	Databases         []Database            `json:"databases" yaml:"databases"`
+	Persistence       []DatabasePersistence `json:"persistence" yaml:"persistence"`
+	ServerRoleMembers []ServerRoleMember    `json:"server_role_members" yaml:"server_role_members"`
+	HBA               *HBAAudit             `json:"hba,omitempty" yaml:"hba,omitempty"`
+	Settings          []SettingCheck        `json:"settings" yaml:"settings"`
+	AlterSystem       []AutoConfEntry       `json:"alter_system" yaml:"alter_system"`
+	Findings          []utils.Finding       `json:"findings" yaml:"findings"`
+	Errors            map[string]string     `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+type Role struct {
+	Name       string `json:"name" yaml:"name"`
+	Superuser  bool   `json:"superuser" yaml:"superuser"`
+	NoPassword bool   `json:"no_password" yaml:"no_password"`
+	CanLogin   bool   `json:"can_login" yaml:"can_login"`
+}
+
+type DatabaseAccess struct {
+	Database string        `json:"database" yaml:"database"`
+	Users    []AccessEntry `json:"users" yaml:"users"`
+	Error    string        `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type AccessEntry struct {
+	User    string `json:"user" yaml:"user"`
+	Connect bool   `json:"connect" yaml:"connect"`
+	Read    bool   `json:"read" yaml:"read"`
+	Write   bool   `json:"write" yaml:"write"`
+}
+
+type Database struct {
+	Name   string  `json:"name" yaml:"name"`
+	Size   string  `json:"size" yaml:"size"`
+	Tables []Table `json:"tables" yaml:"tables"`
+	Error  string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type Table struct {
+	Name   string `json:"name" yaml:"name"`
+	Schema string `json:"schema" yaml:"schema"`
+	Size   string `json:"size" yaml:"size"`
+}
+
+func (r *InventoryReport) setError(section, msg string) {
+	if r.Errors == nil {
+		r.Errors = map[string]string{}
+	}
+	r.Errors[section] = msg
+}
+
+func printReportText(r *InventoryReport) {
+	utils.PrintHeader("USER ACCOUNTS")
+	if msg, ok := r.Errors[sectionRoles]; ok {
+		fmt.Println(msg)
+	}
+	for _, role := range r.Roles {
+		fmt.Printf("  |-- %-30s | Super: %-3s | NoPass: %-3s | Login: %s\n",
+			role.Name, yesNo(role.Superuser), yesNo(role.NoPassword), yesNo(role.CanLogin))
+	}
+
+	utils.PrintHeader("DATA ACCESS PERMISSIONS")
+	if msg, ok := r.Errors[sectionDataAccess]; ok {
+		fmt.Println(msg)
+	}
+	for _, access := range r.DataAccess {
+		if access.Error != "" {
+			fmt.Printf("  |-- Unable to read %s: %s\n", access.Database, access.Error)
+			continue
+		}
+		fmt.Printf("  |-- Database: %s\n", access.Database)
+		for _, u := range access.Users {
+			if u.Connect || u.Read {
+				fmt.Printf("        |-- User: %-15s | Conn: %-3s | Read: %-3s | Write: %s\n",
+					u.User, yesNo(u.Connect), yesNo(u.Read), yesNo(u.Write))
+			}
+		}
+	}
+
+	utils.PrintHeader("INSTANCE CONTENT INVENTORY")
+	if msg, ok := r.Errors[sectionDatabases]; ok {
+		fmt.Println(msg)
+	}
+	for _, d := range r.Databases {
+		if d.Size == "" {
+			fmt.Printf("  |-- Error querying %s: %s\n", d.Name, d.Error)
+			continue
+		}
+		fmt.Printf("  |-- DATABASE: %s (SIZE: %s)\n", d.Name, d.Size)
+		if d.Error != "" {
+			fmt.Printf("        |-- Error reading tables: %s\n", d.Error)
+			continue
+		}
+		for _, t := range d.Tables {
+			fmt.Printf("        |-- %-35s | Size: %s\n", t.Name, t.Size)
+		}
+	}
+
+	printPersistenceText(r)
+	printHBAText(r)
+	printSettingsText(r)
+	utils.PrintFindings(r.Findings)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
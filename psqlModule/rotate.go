@@ -0,0 +1,148 @@
+package psqlModule
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotateExclude  []string
+	rotateOutFile  string
+	passwordLength int
+)
+
+func getRotateCmd() *cobra.Command {
+	rotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the password of every PostgreSQL login role.",
+		Long: `Generate a strong random password for every login role in pg_roles and
+apply it with ALTER ROLE ... PASSWORD.
+
+Passwords are SCRAM-SHA-256 hashed before they are sent, so the plaintext
+never reaches the server logs. The new credentials are written to a file only
+the owner can read. Roles can be skipped with --exclude.`,
+		RunE:         runRotate,
+		SilenceUsage: true,
+	}
+	rotateCmd.Flags().StringSliceVarP(&rotateExclude, "exclude", "e", nil, "Roles to skip")
+	rotateCmd.Flags().StringVar(&rotateOutFile, "out", "", "File to write the new credentials to (default psql-credentials-<timestamp>.txt)")
+	rotateCmd.Flags().IntVar(&passwordLength, "length", 24, "Length of the generated passwords")
+	rotateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the roles without changing them")
+	rotateCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Rotate without asking for confirmation")
+	rotateCmd.Flags().StringVar(&changeLog, "log", "ccdc-changes.log", "File to record applied changes in")
+	return rotateCmd
+}
+
+func runRotate(cmd *cobra.Command, args []string) error {
+	if passwordLength < 12 {
+		return fmt.Errorf("--length must be at least 12")
+	}
+
+	password, err := utils.GetPassword()
+	if err != nil {
+		return fmt.Errorf("failed to read password")
+	}
+
+	db, err := connectToDatabase(username, password, host, port)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Use a single connection throughout: if our own role is rotated the pool
+	// would not be able to open new ones
+	ctx := context.Background()
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("could not acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, "SELECT rolname FROM pg_roles WHERE rolcanlogin ORDER BY rolname;")
+	if err != nil {
+		return fmt.Errorf("could not list roles: %v", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("could not list roles: %v", err)
+	}
+
+	var roles []string
+	for _, name := range names {
+		if slices.Contains(rotateExclude, name) {
+			fmt.Printf("  [-] Skipping %s (excluded)\n", name)
+			continue
+		}
+		roles = append(roles, name)
+	}
+
+	utils.PrintHeader("PASSWORD ROTATION")
+	for _, role := range roles {
+		fmt.Printf("  |-- %s\n", role)
+	}
+	if len(roles) == 0 {
+		fmt.Println("No roles to rotate")
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("Dry run: %d role(s) would be rotated\n", len(roles))
+		return nil
+	}
+	if !assumeYes && !utils.Confirm(fmt.Sprintf("Rotate %d role(s)?", len(roles))) {
+		return nil
+	}
+
+	if rotateOutFile == "" {
+		rotateOutFile = fmt.Sprintf("psql-credentials-%s.txt", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	out, err := utils.CreatePrivateFile(rotateOutFile)
+	if err != nil {
+		return fmt.Errorf("could not create credentials file: %v", err)
+	}
+	defer out.Close()
+	fmt.Fprintf(out, "# PostgreSQL %s:%d rotated %s\n", host, port, time.Now().UTC().Format(time.RFC3339))
+
+	log := utils.NewChangeLog(changeLog, fmt.Sprintf("psql %s:%d", host, port))
+	failed := 0
+	for _, role := range roles {
+		newPassword, err := utils.GeneratePassword(passwordLength)
+		if err != nil {
+			return err
+		}
+		verifier, err := scramVerifier(newPassword)
+		if err != nil {
+			return err
+		}
+
+		stmt := fmt.Sprintf("ALTER ROLE %s PASSWORD '%s';", quoteIdent(role), strings.ReplaceAll(verifier, "'", "''"))
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			fmt.Printf("  [!] %s: %v\n", role, err)
+			log.Record("FAILED", "Rotate password for "+role, nil)
+			failed++
+			continue
+		}
+
+		// Write each credential as soon as it is applied so a later failure
+		// can't leave a role with an unknown password
+		if _, err := fmt.Fprintf(out, "%s\t%s\n", role, newPassword); err != nil {
+			return fmt.Errorf("could not write credentials file: %v", err)
+		}
+		out.Sync()
+		log.Record("APPLIED", "Rotate password for "+role, nil)
+		fmt.Printf("  [+] %s\n", role)
+	}
+
+	fmt.Printf("Rotated %d of %d role(s), credentials written to %s\n", len(roles)-failed, len(roles), rotateOutFile)
+	if slices.Contains(roles, username) {
+		fmt.Printf("Note: the password for %s was rotated, use the new one from %s\n", username, rotateOutFile)
+	}
+	return nil
+}
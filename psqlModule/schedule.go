@@ -0,0 +1,49 @@
+package psqlModule
+
+import (
+	"ccdc-cli/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var schedule utils.Schedule
+
+func getBackupCmd() *cobra.Command {
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Take backups on a schedule.",
+		Long: `Takes a backup into --backup-dir now and then every --every, pruning old
+backups with --keep and --keep-within after each one. The password and backup
+passphrase are asked for once, so no cron job needs them on its command line.
+
+Every run is logged with its result and duration. A failed run prints an
+[ALERT] line and runs --alert-cmd with the message in $CCDC_ALERT_MESSAGE, then
+the schedule carries on. SIGINT or SIGTERM stops it, cancelling a running
+backup whose partial file is removed.
+
+With --daemon the schedule runs in the background with its output appended to
+--log-file.`,
+		RunE:         runScheduledBackup,
+		SilenceUsage: true,
+	}
+	addBackupFlags(backupCmd)
+	backupCmd.Flags().DurationVar(&schedule.Every, "every", 0, "Take a backup this often, e.g. 15m")
+	backupCmd.Flags().BoolVar(&schedule.Daemon, "daemon", false, "Run the schedule in the background")
+	backupCmd.Flags().StringVar(&schedule.LogFile, "log-file", "", "With --daemon, append the log to this file")
+	backupCmd.Flags().StringVar(&schedule.AlertCmd, "alert-cmd", "", "Shell command run when a backup fails")
+	backupCmd.MarkFlagRequired("every")
+	backupCmd.MarkFlagRequired("backup-dir")
+	backupCmd.MarkFlagsRequiredTogether("daemon", "log-file")
+	return backupCmd
+}
+
+func runScheduledBackup(cmd *cobra.Command, args []string) error {
+	if err := parseBackupFlags(); err != nil {
+		return err
+	}
+	job, err := prepareBackup()
+	if err != nil {
+		return err
+	}
+	return utils.RunSchedule(schedule, "PostgreSQL backup", job.run)
+}
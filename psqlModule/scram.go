@@ -0,0 +1,49 @@
+package psqlModule
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// scramIterations matches the server default (scram_iterations).
+const scramIterations = 4096
+
+// scramVerifier hashes password into the SCRAM-SHA-256 secret format that
+// PostgreSQL stores in pg_authid. Sending the verifier in ALTER ROLE keeps
+// the plaintext password out of the server logs.
+func scramVerifier(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return saltedScramVerifier(password, salt, scramIterations)
+}
+
+// saltedScramVerifier is scramVerifier with a given salt and iteration count.
+func saltedScramVerifier(password string, salt []byte, iterations int) (string, error) {
+	saltedPassword, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(saltedPassword, "Server Key")
+
+	enc := base64.StdEncoding
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s",
+		iterations,
+		enc.EncodeToString(salt),
+		enc.EncodeToString(storedKey[:]),
+		enc.EncodeToString(serverKey)), nil
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,45 @@
+package psqlModule
+
+import (
+	"encoding/base64"
+	"regexp"
+	"testing"
+)
+
+func TestSaltedScramVerifier(t *testing.T) {
+	// The password, salt and iterations of the RFC 7677 example exchange;
+	// its ServerKey reproduces the server signature the RFC gives.
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	tests := []struct {
+		password   string
+		salt       []byte
+		iterations int
+		want       string
+	}{
+		{"pencil", salt, 4096, "SCRAM-SHA-256$4096:W22ZaJ0SNY7soEsUEjb6gQ==$WG5d8oPm3OtcPnkdi4Uo7BkeZkBFzpcXkuLmtbsT4qY=:wfPLwcE6nTWhTAmQ7tl2KeoiWGPlZqQxSrmfPwDl2dU="},
+	}
+	for _, tt := range tests {
+		got, err := saltedScramVerifier(tt.password, tt.salt, tt.iterations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("saltedScramVerifier(%q) =\n %s\nwant\n %s", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestScramVerifierFormat(t *testing.T) {
+	format := regexp.MustCompile(`^SCRAM-SHA-256\$4096:[A-Za-z0-9+/]{22}==\$[A-Za-z0-9+/]{43}=:[A-Za-z0-9+/]{43}=$`)
+	a, err := scramVerifier("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := scramVerifier("secret")
+	if !format.MatchString(a) {
+		t.Errorf("verifier %q is not in the pg_authid format", a)
+	}
+	if a == b {
+		t.Error("two verifiers of the same password share a salt")
+	}
+}
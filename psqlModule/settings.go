@@ -0,0 +1,229 @@
+package psqlModule
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SettingCheck is a security relevant runtime parameter from pg_settings with
+// its rating.
+type SettingCheck struct {
+	Name        string         `json:"name" yaml:"name"`
+	Value       string         `json:"value" yaml:"value"`
+	Source      string         `json:"source" yaml:"source"`
+	File        string         `json:"file,omitempty" yaml:"file,omitempty"`
+	AlterSystem bool           `json:"alter_system" yaml:"alter_system"`
+	Passed      bool           `json:"passed" yaml:"passed"`
+	Severity    utils.Severity `json:"severity" yaml:"severity"`
+	Note        string         `json:"note,omitempty" yaml:"note,omitempty"`
+}
+
+// AutoConfEntry is a parameter written to postgresql.auto.conf by ALTER
+// SYSTEM, whether or not it has been applied yet.
+type AutoConfEntry struct {
+	Name    string `json:"name" yaml:"name"`
+	Value   string `json:"value" yaml:"value"`
+	Applied bool   `json:"applied" yaml:"applied"`
+}
+
+type settingRule struct {
+	name string
+	// rate returns whether the value is acceptable, otherwise the severity
+	// and a note explaining why
+	rate func(value string) (bool, utils.Severity, string)
+}
+
+// knownPreloadLibraries are common, legitimate shared_preload_libraries.
+var knownPreloadLibraries = []string{
+	"pg_stat_statements", "auto_explain", "pgaudit", "pg_cron", "timescaledb",
+	"citus", "pglogical", "pg_partman_bgw", "pg_hint_plan", "pg_wait_sampling",
+	"pg_prewarm", "pg_squeeze", "pg_qualstats", "pg_stat_kcache", "passwordcheck",
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.Trim(strings.TrimSpace(item), `"`); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func requireOn(severity utils.Severity, note string) func(string) (bool, utils.Severity, string) {
+	return func(value string) (bool, utils.Severity, string) {
+		if value == "on" {
+			return true, severity, ""
+		}
+		return false, severity, note
+	}
+}
+
+var settingRules = []settingRule{
+	{"listen_addresses", func(value string) (bool, utils.Severity, string) {
+		for _, addr := range splitList(value) {
+			if addr == "*" || addr == "0.0.0.0" || addr == "::" {
+				return false, utils.SeverityMedium, "listens on every interface, restrict to the addresses clients use"
+			}
+		}
+		return true, utils.SeverityMedium, ""
+	}},
+	{"ssl", requireOn(utils.SeverityHigh, "connections and passwords travel unencrypted")},
+	{"password_encryption", func(value string) (bool, utils.Severity, string) {
+		if value == "scram-sha-256" {
+			return true, utils.SeverityMedium, ""
+		}
+		return false, utils.SeverityMedium, "new passwords are stored as weak MD5 hashes, set scram-sha-256"
+	}},
+	{"log_connections", requireOn(utils.SeverityLow, "logins are not logged")},
+	{"log_disconnections", requireOn(utils.SeverityLow, "session ends are not logged")},
+	{"log_statement", func(value string) (bool, utils.Severity, string) {
+		if value == "ddl" || value == "mod" || value == "all" {
+			return true, utils.SeverityLow, ""
+		}
+		return false, utils.SeverityLow, "schema and role changes are not logged, set at least ddl"
+	}},
+	{"shared_preload_libraries", func(value string) (bool, utils.Severity, string) {
+		var unknown []string
+		for _, lib := range splitList(value) {
+			if !slices.Contains(knownPreloadLibraries, lib) {
+				unknown = append(unknown, lib)
+			}
+		}
+		if len(unknown) > 0 {
+			return false, utils.SeverityHigh, "loads unknown libraries into the server: " + strings.Join(unknown, ", ")
+		}
+		return true, utils.SeverityHigh, ""
+	}},
+	{"session_preload_libraries", func(value string) (bool, utils.Severity, string) {
+		if value == "" {
+			return true, utils.SeverityHigh, ""
+		}
+		return false, utils.SeverityHigh, "native code is loaded into every session"
+	}},
+	{"local_preload_libraries", func(value string) (bool, utils.Severity, string) {
+		if value == "" {
+			return true, utils.SeverityHigh, ""
+		}
+		return false, utils.SeverityHigh, "native code from $libdir/plugins is loaded into every session"
+	}},
+	{"allow_system_table_mods", func(value string) (bool, utils.Severity, string) {
+		if value == "off" {
+			return true, utils.SeverityHigh, ""
+		}
+		return false, utils.SeverityHigh, "system catalogs can be modified directly"
+	}},
+}
+
+func settingsAudit(db *pgxpool.Pool, report *InventoryReport) {
+	names := make([]string, len(settingRules))
+	for i, rule := range settingRules {
+		names[i] = rule.name
+	}
+
+	query := `
+	SELECT name, setting, source, COALESCE(sourcefile, ''), COALESCE(sourceline, 0)
+	FROM pg_settings WHERE name = ANY($1);`
+
+	rows, err := db.Query(context.Background(), query, names)
+	if err != nil {
+		report.setError(sectionSettings, fmt.Sprintf("Error querying pg_settings: %v", err))
+		return
+	}
+
+	found := map[string]SettingCheck{}
+	hiddenFiles := false
+	for rows.Next() {
+		var s SettingCheck
+		var file string
+		var line int
+		if err := rows.Scan(&s.Name, &s.Value, &s.Source, &file, &line); err != nil {
+			continue
+		}
+		if file != "" {
+			s.File = fmt.Sprintf("%s:%d", file, line)
+		} else if s.Source == "configuration file" {
+			hiddenFiles = true
+		}
+		if strings.HasSuffix(file, "postgresql.auto.conf") {
+			s.AlterSystem = true
+			s.Source = "ALTER SYSTEM (postgresql.auto.conf)"
+		}
+		found[s.Name] = s
+	}
+	rows.Close()
+
+	for _, rule := range settingRules {
+		s, ok := found[rule.name]
+		if !ok {
+			continue
+		}
+		s.Passed, s.Severity, s.Note = rule.rate(s.Value)
+		report.Settings = append(report.Settings, s)
+	}
+
+	// The source column says "configuration file" for postgresql.auto.conf
+	// as well, only sourcefile tells them apart. Both sourcefile and
+	// pg_file_settings need superuser or pg_read_all_settings.
+	rows, err = db.Query(context.Background(), `
+	SELECT name, COALESCE(setting, ''), applied FROM pg_file_settings
+	WHERE sourcefile LIKE '%postgresql.auto.conf' ORDER BY seqno;`)
+	if err != nil {
+		report.setError(sectionSettings, fmt.Sprintf("ALTER SYSTEM detection unavailable, pg_file_settings needs superuser or pg_read_all_settings: %v", err))
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AutoConfEntry
+		if err := rows.Scan(&e.Name, &e.Value, &e.Applied); err != nil {
+			continue
+		}
+		report.AlterSystem = append(report.AlterSystem, e)
+	}
+	if hiddenFiles {
+		report.setError(sectionSettings, "ALTER SYSTEM detection incomplete, pg_settings.sourcefile is hidden without superuser or pg_read_all_settings")
+	}
+}
+
+func printSettingsText(r *InventoryReport) {
+	utils.PrintHeader("SECURITY SETTINGS (PG_SETTINGS)")
+	if msg, ok := r.Errors[sectionSettings]; ok {
+		fmt.Println(msg)
+	}
+
+	fmt.Printf("  %-8s %-26s | %-25s | %s\n", "", "Setting", "Value", "Source")
+	for _, s := range r.Settings {
+		status := "OK"
+		if !s.Passed {
+			status = strings.ToUpper(s.Severity.String())
+		}
+		source := s.Source
+		if s.File != "" {
+			source += " " + s.File
+		}
+		if s.AlterSystem {
+			source = "[ALTER SYSTEM] " + source
+		}
+		fmt.Printf("  [%-6s] %-26s | %-25s | %s\n", status, s.Name, utils.Truncate(s.Value, 25), source)
+		if s.Note != "" {
+			fmt.Printf("           |-- %s\n", s.Note)
+		}
+	}
+
+	if len(r.AlterSystem) > 0 {
+		fmt.Println("\n  Values set with ALTER SYSTEM (postgresql.auto.conf):")
+		for _, e := range r.AlterSystem {
+			applied := "applied"
+			if !e.Applied {
+				applied = "pending reload/restart"
+			}
+			fmt.Printf("  [!] %-26s = %-25s | %s\n", e.Name, e.Value, applied)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package psqlModule
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ccdc-cli/utils"
+)
+
+// safetySnapshot backs up the databases on the server a restore is about to
+// overwrite, one file each, into a new directory next to the backup. It
+// returns "" when no existing database is affected.
+func safetySnapshot(password string) (string, error) {
+	all, err := serverDatabases(password)
+	if err != nil {
+		return "", err
+	}
+	var dbs []string
+	for _, db := range all {
+		if selector.IncludesDatabase(db) {
+			dbs = append(dbs, db)
+		}
+	}
+	if len(dbs) == 0 {
+		fmt.Println("No existing databases are affected, skipping the safety snapshot")
+		return "", nil
+	}
+
+	dir := snapshotDir
+	if dir == "" {
+		dir = filepath.Dir(filepath.Clean(file))
+	}
+	path := filepath.Join(dir, utils.SnapshotName(host, port, "postgres", time.Now()))
+	job := &backupJob{password: password, useNative: !utils.CheckCliCmdExist("pg_dump")}
+	if job.useNative {
+		// the native engine writes no DROP statements, rolling back part of
+		// a database would add its rows to the ones the restore left
+		for _, db := range dbs {
+			if selector.NarrowsDatabase(db) {
+				fmt.Printf("[WARN] pg_dump not found, a rollback of the selected tables in %s may duplicate rows\n", db)
+			}
+		}
+	}
+	fmt.Printf("Taking a safety snapshot of %s into %s\n", strings.Join(dbs, ", "), path)
+	if err := job.backupDatabases(context.Background(), path, dbs); err != nil {
+		os.RemoveAll(path)
+		return "", err
+	}
+	fmt.Println("Safety snapshot complete, roles and their memberships are not part of it")
+	return path, nil
+}
+
+// offerRollback asks to put the databases saved by safetySnapshot back after
+// a failed restore. Databases restored whole are dropped and created again
+// first so nothing the failed restore created is left behind.
+func offerRollback(snapshot, password string) {
+	if snapshot == "" {
+		return
+	}
+	if !utils.Confirm(fmt.Sprintf("Roll back to the safety snapshot %s?", snapshot)) {
+		fmt.Printf("Not rolling back, the snapshot is kept in %s\n", snapshot)
+		return
+	}
+	targets, err := utils.RestoreTargets(snapshot, nil)
+	if err == nil {
+		for _, t := range targets {
+			if err = rollbackDatabase(t, password); err != nil {
+				err = fmt.Errorf("%s: %w", t.Database, err)
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("Rollback failed: %v\n", err)
+		fmt.Printf("The snapshot is kept in %s\n", snapshot)
+		return
+	}
+	fmt.Printf("Rolled back to the safety snapshot %s\n", snapshot)
+}
+
+func rollbackDatabase(t utils.RestoreTarget, password string) error {
+	if err := utils.CheckBeforeRestore(t.Path, "postgres", false); err != nil {
+		return err
+	}
+	in, err := utils.OpenBackup(t.Path, utils.DecryptKeys{})
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if !selector.NarrowsDatabase(t.Database) {
+		if err := dropDatabase(password, t.Database); err != nil {
+			return err
+		}
+	}
+	if err := ensureDatabase(password, t.Database); err != nil {
+		return err
+	}
+	fmt.Printf("Rolling back %s from %s\n", t.Database, t.Path)
+	br := bufio.NewReader(in)
+	return loadDump(br, t.Database, password, !isNativeDump(br))
+}
+
+// dropDatabase drops database name, disconnecting its sessions.
+func dropDatabase(password, name string) error {
+	db, err := connectToDatabaseDB(username, password, host, port, maintenanceDB(name), false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// WITH (FORCE) needs PostgreSQL 13
+	_, err = db.Exec(context.Background(), "DROP DATABASE IF EXISTS "+quoteIdent(name)+" WITH (FORCE)")
+	return err
+}
+
+// maintenanceDB is the database to connect to while creating or dropping
+// database name.
+func maintenanceDB(name string) string {
+	if name == "postgres" {
+		return "template1"
+	}
+	return "postgres"
+}
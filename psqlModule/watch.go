@@ -0,0 +1,299 @@
+package psqlModule
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"ccdc-cli/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval  time.Duration
+	trustedAddrs   []string
+	terminatePIDs  []int32
+	cancelPIDs     []int32
+	terminateRoles []string
+	terminateAddrs []string
+	cancelRoles    []string
+	cancelAddrs    []string
+)
+
+type backend struct {
+	PID     int32
+	Addr    string
+	Role    string
+	DB      string
+	State   string
+	SSL     bool
+	Query   string
+	Trusted bool
+}
+
+func getWatchCmd() *cobra.Command {
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Monitor and terminate live PostgreSQL sessions.",
+		Long: `Poll pg_stat_activity and print every client session with its address,
+role, database, state, SSL status and current query. Sessions from addresses
+outside --trusted are flagged.
+
+Backends can be stopped with --terminate, --cancel, --terminate-user,
+--terminate-addr, --cancel-user and --cancel-addr, or while watching by typing
+one of:
+  t <pid>     terminate the backend with this pid
+  c <pid>     cancel the running query of this pid
+  u <role>    terminate every backend of this role
+  a <addr>    terminate every backend from this client address
+  cu <role>   cancel the running queries of this role
+  ca <addr>   cancel the running queries from this client address
+  q           quit`,
+		RunE:         runWatch,
+		SilenceUsage: true,
+	}
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 5*time.Second, "Time between polls")
+	watchCmd.Flags().StringSliceVar(&trustedAddrs, "trusted", []string{"127.0.0.1/32", "::1/128"}, "Trusted client addresses or CIDR ranges")
+	watchCmd.Flags().Int32SliceVar(&terminatePIDs, "terminate", nil, "Terminate the backends with these pids and exit")
+	watchCmd.Flags().Int32SliceVar(&cancelPIDs, "cancel", nil, "Cancel the queries of these pids and exit")
+	watchCmd.Flags().StringSliceVar(&terminateRoles, "terminate-user", nil, "Terminate every backend of these roles and exit")
+	watchCmd.Flags().StringSliceVar(&terminateAddrs, "terminate-addr", nil, "Terminate every backend from these client addresses and exit")
+	watchCmd.Flags().StringSliceVar(&cancelRoles, "cancel-user", nil, "Cancel the queries of every backend of these roles and exit")
+	watchCmd.Flags().StringSliceVar(&cancelAddrs, "cancel-addr", nil, "Cancel the queries of every backend from these client addresses and exit")
+	return watchCmd
+}
+
+func parseTrusted(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted address %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted range %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func isTrusted(addr string, trusted []netip.Prefix) bool {
+	// Unix socket connections have no client address
+	if addr == "local" {
+		return true
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range trusted {
+		if prefix.Contains(ip.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	trusted, err := parseTrusted(trustedAddrs)
+	if err != nil {
+		return err
+	}
+
+	password, err := utils.GetPassword()
+	if err != nil {
+		return fmt.Errorf("failed to read password")
+	}
+
+	db, err := connectToDatabase(username, password, host, port)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(terminatePIDs) > 0 || len(cancelPIDs) > 0 || len(terminateRoles) > 0 || len(terminateAddrs) > 0 ||
+		len(cancelRoles) > 0 || len(cancelAddrs) > 0 {
+		for _, pid := range terminatePIDs {
+			signalBackend(db, "pg_terminate_backend", pid)
+		}
+		for _, pid := range cancelPIDs {
+			signalBackend(db, "pg_cancel_backend", pid)
+		}
+		for _, role := range terminateRoles {
+			signalMatching(db, "pg_terminate_backend", func(b backend) bool { return b.Role == role })
+		}
+		for _, addr := range terminateAddrs {
+			signalMatching(db, "pg_terminate_backend", func(b backend) bool { return b.Addr == addr })
+		}
+		for _, role := range cancelRoles {
+			signalMatching(db, "pg_cancel_backend", func(b backend) bool { return b.Role == role })
+		}
+		for _, addr := range cancelAddrs {
+			signalMatching(db, "pg_cancel_backend", func(b backend) bool { return b.Addr == addr })
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	commands := utils.CommandLines()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		backends, err := listBackends(db, trusted)
+		if err != nil {
+			fmt.Printf("Error reading pg_stat_activity: %v\n", err)
+		} else {
+			printBackends(backends)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case line, ok := <-commands:
+			if !ok {
+				commands = nil
+				continue
+			}
+			if !handleWatchCommand(db, line) {
+				return nil
+			}
+		}
+	}
+}
+
+func listBackends(db *pgxpool.Pool, trusted []netip.Prefix) ([]backend, error) {
+	query := `
+	SELECT a.pid, COALESCE(host(a.client_addr), 'local'), COALESCE(a.usename, ''),
+	COALESCE(a.datname, ''), COALESCE(a.state, ''), COALESCE(s.ssl, false), COALESCE(a.query, '')
+	FROM pg_stat_activity a LEFT JOIN pg_stat_ssl s ON s.pid = a.pid
+	WHERE a.backend_type = 'client backend' AND a.pid <> pg_backend_pid()
+	ORDER BY a.backend_start;`
+
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backends []backend
+	for rows.Next() {
+		var b backend
+		if err := rows.Scan(&b.PID, &b.Addr, &b.Role, &b.DB, &b.State, &b.SSL, &b.Query); err != nil {
+			return nil, err
+		}
+		b.Trusted = isTrusted(b.Addr, trusted)
+		backends = append(backends, b)
+	}
+	return backends, rows.Err()
+}
+
+func printBackends(backends []backend) {
+	utils.PrintHeader(fmt.Sprintf("POSTGRESQL SESSIONS @ %s", time.Now().Format("15:04:05")))
+	fmt.Printf("  %-4s %-8s | %-18s | %-14s | %-12s | %-20s | %-3s | %s\n", "", "PID", "Client", "Role", "Database", "State", "SSL", "Query")
+
+	untrusted := 0
+	for _, b := range backends {
+		marker := "    "
+		if !b.Trusted {
+			marker = "[!] "
+			untrusted++
+		}
+		fmt.Printf("  %s %-8d | %-18s | %-14s | %-12s | %-20s | %-3s | %s\n",
+			marker, b.PID, b.Addr, b.Role, b.DB, b.State, yesNo(b.SSL), utils.Truncate(b.Query, 80))
+	}
+	if untrusted > 0 {
+		fmt.Printf("\n  [!] %d session(s) from untrusted addresses\n", untrusted)
+	}
+	fmt.Println("\n  Commands: t <pid> | c <pid> | u <role> | a <addr> | cu <role> | ca <addr> | q")
+}
+
+// handleWatchCommand runs a command typed during watch and reports whether
+// watching should continue.
+func handleWatchCommand(db *pgxpool.Pool, line string) bool {
+	fields := strings.Fields(line)
+	if fields[0] == "q" {
+		return false
+	}
+	if len(fields) != 2 {
+		fmt.Println("Usage: t <pid> | c <pid> | u <role> | a <addr> | cu <role> | ca <addr> | q")
+		return true
+	}
+
+	switch fields[0] {
+	case "t", "c":
+		pid, err := strconv.ParseInt(fields[1], 10, 32)
+		if err != nil {
+			fmt.Printf("Invalid pid: %s\n", fields[1])
+			return true
+		}
+		fn := "pg_terminate_backend"
+		if fields[0] == "c" {
+			fn = "pg_cancel_backend"
+		}
+		signalBackend(db, fn, int32(pid))
+	case "u":
+		signalMatching(db, "pg_terminate_backend", func(b backend) bool { return b.Role == fields[1] })
+	case "a":
+		signalMatching(db, "pg_terminate_backend", func(b backend) bool { return b.Addr == fields[1] })
+	case "cu":
+		signalMatching(db, "pg_cancel_backend", func(b backend) bool { return b.Role == fields[1] })
+	case "ca":
+		signalMatching(db, "pg_cancel_backend", func(b backend) bool { return b.Addr == fields[1] })
+	default:
+		fmt.Println("Usage: t <pid> | c <pid> | u <role> | a <addr> | cu <role> | ca <addr> | q")
+	}
+	return true
+}
+
+// signalBackend calls pg_terminate_backend or pg_cancel_backend for pid.
+func signalBackend(db *pgxpool.Pool, fn string, pid int32) {
+	var ok bool
+	err := db.QueryRow(context.Background(), fmt.Sprintf("SELECT %s($1);", fn), pid).Scan(&ok)
+	if err != nil {
+		fmt.Printf("  [!] %s(%d) failed: %v\n", fn, pid, err)
+		return
+	}
+	if !ok {
+		fmt.Printf("  [!] %s(%d): no such backend\n", fn, pid)
+		return
+	}
+	fmt.Printf("  [+] %s(%d)\n", fn, pid)
+}
+
+// signalMatching calls fn for every backend match accepts.
+func signalMatching(db *pgxpool.Pool, fn string, match func(backend) bool) {
+	backends, err := listBackends(db, nil)
+	if err != nil {
+		fmt.Printf("Error reading pg_stat_activity: %v\n", err)
+		return
+	}
+
+	matched := 0
+	for _, b := range backends {
+		if match(b) {
+			signalBackend(db, fn, b.PID)
+			matched++
+		}
+	}
+	if matched == 0 {
+		fmt.Println("  No matching backends")
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// Confirm asks a yes/no question on the terminal. Anything other than an
+// explicit yes is treated as no.
+func Confirm(prompt string) bool {
+	fmt.Printf("%s [y/N]: ", prompt)
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// ChangeLog appends a timestamped record of every change made to a server so
+// it can be cited later (e.g. in inject reports).
+type ChangeLog struct {
+	path   string
+	target string
+}
+
+func NewChangeLog(path, target string) *ChangeLog {
+	return &ChangeLog{path: path, target: target}
+}
+
+func (l *ChangeLog) Record(status, description string, statements []string) error {
+	if l == nil || l.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "%s [%s] %s: %s\n", time.Now().UTC().Format(time.RFC3339), l.target, status, description)
+	for _, stmt := range statements {
+		fmt.Fprintf(f, "    %s\n", stmt)
+	}
+	return nil
+}
+
+// Action is a single change to a server made of the statements that
+// implement it.
+type Action struct {
+	Description string
+	Statements  []string
+	// Exec overrides ActionRunner.Exec for this action, e.g. when the
+	// statements have to run against a different database
+	Exec func(stmt string) error
+}
+
+// ActionRunner applies actions one by one, asking for confirmation unless
+// AssumeYes is set and only printing the statements when DryRun is set.
+type ActionRunner struct {
+	DryRun    bool
+	AssumeYes bool
+	Exec      func(stmt string) error
+	Log       *ChangeLog
+
+	Applied []Action
+	Skipped []Action
+	Failed  []Action
+}
+
+func (r *ActionRunner) Run(a Action) {
+	fmt.Printf("\n[*] %s\n", a.Description)
+	for _, stmt := range a.Statements {
+		fmt.Printf("    %s\n", stmt)
+	}
+
+	if r.DryRun {
+		r.Skipped = append(r.Skipped, a)
+		return
+	}
+	if !r.AssumeYes && !Confirm("    Apply this change?") {
+		fmt.Println("    Skipped")
+		r.Skipped = append(r.Skipped, a)
+		return
+	}
+
+	exec := r.Exec
+	if a.Exec != nil {
+		exec = a.Exec
+	}
+	for i, stmt := range a.Statements {
+		if err := exec(stmt); err != nil {
+			fmt.Printf("    Failed: %v\n", err)
+			r.Failed = append(r.Failed, a)
+			if err := r.Log.Record("FAILED", a.Description, a.Statements[:i+1]); err != nil {
+				fmt.Printf("    Could not write change log: %v\n", err)
+			}
+			return
+		}
+	}
+
+	fmt.Println("    Applied")
+	r.Applied = append(r.Applied, a)
+	if err := r.Log.Record("APPLIED", a.Description, a.Statements); err != nil {
+		fmt.Printf("    Could not write change log: %v\n", err)
+	}
+}
+
+func (r *ActionRunner) PrintSummary() {
+	PrintHeader("SUMMARY")
+	if r.DryRun {
+		fmt.Printf("Dry run: %d change(s) would be made\n", len(r.Skipped))
+		return
+	}
+
+	fmt.Printf("Applied: %d | Skipped: %d | Failed: %d\n", len(r.Applied), len(r.Skipped), len(r.Failed))
+	for _, a := range r.Applied {
+		fmt.Printf("  [+] %s\n", a.Description)
+	}
+	for _, a := range r.Failed {
+		fmt.Printf("  [!] %s\n", a.Description)
+	}
+	if r.Log != nil && r.Log.path != "" && len(r.Applied)+len(r.Failed) > 0 {
+		fmt.Printf("Changes recorded in %s\n", r.Log.path)
+	}
+}
@@ -0,0 +1,289 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported --compress values.
+const (
+	CompressNone = ""
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func ValidateCompression(compression string) error {
+	switch compression {
+	case CompressNone, "none", CompressGzip, CompressZstd:
+		return nil
+	}
+	return fmt.Errorf("invalid compression %q (expected gzip or zstd)", compression)
+}
+
+// BackupOptions controls how a backup file is written.
+type BackupOptions struct {
+	Compression string
+	// Encrypt is applied after compression, nil writes a plain file
+	Encrypt *EncryptOptions
+}
+
+// BackupExtension returns the file name suffix of a backup written with opts.
+func BackupExtension(opts BackupOptions) string {
+	ext := ".sql"
+	switch opts.Compression {
+	case CompressGzip:
+		ext += ".gz"
+	case CompressZstd:
+		ext += ".zst"
+	}
+	if opts.Encrypt != nil {
+		ext += ".enc"
+	}
+	return ext
+}
+
+// backupWriter is a stack of writers over a file. Closing it closes every
+// layer from the outermost in, so compressors flush before the file closes.
+type backupWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *backupWriter) Close() error {
+	var firstErr error
+	for _, c := range w.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// tempSuffix marks a backup that is still being written.
+const tempSuffix = ".tmp"
+
+// TempBackupPath is where a backup to path is written until it is complete,
+// so a failed run leaves an earlier backup at path intact.
+func TempBackupPath(path string) string {
+	return path + tempSuffix
+}
+
+// CommitBackup moves a complete backup from TempBackupPath(path) into place
+// and removes the manifest of the backup it replaces.
+func CommitBackup(path string) error {
+	if err := os.Remove(ManifestPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(TempBackupPath(path), path)
+}
+
+// CreateBackup creates path and returns a writer that compresses, then
+// encrypts, everything written to it as it streams.
+func CreateBackup(path string, opts BackupOptions) (io.WriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := &backupWriter{Writer: f, closers: []io.Closer{f}}
+
+	if opts.Encrypt != nil {
+		ew, err := NewEncryptWriter(f, *opts.Encrypt)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		w.Writer = ew
+		w.closers = append([]io.Closer{ew}, w.closers...)
+	}
+
+	switch opts.Compression {
+	case CompressGzip:
+		gz := gzip.NewWriter(w.Writer)
+		w.Writer = gz
+		w.closers = append([]io.Closer{gz}, w.closers...)
+	case CompressZstd:
+		zw, err := zstd.NewWriter(w.Writer)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		w.Writer = zw
+		w.closers = append([]io.Closer{zw}, w.closers...)
+	}
+	return w, nil
+}
+
+type backupReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *backupReader) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type zstdCloser struct{ *zstd.Decoder }
+
+func (z zstdCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+// OpenBackup opens a backup file and returns its plain SQL. Gzip and zstd
+// files are recognised by their magic bytes and decompressed as they are read.
+// Encrypted files are authenticated in full before OpenBackup returns, so a
+// modified file or wrong key fails before any SQL reaches the server.
+func OpenBackup(path string, keys DecryptKeys) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &backupReader{closers: []io.Closer{f}}
+	src := bufio.NewReader(f)
+
+	magic, _ := src.Peek(len(encryptMagic))
+	if isEncrypted(magic) {
+		keys = cachePassphrase(keys)
+		if err := verifyEncrypted(path, keys); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		plain, err := NewDecryptReader(src, keys)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		src = bufio.NewReader(plain)
+	}
+
+	if err := r.decompress(src); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// cachePassphrase makes keys ask for the passphrase at most once.
+func cachePassphrase(keys DecryptKeys) DecryptKeys {
+	if keys.Passphrase == nil {
+		return keys
+	}
+	ask := keys.Passphrase
+	var cached []byte
+	keys.Passphrase = func() ([]byte, error) {
+		if cached == nil {
+			p, err := ask()
+			if err != nil {
+				return nil, err
+			}
+			cached = p
+		}
+		return cached, nil
+	}
+	return keys
+}
+
+// verifyEncrypted decrypts the whole file without keeping the plaintext.
+func verifyEncrypted(path string, keys DecryptKeys) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	plain, err := NewDecryptReader(f, keys)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, plain)
+	return err
+}
+
+// EncryptionFromFlags returns the encryption for --encrypt and --recipient.
+// Without a recipient the passphrase is prompted for twice.
+func EncryptionFromFlags(encrypt bool, recipient string) (*EncryptOptions, error) {
+	if recipient != "" {
+		key, err := ParseRecipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		return &EncryptOptions{Recipient: key}, nil
+	}
+	if !encrypt {
+		return nil, nil
+	}
+
+	passphrase, err := ReadSecret("Backup Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) < 8 {
+		return nil, fmt.Errorf("the backup passphrase must be at least 8 characters")
+	}
+	again, err := ReadSecret("Repeat Backup Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if again != passphrase {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return &EncryptOptions{Passphrase: []byte(passphrase)}, nil
+}
+
+// DecryptKeysFromFlags returns the keys for --identity, falling back to a
+// passphrase prompt.
+func DecryptKeysFromFlags(identity string) (DecryptKeys, error) {
+	keys := DecryptKeys{Passphrase: func() ([]byte, error) {
+		p, err := ReadSecret("Backup Passphrase: ")
+		return []byte(p), err
+	}}
+	if identity != "" {
+		key, err := LoadIdentity(identity)
+		if err != nil {
+			return keys, err
+		}
+		keys.Identity = key
+	}
+	return keys, nil
+}
+
+// decompress sets the reader to src, unwrapping it if it is compressed.
+func (r *backupReader) decompress(src *bufio.Reader) error {
+	magic, _ := src.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+		r.Reader = gz
+		r.closers = append([]io.Closer{gz}, r.closers...)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(src)
+		if err != nil {
+			return err
+		}
+		r.Reader = zr
+		r.closers = append([]io.Closer{zstdCloser{zr}}, r.closers...)
+	default:
+		r.Reader = src
+	}
+	return nil
+}
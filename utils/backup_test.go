@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupCompressionRoundTrip(t *testing.T) {
+	dump := strings.Repeat("INSERT INTO `t` VALUES (1,'a');\n", 1000)
+
+	for _, compression := range []string{CompressNone, CompressGzip, CompressZstd} {
+		t.Run("compression="+compression, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "backup.sql")
+
+			w, err := CreateBackup(path, BackupOptions{Compression: compression})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, dump); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compression != CompressNone && info.Size() >= int64(len(dump)) {
+				t.Errorf("compressed file is %d bytes, dump is %d", info.Size(), len(dump))
+			}
+
+			r, err := OpenBackup(path, DecryptKeys{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != dump {
+				t.Errorf("restored %d bytes, want the original %d", len(got), len(dump))
+			}
+		})
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	for _, c := range []string{"", "none", "gzip", "zstd"} {
+		if err := ValidateCompression(c); err != nil {
+			t.Errorf("ValidateCompression(%q) = %v", c, err)
+		}
+	}
+	if err := ValidateCompression("bzip2"); err == nil {
+		t.Error("ValidateCompression(bzip2) accepted an unsupported format")
+	}
+}
+
+func TestCommitBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.sql")
+	os.WriteFile(path, []byte("good"), 0600)
+	os.WriteFile(ManifestPath(path), []byte("{}"), 0600)
+
+	os.WriteFile(TempBackupPath(path), []byte("new"), 0600)
+	if IsBackupFile(filepath.Base(TempBackupPath(path))) {
+		t.Error("a backup still being written is taken for a backup file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "good" {
+		t.Fatalf("backup changed to %q before the commit", data)
+	}
+	if err := CommitBackup(path); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("backup is %q, want the new one", data)
+	}
+	if _, err := os.Stat(ManifestPath(path)); !os.IsNotExist(err) {
+		t.Error("the manifest of the replaced backup was left behind")
+	}
+}
@@ -0,0 +1,362 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted backups are a header followed by AES-256-GCM chunks of
+// encryptChunkSize plaintext bytes. Every nonce holds the chunk counter and a
+// final-chunk flag, so reordered, dropped or truncated chunks fail to
+// authenticate. The header is the additional data of every chunk.
+//
+//	magic | mode | key material | nonce prefix (7 bytes)
+//
+// The key material is a scrypt salt and cost for passphrases, or the
+// ephemeral and recipient X25519 public keys for public key encryption.
+var encryptMagic = []byte("CCDCENC1")
+
+const (
+	modePassphrase byte = 1
+	modeRecipient  byte = 2
+
+	encryptChunkSize = 64 * 1024
+	scryptLogN       = 15
+	noncePrefixSize  = 7
+
+	publicKeyPrefix  = "ccdc-pub-"
+	privateKeyPrefix = "ccdc-key-"
+)
+
+// ErrBackupAuth is returned when an encrypted backup was modified or the key
+// is wrong. The two can't be told apart.
+var ErrBackupAuth = errors.New("backup failed authentication: it was modified or the key/passphrase is wrong")
+
+// EncryptOptions selects how a backup is encrypted: with a passphrase or for
+// the holder of the private key matching Recipient.
+type EncryptOptions struct {
+	Passphrase []byte
+	Recipient  *ecdh.PublicKey
+}
+
+// DecryptKeys supplies the key for an encrypted backup. Passphrase is only
+// called for passphrase encrypted files.
+type DecryptKeys struct {
+	Passphrase func() ([]byte, error)
+	Identity   *ecdh.PrivateKey
+}
+
+func isEncrypted(magic []byte) bool {
+	return bytes.HasPrefix(magic, encryptMagic)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func recipientKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	return hkdf.Key(sha256.New, shared, salt, "ccdc-cli backup v1", 32)
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	buf    []byte
+	count  uint32
+}
+
+// NewEncryptWriter returns a writer that encrypts to w. Close writes the
+// final chunk and must be called, it does not close w.
+func NewEncryptWriter(w io.Writer, opts EncryptOptions) (io.WriteCloser, error) {
+	header := append([]byte{}, encryptMagic...)
+	var key []byte
+
+	switch {
+	case opts.Recipient != nil:
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := ephemeral.ECDH(opts.Recipient)
+		if err != nil {
+			return nil, err
+		}
+		ephemeralPub := ephemeral.PublicKey().Bytes()
+		recipientPub := opts.Recipient.Bytes()
+		if key, err = recipientKey(shared, ephemeralPub, recipientPub); err != nil {
+			return nil, err
+		}
+		header = append(header, modeRecipient)
+		header = append(header, ephemeralPub...)
+		header = append(header, recipientPub...)
+	case len(opts.Passphrase) > 0:
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		var err error
+		if key, err = scrypt.Key(opts.Passphrase, salt, 1<<scryptLogN, 8, 1, 32); err != nil {
+			return nil, err
+		}
+		header = append(header, modePassphrase)
+		header = append(header, salt...)
+		header = append(header, scryptLogN)
+	default:
+		return nil, errors.New("encryption needs a passphrase or a recipient key")
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header = append(header, prefix...)
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, header: header, prefix: prefix}, nil
+}
+
+func chunkNonce(prefix []byte, count uint32, final bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, count)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	if e.count == ^uint32(0) {
+		return errors.New("backup too large to encrypt")
+	}
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.count, final), e.buf, e.header)
+	e.count++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// a full buffer is only sealed once more data arrives, the last
+		// chunk has to carry the final flag
+		if len(e.buf) == encryptChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := min(encryptChunkSize-len(e.buf), len(p))
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	count  uint32
+	plain  []byte
+	done   bool
+}
+
+// NewDecryptReader reads the header of an encrypted backup from r and returns
+// a reader of the plaintext. Every chunk is authenticated before it is
+// returned; a modified file fails with ErrBackupAuth.
+func NewDecryptReader(r io.Reader, keys DecryptKeys) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, encryptChunkSize+64)
+	header := make([]byte, len(encryptMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || !isEncrypted(header) {
+		return nil, errors.New("not an encrypted backup")
+	}
+
+	var key []byte
+	switch header[len(encryptMagic)] {
+	case modePassphrase:
+		params := make([]byte, 16+1)
+		if _, err := io.ReadFull(br, params); err != nil {
+			return nil, ErrBackupAuth
+		}
+		header = append(header, params...)
+		if keys.Passphrase == nil {
+			return nil, errors.New("backup is encrypted with a passphrase")
+		}
+		passphrase, err := keys.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		logN := params[16]
+		if logN < 10 || logN > 22 {
+			return nil, ErrBackupAuth
+		}
+		if key, err = scrypt.Key(passphrase, params[:16], 1<<logN, 8, 1, 32); err != nil {
+			return nil, err
+		}
+	case modeRecipient:
+		keyBytes := make([]byte, 64)
+		if _, err := io.ReadFull(br, keyBytes); err != nil {
+			return nil, ErrBackupAuth
+		}
+		header = append(header, keyBytes...)
+		if keys.Identity == nil {
+			return nil, errors.New("backup is encrypted to a public key, pass the private key with --identity")
+		}
+		if !bytes.Equal(keys.Identity.PublicKey().Bytes(), keyBytes[32:]) {
+			return nil, errors.New("backup was encrypted for a different key")
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(keyBytes[:32])
+		if err != nil {
+			return nil, ErrBackupAuth
+		}
+		shared, err := keys.Identity.ECDH(ephemeral)
+		if err != nil {
+			return nil, ErrBackupAuth
+		}
+		if key, err = recipientKey(shared, keyBytes[:32], keyBytes[32:]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown backup encryption mode")
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, ErrBackupAuth
+	}
+	header = append(header, prefix...)
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead, header: header, prefix: prefix}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	sealed := make([]byte, encryptChunkSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, sealed)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		// a missing final chunk means the file was truncated
+		return ErrBackupAuth
+	}
+	sealed = sealed[:n]
+
+	_, peekErr := d.r.Peek(1)
+	final := peekErr == io.EOF
+	plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.count, final), sealed, d.header)
+	if err != nil {
+		return ErrBackupAuth
+	}
+	d.count++
+	d.plain = plain
+	d.done = final
+	return nil
+}
+
+// GenerateKeyPair returns a new private key and its public key, encoded for
+// --identity files and --recipient.
+func GenerateKeyPair() (private, public string, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	private = privateKeyPrefix + base64.RawURLEncoding.EncodeToString(key.Bytes())
+	public = publicKeyPrefix + base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+	return private, public, nil
+}
+
+// readKeyArg returns value, or the first line of the file it names.
+func readKeyArg(value, prefix string) (string, error) {
+	if strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+func decodeKey(encoded, prefix string) ([]byte, error) {
+	if !strings.HasPrefix(encoded, prefix) {
+		return nil, fmt.Errorf("key does not start with %s", prefix)
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimPrefix(encoded, prefix))
+}
+
+// ParseRecipient reads a public key given directly or as a file path.
+func ParseRecipient(value string) (*ecdh.PublicKey, error) {
+	encoded, err := readKeyArg(value, publicKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decodeKey(encoded, publicKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// LoadIdentity reads a private key file written by keygen.
+func LoadIdentity(path string) (*ecdh.PrivateKey, error) {
+	encoded, err := readKeyArg(path, privateKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decodeKey(encoded, privateKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return ecdh.X25519().NewPrivateKey(raw)
+}
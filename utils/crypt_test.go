@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func encryptBytes(t *testing.T, plain []byte, opts EncryptOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptBytes(sealed []byte, keys DecryptKeys) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(sealed), keys)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func passphrase(p string) func() ([]byte, error) {
+	return func() ([]byte, error) { return []byte(p), nil }
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	identity, err := LoadIdentity(mustKeyPair(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := []int{0, 1, encryptChunkSize - 1, encryptChunkSize, encryptChunkSize + 1, 3*encryptChunkSize + 17}
+	for _, size := range sizes {
+		plain := bytes.Repeat([]byte("x"), size)
+
+		sealed := encryptBytes(t, plain, EncryptOptions{Passphrase: []byte("correct horse")})
+		got, err := decryptBytes(sealed, DecryptKeys{Passphrase: passphrase("correct horse")})
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("passphrase, %d bytes: got %d bytes, err %v", size, len(got), err)
+		}
+
+		sealed = encryptBytes(t, plain, EncryptOptions{Recipient: identity.PublicKey()})
+		got, err = decryptBytes(sealed, DecryptKeys{Identity: identity})
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("recipient, %d bytes: got %d bytes, err %v", size, len(got), err)
+		}
+	}
+}
+
+// mustKeyPair returns a generated private key in its encoded form.
+func mustKeyPair(t *testing.T) string {
+	t.Helper()
+	private, public, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseRecipient(public); err != nil {
+		t.Fatal(err)
+	}
+	return private
+}
+
+func TestDecryptRejectsDamage(t *testing.T) {
+	plain := bytes.Repeat([]byte("INSERT INTO t VALUES (1);\n"), 10000)
+	sealed := encryptBytes(t, plain, EncryptOptions{Passphrase: []byte("correct horse")})
+	keys := DecryptKeys{Passphrase: passphrase("correct horse")}
+	headerSize := len(encryptMagic) + 1 + 17 + noncePrefixSize
+	chunk := encryptChunkSize + 16
+
+	flipped := bytes.Clone(sealed)
+	flipped[len(flipped)/2] ^= 1
+	headerFlip := bytes.Clone(sealed)
+	headerFlip[len(encryptMagic)+3] ^= 1
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		keys   DecryptKeys
+	}{
+		{"flipped bit", flipped, keys},
+		{"modified header", headerFlip, keys},
+		{"truncated at chunk boundary", sealed[:headerSize+chunk], keys},
+		{"truncated mid chunk", sealed[:len(sealed)-10], keys},
+		{"dropped chunk", append(bytes.Clone(sealed[:headerSize+chunk]), sealed[headerSize+2*chunk:]...), keys},
+		{"wrong passphrase", sealed, DecryptKeys{Passphrase: passphrase("wrong horse")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decryptBytes(tt.sealed, tt.keys); !errors.Is(err, ErrBackupAuth) {
+				t.Errorf("got %v, want ErrBackupAuth", err)
+			}
+		})
+	}
+}
+
+func TestDecryptWrongIdentity(t *testing.T) {
+	owner, _ := LoadIdentity(mustKeyPair(t))
+	other, _ := LoadIdentity(mustKeyPair(t))
+	sealed := encryptBytes(t, []byte("secret"), EncryptOptions{Recipient: owner.PublicKey()})
+
+	if _, err := decryptBytes(sealed, DecryptKeys{Identity: other}); err == nil {
+		t.Error("decrypted with the wrong private key")
+	}
+	if _, err := decryptBytes(sealed, DecryptKeys{}); err == nil {
+		t.Error("decrypted without a private key")
+	}
+}
+
+func TestOpenBackupVerifiesBeforeReading(t *testing.T) {
+	dump := strings.Repeat("INSERT INTO `t` VALUES (1,'a');\n", 5000)
+	path := filepath.Join(t.TempDir(), "backup.sql.gz.enc")
+	opts := BackupOptions{Compression: CompressGzip, Encrypt: &EncryptOptions{Passphrase: []byte("correct horse")}}
+
+	w, err := CreateBackup(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, dump)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	asked := 0
+	keys := DecryptKeys{Passphrase: func() ([]byte, error) {
+		asked++
+		return []byte("correct horse"), nil
+	}}
+	r, err := OpenBackup(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != dump {
+		t.Fatalf("restored %d bytes, err %v", len(got), err)
+	}
+	if asked != 1 {
+		t.Errorf("passphrase asked %d times, want 1", asked)
+	}
+
+	if _, err := OpenBackup(path, DecryptKeys{Passphrase: passphrase("wrong horse")}); !errors.Is(err, ErrBackupAuth) {
+		t.Errorf("wrong passphrase: got %v, want ErrBackupAuth", err)
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Kinds of change reported by DiffSnapshots.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+type Change struct {
+	Category string `json:"category" yaml:"category"`
+	Kind     string `json:"kind" yaml:"kind"`
+	Key      string `json:"key" yaml:"key"`
+	Old      string `json:"old,omitempty" yaml:"old,omitempty"`
+	New      string `json:"new,omitempty" yaml:"new,omitempty"`
+	Security bool   `json:"security_relevant" yaml:"security_relevant"`
+}
+
+// DiffSnapshots compares two key/value snapshots of the same category and
+// returns every key that was added, removed or whose value changed. Changes
+// are sorted by key so repeated runs print in a stable order.
+func DiffSnapshots(category string, security bool, base, current map[string]string) []Change {
+	var changes []Change
+	for key, newVal := range current {
+		oldVal, ok := base[key]
+		if !ok {
+			changes = append(changes, Change{Category: category, Kind: ChangeAdded, Key: key, New: newVal, Security: security})
+		} else if oldVal != newVal {
+			changes = append(changes, Change{Category: category, Kind: ChangeChanged, Key: key, Old: oldVal, New: newVal, Security: security})
+		}
+	}
+	for key, oldVal := range base {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, Change{Category: category, Kind: ChangeRemoved, Key: key, Old: oldVal, Security: security})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+func HasSecurityChange(changes []Change) bool {
+	for _, c := range changes {
+		if c.Security {
+			return true
+		}
+	}
+	return false
+}
+
+func PrintChanges(changes []Change) {
+	PrintHeader("CHANGES SINCE BASELINE")
+	if len(changes) == 0 {
+		fmt.Println("No changes detected")
+		return
+	}
+
+	for _, c := range changes {
+		marker := " "
+		if c.Security {
+			marker = "!"
+		}
+		switch c.Kind {
+		case ChangeAdded:
+			fmt.Printf("  [%s] %-20s | + %s", marker, c.Category, c.Key)
+			if c.New != "" {
+				fmt.Printf(" = %s", c.New)
+			}
+			fmt.Println()
+		case ChangeRemoved:
+			fmt.Printf("  [%s] %-20s | - %s\n", marker, c.Category, c.Key)
+		case ChangeChanged:
+			fmt.Printf("  [%s] %-20s | ~ %s: %s -> %s\n", marker, c.Category, c.Key, c.Old, c.New)
+		}
+	}
+}
+
+// Fingerprint returns the SHA-256 of s for snapshot values too long to keep
+// whole, such as routine bodies, so that any edit to them is a change.
+func Fingerprint(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// SaveSnapshot writes v as indented JSON to path.
+func SaveSnapshot(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func LoadSnapshot(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("could not parse baseline %s: %w", path, err)
+	}
+	return nil
+}
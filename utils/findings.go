@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Finding is a single security problem found by an inventory check.
+type Finding struct {
+	ID          string   `json:"id" yaml:"id"`
+	Severity    Severity `json:"severity" yaml:"severity"`
+	Target      string   `json:"target" yaml:"target"`
+	Title       string   `json:"title" yaml:"title"`
+	Evidence    string   `json:"evidence,omitempty" yaml:"evidence,omitempty"`
+	Remediation string   `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+}
+
+// ExitCodeFindings is the exit code used when findings reach the --fail-on
+// threshold.
+const ExitCodeFindings = 2
+
+// ExitError carries a specific process exit code up to cmd.Execute.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// SortFindings orders findings from most to least severe, then by ID and
+// target.
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Target < b.Target
+	})
+}
+
+func PrintFindings(findings []Finding) {
+	PrintHeader("SECURITY FINDINGS")
+	if len(findings) == 0 {
+		fmt.Println("  No findings.")
+		return
+	}
+
+	counts := map[Severity]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	var summary []string
+	for s := SeverityCritical; s >= SeverityInfo; s-- {
+		if counts[s] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	fmt.Printf("  %d findings: %s\n\n", len(findings), strings.Join(summary, ", "))
+
+	for _, f := range findings {
+		fmt.Printf("  [%-8s] %-24s %s: %s\n", strings.ToUpper(f.Severity.String()), f.ID, f.Target, f.Title)
+		if f.Evidence != "" {
+			fmt.Printf("             |-- Evidence: %s\n", Truncate(f.Evidence, 100))
+		}
+		if f.Remediation != "" {
+			fmt.Printf("             |-- Fix: %s\n", f.Remediation)
+		}
+	}
+}
+
+// ParseFailOn validates a --fail-on value. An empty value disables the check.
+func ParseFailOn(value string) (Severity, bool, error) {
+	if value == "" {
+		return SeverityInfo, false, nil
+	}
+	s, err := ParseSeverity(value)
+	if err != nil {
+		return SeverityInfo, false, fmt.Errorf("invalid --fail-on: %w", err)
+	}
+	return s, true, nil
+}
+
+// CheckFailOn returns an ExitError when any finding is at least as severe as
+// the --fail-on threshold.
+func CheckFailOn(findings []Finding, failOn string) error {
+	threshold, enabled, err := ParseFailOn(failOn)
+	if err != nil || !enabled {
+		return err
+	}
+
+	count := 0
+	for _, f := range findings {
+		if f.Severity >= threshold {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return &ExitError{
+		Code: ExitCodeFindings,
+		Err:  fmt.Errorf("%d findings at or above %s severity", count, threshold),
+	}
+}
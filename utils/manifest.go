@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Version is the ccdc-cli version recorded in backup manifests. Release
+// builds set it with -ldflags "-X ccdc-cli/utils.Version=...".
+var Version = "dev"
+
+const manifestSuffix = ".manifest.json"
+
+var (
+	ErrNoManifest       = errors.New("backup has no manifest")
+	ErrChecksumMismatch = errors.New("backup does not match its manifest checksum")
+)
+
+// Manifest is written next to every backup so it can be checked for
+// tampering before it is restored. SHA256 and Size are of the file as it is on
+// disk, after compression and encryption. Database is only set for backups of
+// a single database.
+type Manifest struct {
+	File          string    `json:"file"`
+	SHA256        string    `json:"sha256"`
+	Size          int64     `json:"size"`
+	Engine        string    `json:"engine"`
+	Host          string    `json:"host"`
+	Port          int       `json:"port"`
+	ServerVersion string    `json:"server_version"`
+	Databases     []string  `json:"databases"`
+	Database      string    `json:"database,omitempty"`
+	Compression   string    `json:"compression,omitempty"`
+	Encrypted     bool      `json:"encrypted"`
+	ToolVersion   string    `json:"tool_version"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ManifestPath returns the sidecar manifest path for a backup.
+func ManifestPath(backupPath string) string {
+	return backupPath + manifestSuffix
+}
+
+// HashFile returns the hex SHA-256 and size of path.
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// WriteManifest hashes the finished backup and writes m next to it.
+func WriteManifest(backupPath string, m *Manifest) error {
+	sum, size, err := HashFile(backupPath)
+	if err != nil {
+		return err
+	}
+	m.File = filepath.Base(backupPath)
+	m.SHA256 = sum
+	m.Size = size
+	m.ToolVersion = Version
+	m.CreatedAt = time.Now().UTC()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ManifestPath(backupPath), append(data, '\n'), 0600)
+}
+
+// ReadManifest reads the manifest of a backup.
+func ReadManifest(backupPath string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(backupPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoManifest
+	} else if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", ManifestPath(backupPath), err)
+	}
+	return m, nil
+}
+
+// VerifyBackup checks a backup against its manifest. The manifest is returned
+// whenever it could be read, even if the check failed.
+func VerifyBackup(backupPath string) (*Manifest, error) {
+	m, err := ReadManifest(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	sum, size, err := HashFile(backupPath)
+	if err != nil {
+		return m, err
+	}
+	if sum != m.SHA256 || size != m.Size {
+		return m, fmt.Errorf("%w: expected sha256 %s (%d bytes), file has %s (%d bytes)",
+			ErrChecksumMismatch, m.SHA256, m.Size, sum, size)
+	}
+	return m, nil
+}
+
+// CheckBeforeRestore verifies a backup before it is restored into engine. A
+// missing manifest, a mismatch or a backup of another engine is refused
+// unless force is set, deleting the manifest must not get a tampered backup
+// restored.
+func CheckBeforeRestore(backupPath, engine string, force bool) error {
+	m, err := VerifyBackup(backupPath)
+	if errors.Is(err, ErrNoManifest) {
+		err = fmt.Errorf("%s has no manifest, its integrity can't be checked", backupPath)
+	}
+	if err == nil && m.Engine != "" && m.Engine != engine {
+		err = fmt.Errorf("backup was taken from %s, not %s", m.Engine, engine)
+	}
+	if err == nil {
+		fmt.Printf("Verified %s against its manifest (sha256 %s)\n", backupPath, m.SHA256)
+		return nil
+	}
+	if force {
+		fmt.Printf("[WARN] %v, restoring anyway because of --force\n", err)
+		return nil
+	}
+	return fmt.Errorf("refusing to restore: %w (use --force to restore anyway)", err)
+}
+
+// RunVerify checks a backup against its manifest and prints the result.
+func RunVerify(backupPath string) error {
+	m, err := VerifyBackup(backupPath)
+	if m != nil {
+		PrintHeader("BACKUP MANIFEST")
+		fmt.Printf("  File:        %s\n", backupPath)
+		fmt.Printf("  Engine:      %s\n", m.Engine)
+		fmt.Printf("  Server:      %s:%d (%s)\n", m.Host, m.Port, m.ServerVersion)
+		fmt.Printf("  Databases:   %v\n", m.Databases)
+		if m.Database != "" {
+			fmt.Printf("  Restores to: %s\n", m.Database)
+		}
+		fmt.Printf("  Compression: %s\n", valueOr(m.Compression, "none"))
+		fmt.Printf("  Encrypted:   %t\n", m.Encrypted)
+		fmt.Printf("  Created:     %s by ccdc-cli %s\n", m.CreatedAt.Format(time.RFC3339), m.ToolVersion)
+		fmt.Printf("  SHA-256:     %s\n", m.SHA256)
+	}
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	fmt.Println("Backup matches its manifest")
+	return nil
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
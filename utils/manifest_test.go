@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.sql")
+	if err := os.WriteFile(path, []byte("CREATE DATABASE app;\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyBackup(path); !errors.Is(err, ErrNoManifest) {
+		t.Fatalf("without a manifest: got %v, want ErrNoManifest", err)
+	}
+	if err := CheckBeforeRestore(path, "mysql", false); err == nil {
+		t.Error("a backup without a manifest was allowed without --force")
+	}
+	if err := CheckBeforeRestore(path, "mysql", true); err != nil {
+		t.Errorf("--force should allow a backup without a manifest, got %v", err)
+	}
+
+	if err := WriteManifest(path, &Manifest{Engine: "mysql", Databases: []string{"app"}}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := VerifyBackup(path)
+	if err != nil {
+		t.Fatalf("untouched backup failed verification: %v", err)
+	}
+	if m.File != "backup.sql" || m.Size != 21 || m.ToolVersion != Version {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+	if err := CheckBeforeRestore(path, "postgres", false); err == nil {
+		t.Error("restoring a mysql backup into postgres was allowed")
+	}
+
+	if err := os.WriteFile(path, []byte("CREATE DATABASE pwn;\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBackup(path); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("modified backup: got %v, want ErrChecksumMismatch", err)
+	}
+	if err := CheckBeforeRestore(path, "mysql", false); err == nil {
+		t.Error("modified backup was allowed without --force")
+	}
+	if err := CheckBeforeRestore(path, "mysql", true); err != nil {
+		t.Errorf("--force should allow a modified backup, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPreviewGrants caps the grants a preview prints, pg_dump emits one per
+// object.
+const maxPreviewGrants = 50
+
+// previewKinds are the object kinds a restore preview lists. Indexes,
+// constraints and the like follow their table and are left out.
+var previewKinds = []string{
+	"database", "schema", "table", "view", "materialized view", "sequence",
+	"procedure", "function", "aggregate", "trigger", "event", "type", "domain",
+	"extension", "user", "role",
+}
+
+// PlanObject is an object a dump creates, drops, changes or loads rows into.
+// Database and Schema are empty where they don't apply.
+type PlanObject struct {
+	Kind     string
+	Database string
+	Schema   string
+	Name     string
+	// Actions are the distinct statement verbs in dump order
+	Actions []string
+	Rows    int
+	// Exists is set when the object is already on the live server
+	Exists bool
+}
+
+// ObjectKey identifies an object so a plan can be compared with the objects
+// on a live server.
+func ObjectKey(kind, database, schema, name string) string {
+	var parts []string
+	for _, p := range []string{database, schema, name} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return kind + " " + strings.Join(parts, ".")
+}
+
+func (o *PlanObject) Key() string {
+	return ObjectKey(o.Kind, o.Database, o.Schema, o.Name)
+}
+
+// RestorePlan is what a dump will do when it is restored.
+type RestorePlan struct {
+	Statements int
+	Rows       int
+	Objects    []*PlanObject
+	// Grants are the GRANT and REVOKE statements, and account statements
+	// that name no account, shortened for display
+	Grants []string
+
+	dialect Dialect
+	byKey   map[string]*PlanObject
+}
+
+// Databases returns the databases the plan creates, drops or writes to.
+func (p *RestorePlan) Databases() []string {
+	var dbs []string
+	for _, o := range p.Objects {
+		if o.Database != "" && !slices.Contains(dbs, o.Database) {
+			dbs = append(dbs, o.Database)
+		}
+	}
+	sort.Strings(dbs)
+	return dbs
+}
+
+// BuildRestorePlan reads a dump and records what restoring it would do.
+// database is the database the dump starts in, as for FilterDump.
+func BuildRestorePlan(r io.Reader, dialect Dialect, database string) (*RestorePlan, error) {
+	p := &RestorePlan{dialect: dialect, byKey: map[string]*PlanObject{}}
+	scanner := NewStatementScanner(r, dialect)
+	current := database
+	for {
+		stmt, err := scanner.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		info := ClassifyStatement(stmt, dialect)
+		if info.Scope == ScopeSession {
+			continue
+		}
+		p.Statements++
+		if info.Scope == ScopeUse {
+			current = info.Database
+			continue
+		}
+		p.add(stmt, info, current)
+	}
+	return p, nil
+}
+
+func (p *RestorePlan) add(stmt *Statement, info StatementInfo, current string) {
+	switch {
+	case info.Action == "grant" || info.Action == "revoke":
+		p.addGrant(stmt)
+		return
+	case info.Action == "insert" || info.Action == "copy":
+		o := p.object("table", info.Table, current)
+		o.addAction("load")
+		o.Rows += info.Rows
+		p.Rows += info.Rows
+		return
+	}
+
+	kind := info.Object
+	if p.dialect == DialectPostgres && kind == "user" {
+		// CREATE USER is CREATE ROLE ... LOGIN
+		kind = "role"
+	}
+	if !slices.Contains(previewKinds, kind) {
+		return
+	}
+	if info.Scope == ScopeGlobal && len(info.Name) == 0 {
+		if info.Action != "flush" {
+			p.addGrant(stmt)
+		}
+		return
+	}
+
+	var o *PlanObject
+	switch kind {
+	case "database":
+		o = p.lookup(&PlanObject{Kind: kind, Database: info.Database})
+	case "user", "role":
+		o = p.lookup(&PlanObject{Kind: kind, Name: strings.Join(info.Name, ".")})
+	case "trigger":
+		name := info.Name
+		if p.dialect == DialectPostgres && len(name) == 1 && len(info.Table) > 1 {
+			// PostgreSQL triggers live in the schema of their table
+			name = []string{info.Table[len(info.Table)-2], name[0]}
+		}
+		o = p.object(kind, name, current)
+	default:
+		o = p.object(kind, info.Name, current)
+	}
+	o.addAction(info.Action)
+}
+
+// object returns the plan entry of an object named by a possibly qualified
+// name, found in database current when the name doesn't say.
+func (p *RestorePlan) object(kind string, name []string, current string) *PlanObject {
+	o := &PlanObject{Kind: kind, Database: current, Name: name[len(name)-1]}
+	if p.dialect == DialectMySQL {
+		if len(name) > 1 {
+			o.Database = name[len(name)-2]
+		}
+	} else {
+		o.Schema = "public"
+		if kind == "schema" || kind == "extension" {
+			o.Schema = ""
+		} else if len(name) > 1 {
+			o.Schema = name[len(name)-2]
+		}
+	}
+	return p.lookup(o)
+}
+
+func (p *RestorePlan) lookup(o *PlanObject) *PlanObject {
+	if existing, ok := p.byKey[o.Key()]; ok {
+		return existing
+	}
+	p.byKey[o.Key()] = o
+	p.Objects = append(p.Objects, o)
+	return o
+}
+
+func (o *PlanObject) addAction(action string) {
+	if !slices.Contains(o.Actions, action) {
+		o.Actions = append(o.Actions, action)
+	}
+}
+
+func (p *RestorePlan) addGrant(stmt *Statement) {
+	text := Truncate(stmt.SQL(), 120)
+	if !slices.Contains(p.Grants, text) {
+		p.Grants = append(p.Grants, text)
+	}
+}
+
+// MarkExisting flags the objects of the plan found in existing, a set of
+// ObjectKey values read from the live server, and returns how many there are.
+func (p *RestorePlan) MarkExisting(existing map[string]bool) int {
+	count := 0
+	for _, o := range p.Objects {
+		o.Exists = existing[o.Key()]
+		if o.Exists {
+			count++
+		}
+	}
+	return count
+}
+
+// PrintRestorePlan prints a plan. compared says whether MarkExisting was run
+// against the live server.
+func PrintRestorePlan(path string, p *RestorePlan, compared bool) {
+	PrintHeader("RESTORE PREVIEW: " + path)
+	fmt.Printf("  %d statements, about %d rows\n", p.Statements, p.Rows)
+
+	sections := []struct {
+		title string
+		kinds []string
+	}{
+		{"DATABASES AND SCHEMAS", []string{"database", "schema", "extension"}},
+		{"TABLES AND VIEWS", []string{"table", "view", "materialized view", "sequence"}},
+		{"ROUTINES, TRIGGERS AND EVENTS", []string{"procedure", "function", "aggregate", "trigger", "event"}},
+		{"TYPES", []string{"type", "domain"}},
+		{"USERS AND ROLES", []string{"user", "role"}},
+	}
+	existing := 0
+	for _, s := range sections {
+		var objects []*PlanObject
+		for _, o := range p.Objects {
+			if slices.Contains(s.kinds, o.Kind) {
+				objects = append(objects, o)
+			}
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		PrintHeader(s.title)
+		for _, o := range objects {
+			marker := "   "
+			if o.Exists {
+				marker = "[!]"
+				existing++
+			}
+			fmt.Printf("  %s %-18s %-50s %s", marker, o.Kind, strings.TrimPrefix(o.Key(), o.Kind+" "), strings.Join(o.Actions, ", "))
+			if o.Rows > 0 {
+				fmt.Printf(" (~%d rows)", o.Rows)
+			}
+			fmt.Println()
+		}
+	}
+
+	if len(p.Grants) > 0 {
+		PrintHeader("GRANTS AND ACCOUNT CHANGES")
+		for i, g := range p.Grants {
+			if i == maxPreviewGrants {
+				fmt.Printf("  ... and %d more\n", len(p.Grants)-maxPreviewGrants)
+				break
+			}
+			fmt.Printf("  %s\n", g)
+		}
+	}
+
+	PrintHeader("OVERWRITE CHECK")
+	switch {
+	case !compared:
+		fmt.Println("  The live server was not checked, objects that would be overwritten are unknown")
+	case existing == 0:
+		fmt.Println("  None of these objects exist on the server")
+	default:
+		fmt.Printf("  %d of %d objects marked [!] already exist on the server and would be replaced or changed\n", existing, len(p.Objects))
+	}
+}
+
+// PreviewRestore prints what restoring t into engine would do without
+// changing anything. existing returns the ObjectKey values of the objects on
+// the live server; if it fails the plan is printed without the comparison.
+func PreviewRestore(t RestoreTarget, engine string, sel *Selector, keys DecryptKeys, existing func(*RestorePlan) (map[string]bool, error)) error {
+	m, err := VerifyBackup(t.Path)
+	switch {
+	case errors.Is(err, ErrNoManifest):
+		fmt.Printf("[WARN] %s has no manifest, its integrity can't be checked and restoring it needs --force\n", t.Path)
+	case err != nil:
+		fmt.Printf("[WARN] %v\n", err)
+	case m.Engine != "" && m.Engine != engine:
+		fmt.Printf("[WARN] backup was taken from %s, not %s\n", m.Engine, engine)
+	default:
+		fmt.Printf("%s is a backup of %s:%d taken %s\n", t.Path, m.Host, m.Port, m.CreatedAt.Format(time.RFC3339))
+	}
+
+	in, err := OpenBackup(t.Path, keys)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if sel.Active() {
+		r = NewFilterReader(in, sel, t.Database)
+	}
+	start := t.Database
+	if sel.Dialect == DialectPostgres && start == "" {
+		// psql loads full dumps connected to postgres
+		start = "postgres"
+	}
+	plan, err := BuildRestorePlan(r, sel.Dialect, start)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", t.Path, err)
+	}
+
+	found, err := existing(plan)
+	if err != nil {
+		fmt.Printf("[WARN] could not compare with the live server: %v\n", err)
+	} else {
+		plan.MarkExisting(found)
+	}
+	PrintRestorePlan(t.Path, plan, err == nil)
+	return nil
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func planSummary(p *RestorePlan) []string {
+	var got []string
+	for _, o := range p.Objects {
+		line := o.Key() + ": " + strings.Join(o.Actions, ",")
+		if o.Rows > 0 {
+			line += " rows=" + strings.Repeat("x", o.Rows)
+		}
+		got = append(got, line)
+	}
+	return got
+}
+
+func TestBuildRestorePlanMySQL(t *testing.T) {
+	plan, err := BuildRestorePlan(strings.NewReader(mysqlDump), DialectMySQL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"database app: create",
+		"table app.users: drop,create,load rows=xxx",
+		"table app.logs: load rows=x",
+		"trigger app.t1: create",
+		"user bob@%: create",
+	}
+	if got := planSummary(plan); !slices.Equal(got, want) {
+		t.Errorf("objects:\n got %q\nwant %q", got, want)
+	}
+	if plan.Rows != 4 {
+		t.Errorf("rows = %d, want 4", plan.Rows)
+	}
+	if len(plan.Grants) != 1 || !strings.HasPrefix(plan.Grants[0], "GRANT SELECT ON `app`.*") {
+		t.Errorf("grants = %q", plan.Grants)
+	}
+	if dbs := plan.Databases(); !slices.Equal(dbs, []string{"app"}) {
+		t.Errorf("databases = %q", dbs)
+	}
+
+	existing := map[string]bool{
+		ObjectKey("table", "app", "", "users"): true,
+		ObjectKey("user", "", "", "bob@%"):     true,
+		ObjectKey("table", "other", "", "x"):   true,
+	}
+	if n := plan.MarkExisting(existing); n != 2 {
+		t.Errorf("MarkExisting = %d, want 2", n)
+	}
+}
+
+func TestBuildRestorePlanPostgres(t *testing.T) {
+	plan, err := BuildRestorePlan(strings.NewReader(pgDump), DialectPostgres, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"database shop: create",
+		"role bob: create",
+		"function app.public.f: create",
+		"table app.public.users: create,load rows=xx",
+		"table app.audit.log: create",
+		"trigger app.audit.trg: create",
+		"sequence app.public.users_id_seq: alter",
+		"sequence app.public.other_seq: drop",
+	}
+	if got := planSummary(plan); !slices.Equal(got, want) {
+		t.Errorf("objects:\n got %q\nwant %q", got, want)
+	}
+	if len(plan.Grants) != 2 {
+		t.Errorf("grants = %q", plan.Grants)
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RestoreTarget is one backup file to restore. Database is set when the file
+// holds a single database that has to be connected to, and empty for
+// instance backups.
+type RestoreTarget struct {
+	Path     string
+	Database string
+}
+
+// IsBackupFile reports whether name looks like a backup written by ccdc-cli.
+func IsBackupFile(name string) bool {
+	return strings.Contains(name, ".sql") && !strings.HasSuffix(name, manifestSuffix) && !strings.HasSuffix(name, tempSuffix)
+}
+
+// RestoreTargets returns the backups to restore from path, which is a backup
+// file or a directory of per-database backups. Databases the selector
+// leaves out are skipped.
+func RestoreTargets(path string, sel *Selector) ([]RestoreTarget, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		target := RestoreTarget{Path: path}
+		if m, err := ReadManifest(path); err == nil {
+			target.Database = m.Database
+		}
+		return []RestoreTarget{target}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var targets []RestoreTarget
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !IsBackupFile(e.Name()) {
+			continue
+		}
+		target := RestoreTarget{Path: filepath.Join(path, e.Name())}
+		if m, err := ReadManifest(target.Path); err == nil && m.Database != "" {
+			target.Database = m.Database
+		} else {
+			target.Database, _, _ = strings.Cut(e.Name(), ".sql")
+		}
+		if sel.IncludesDatabase(target.Database) {
+			targets = append(targets, target)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Path < targets[j].Path })
+	return targets, nil
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRestoreTargets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.sql.gz", "shop.sql", "shop.sql.manifest.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("--\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	renamed := filepath.Join(dir, "renamed.sql")
+	os.WriteFile(renamed, []byte("--\n"), 0600)
+	if err := WriteManifest(renamed, &Manifest{Database: "billing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dbs := func(targets []RestoreTarget) []string {
+		var names []string
+		for _, t := range targets {
+			names = append(names, t.Database)
+		}
+		return names
+	}
+
+	targets, err := RestoreTargets(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dbs(targets); !slices.Equal(got, []string{"app", "billing", "shop"}) {
+		t.Errorf("directory targets = %v", got)
+	}
+
+	sel, _ := ParseSelector(DialectMySQL, nil, nil, []string{"shop"})
+	targets, _ = RestoreTargets(dir, sel)
+	if got := dbs(targets); !slices.Equal(got, []string{"app", "billing"}) {
+		t.Errorf("targets excluding shop = %v", got)
+	}
+
+	targets, _ = RestoreTargets(renamed, nil)
+	if len(targets) != 1 || targets[0].Database != "billing" {
+		t.Errorf("single file target = %+v", targets)
+	}
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// backupTimeFormat is the UTC timestamp in --backup-dir file names.
+const backupTimeFormat = "20060102T150405Z"
+
+var (
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+	backupName      = regexp.MustCompile(`^(.+)_(\d+)_([a-z]+)_(\d{8}T\d{6}Z)(\.sql.*)?$`)
+)
+
+// BackupBaseName returns the name of a --backup-dir backup without its
+// extension: <host>_<port>_<engine>_<UTC timestamp>.
+func BackupBaseName(host string, port int, engine string, t time.Time) string {
+	return fmt.Sprintf("%s_%d_%s_%s", unsafeNameChars.ReplaceAllString(host, "-"), port, engine, t.UTC().Format(backupTimeFormat))
+}
+
+// SnapshotName returns the name of the safety snapshot taken before a
+// restore. It doesn't follow the --backup-dir naming, so retention never
+// prunes it.
+func SnapshotName(host string, port int, engine string, t time.Time) string {
+	return BackupBaseName(host, port, engine, t) + ".pre-restore"
+}
+
+// BackupEntry is a backup found in a --backup-dir. Selective backups are
+// directories of per-database files.
+type BackupEntry struct {
+	Path   string
+	Host   string
+	Port   int
+	Engine string
+	Time   time.Time
+	Size   int64
+	Dir    bool
+}
+
+// ListBackups returns the backups in dir, newest first. Files that don't
+// follow the --backup-dir naming are ignored.
+func ListBackups(dir string) ([]BackupEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []BackupEntry
+	for _, e := range entries {
+		m := backupName.FindStringSubmatch(e.Name())
+		if m == nil || (!e.IsDir() && !IsBackupFile(e.Name())) {
+			continue
+		}
+		taken, err := time.Parse(backupTimeFormat, m[4])
+		if err != nil {
+			continue
+		}
+		port, _ := strconv.Atoi(m[2])
+		b := BackupEntry{Path: filepath.Join(dir, e.Name()), Host: m[1], Port: port, Engine: m[3], Time: taken, Dir: e.IsDir()}
+		if b.Size, err = diskUsage(b.Path); err != nil {
+			return nil, err
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// RetentionPolicy decides which backups of one server are kept. A backup is
+// kept if it is one of the newest Keep or younger than KeepWithin; the zero
+// value of either disables it.
+type RetentionPolicy struct {
+	Keep       int
+	KeepWithin time.Duration
+}
+
+func (p RetentionPolicy) Enabled() bool {
+	return p.Keep > 0 || p.KeepWithin > 0
+}
+
+// PruneBackups removes the backups of host, port and engine in dir that the
+// policy doesn't keep, together with their manifests. The newest backup is
+// never removed.
+func PruneBackups(dir, host string, port int, engine string, policy RetentionPolicy, now time.Time) ([]BackupEntry, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	host = unsafeNameChars.ReplaceAllString(host, "-")
+	var removed []BackupEntry
+	kept := 0
+	for _, b := range backups {
+		if b.Host != host || b.Port != port || b.Engine != engine {
+			continue
+		}
+		keep := kept == 0 ||
+			(policy.Keep > 0 && kept < policy.Keep) ||
+			(policy.KeepWithin > 0 && now.Sub(b.Time) <= policy.KeepWithin)
+		if keep {
+			kept++
+			continue
+		}
+		if err := os.RemoveAll(b.Path); err != nil {
+			return removed, err
+		}
+		os.Remove(ManifestPath(b.Path))
+		removed = append(removed, b)
+	}
+	return removed, nil
+}
+
+// PrintBackups prints backups with their size and age.
+func PrintBackups(backups []BackupEntry, now time.Time) {
+	PrintHeader("BACKUPS")
+	if len(backups) == 0 {
+		fmt.Println("  No backups found")
+		return
+	}
+	for _, b := range backups {
+		name := filepath.Base(b.Path)
+		if b.Dir {
+			name += "/"
+		}
+		fmt.Printf("  %-60s %10s  %s ago\n", name, FormatSize(b.Size), FormatAge(now.Sub(b.Time)))
+	}
+}
+
+// FormatSize returns n bytes in a short human readable form.
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// FormatAge rounds an age to the unit that matters.
+func FormatAge(d time.Duration) string {
+	switch {
+	case d < 0:
+		// clock skew between the box that wrote the backup and this one
+		return "0s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
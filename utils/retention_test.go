@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBackupBaseName(t *testing.T) {
+	at := time.Date(2026, 3, 7, 14, 5, 9, 0, time.FixedZone("EST", -5*3600))
+	if got := BackupBaseName("fe80::1", 5432, "postgres", at); got != "fe80-1_5432_postgres_20260307T190509Z" {
+		t.Errorf("BackupBaseName = %q", got)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	now := time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	var names []string
+	for hours := range 5 {
+		name := BackupBaseName("10.0.0.5", 3306, "mysql", now.Add(-time.Duration(hours)*time.Hour)) + ".sql.gz"
+		names = append(names, name)
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600)
+		os.WriteFile(filepath.Join(dir, name+manifestSuffix), []byte("{}"), 0600)
+	}
+	other := BackupBaseName("10.0.0.6", 3306, "mysql", now.Add(-48*time.Hour)) + ".sql"
+	os.WriteFile(filepath.Join(dir, other), []byte("x"), 0600)
+	// safety snapshots are neither listed nor pruned
+	snapshot := filepath.Join(dir, SnapshotName("10.0.0.5", 3306, "mysql", now.Add(-72*time.Hour)))
+	os.MkdirAll(snapshot, 0700)
+	os.WriteFile(filepath.Join(snapshot, "app.sql"), []byte("x"), 0600)
+
+	remaining := func() []string {
+		backups, err := ListBackups(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var left []string
+		for _, b := range backups {
+			left = append(left, filepath.Base(b.Path))
+		}
+		return left
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{"keep within", RetentionPolicy{KeepWithin: 150 * time.Minute}, []string{names[0], names[1], names[2], other}},
+		{"keep count", RetentionPolicy{Keep: 2}, []string{names[0], names[1], other}},
+		{"newest is never pruned", RetentionPolicy{KeepWithin: time.Nanosecond}, []string{names[0], other}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PruneBackups(dir, "10.0.0.5", 3306, "mysql", tt.policy, now); err != nil {
+				t.Fatal(err)
+			}
+			if got := remaining(); !slices.Equal(got, tt.want) {
+				t.Errorf("left %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Errorf("the safety snapshot was pruned: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, names[4]+manifestSuffix)); !os.IsNotExist(err) {
+		t.Error("the manifest of a pruned backup was left behind")
+	}
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// daemonChildEnv marks the background copy started by --daemon. It reads the
+// answers to its prompts from stdin instead of the terminal.
+const daemonChildEnv = "CCDC_DAEMON_CHILD"
+
+// alertTimeout bounds how long an --alert-cmd may hold up the next run.
+const alertTimeout = 30 * time.Second
+
+// Schedule repeats a task from --every, --daemon, --log-file and --alert-cmd.
+type Schedule struct {
+	Every    time.Duration
+	Daemon   bool
+	LogFile  string
+	AlertCmd string
+}
+
+// IsDaemonChild reports whether this process was started by --daemon.
+func IsDaemonChild() bool {
+	return os.Getenv(daemonChildEnv) != ""
+}
+
+// RunSchedule runs task now and then every s.Every until SIGINT or SIGTERM,
+// logging the result and duration of each run. A failed run is alerted on
+// and the schedule carries on. With s.Daemon the loop is moved into a
+// detached copy of this process and RunSchedule returns once it started.
+func RunSchedule(s Schedule, name string, task func(ctx context.Context) error) error {
+	if s.Every <= 0 {
+		return errors.New("--every must be a positive duration, e.g. 15m")
+	}
+	if s.Daemon && !IsDaemonChild() {
+		return startDaemon(s.LogFile)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logf("%s scheduled every %s (pid %d), stop with Ctrl-C or SIGTERM", name, s.Every, os.Getpid())
+	ticker := time.NewTicker(s.Every)
+	defer ticker.Stop()
+	for {
+		logf("%s started", name)
+		start := time.Now()
+		err := task(ctx)
+		took := time.Since(start).Round(time.Millisecond)
+		if ctx.Err() != nil {
+			logf("%s interrupted after %s, stopping", name, took)
+			return nil
+		}
+		if err != nil {
+			logf("%s failed after %s: %v", name, took, err)
+			alert(s.AlertCmd, fmt.Sprintf("%s failed: %v", name, err))
+		} else {
+			logf("%s succeeded in %s", name, took)
+		}
+
+		select {
+		case <-ctx.Done():
+			logf("%s stopped", name)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func logf(format string, args ...any) {
+	fmt.Printf("[%s] %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// alert reports a failed run on stderr and through alertCmd, which gets the
+// message in $CCDC_ALERT_MESSAGE.
+func alert(alertCmd, message string) {
+	fmt.Fprintf(os.Stderr, "[ALERT] %s\n", message)
+	if alertCmd == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", alertCmd)
+	cmd.Env = append(os.Environ(), "CCDC_ALERT_MESSAGE="+message)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logf("[WARN] alert command failed: %v", err)
+	}
+}
+
+// startDaemon starts this command again in the background with its output
+// appended to logFile. The secrets typed so far are passed to it on stdin so
+// it never prompts and they never appear in its arguments or environment.
+func startDaemon(logFile string) error {
+	if logFile == "" {
+		return errors.New("--daemon requires --log-file")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	log, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonChildEnv+"=1")
+	cmd.Stdout = log
+	cmd.Stderr = log
+	detach(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	for _, secret := range answeredSecrets {
+		fmt.Fprintln(stdin, secret)
+	}
+	stdin.Close()
+
+	fmt.Printf("Started background process %d, logging to %s\n", cmd.Process.Pid, logFile)
+	return cmd.Process.Release()
+}
@@ -0,0 +1,61 @@
+//go:build unix
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunScheduleAlertsAndStopsOnSIGTERM(t *testing.T) {
+	alertFile := filepath.Join(t.TempDir(), "alert")
+	s := Schedule{Every: 10 * time.Millisecond, AlertCmd: `printf '%s' "$CCDC_ALERT_MESSAGE" > ` + alertFile}
+
+	runs := 0
+	var stoppedBy error
+	err := RunSchedule(s, "test backup", func(ctx context.Context) error {
+		runs++
+		switch runs {
+		case 1:
+			return errors.New("disk full")
+		case 3:
+			syscall.Kill(os.Getpid(), syscall.SIGTERM)
+			<-ctx.Done()
+			stoppedBy = ctx.Err()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunSchedule: %v", err)
+	}
+	if runs != 3 {
+		t.Errorf("ran %d times, want 3: a failure must not stop the schedule", runs)
+	}
+	if stoppedBy == nil {
+		t.Error("SIGTERM did not cancel the running task")
+	}
+	alert, err := os.ReadFile(alertFile)
+	if err != nil {
+		t.Fatalf("alert command did not run: %v", err)
+	}
+	if !strings.Contains(string(alert), "test backup failed: disk full") {
+		t.Errorf("alert message = %q", alert)
+	}
+}
+
+func TestRunScheduleRejectsBadInterval(t *testing.T) {
+	err := RunSchedule(Schedule{}, "test", func(context.Context) error {
+		t.Fatal("task ran without an interval")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error for a zero --every")
+	}
+}
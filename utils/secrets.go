@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/rand"
+	"math/big"
+	"os"
+)
+
+// passwordAlphabet leaves out quotes, backslashes and other characters that
+// need escaping in SQL or shell.
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789!#%*+-=?@^_"
+
+// GeneratePassword returns a random password of the given length drawn from a
+// cryptographically secure source.
+func GeneratePassword(length int) (string, error) {
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	password := make([]byte, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// CreatePrivateFile creates a new file only the owner can read. It refuses to
+// overwrite an existing file so earlier credentials are never lost.
+func CreatePrivateFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	// The umask can only remove bits, but be explicit in case the file
+	// system ignores the mode on create
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// TableRef names a table in a selector. Schema is empty for MySQL.
+type TableRef struct {
+	Database string
+	Schema   string
+	Name     string
+}
+
+func (t TableRef) String() string {
+	if t.Schema == "" {
+		return t.Database + "." + t.Name
+	}
+	return t.Database + "." + t.Schema + "." + t.Name
+}
+
+// Selector limits a backup or restore to some databases and tables, from
+// --databases, --tables and --exclude.
+type Selector struct {
+	Dialect   Dialect
+	Databases []string
+	Tables    []TableRef
+	// ExcludeDatabases and ExcludeTables are skipped even when selected
+	ExcludeDatabases []string
+	ExcludeTables    []TableRef
+}
+
+// ParseSelector parses the selector flags. MySQL tables are db.table;
+// PostgreSQL tables are db.schema.table, or db.table for the public schema.
+// Excludes name a database or a table.
+func ParseSelector(dialect Dialect, databases, tables, exclude []string) (*Selector, error) {
+	sel := &Selector{Dialect: dialect, Databases: databases}
+	for _, t := range tables {
+		ref, err := sel.parseTable(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --tables entry: %w", err)
+		}
+		sel.Tables = append(sel.Tables, ref)
+	}
+	for _, e := range exclude {
+		if !strings.Contains(e, ".") {
+			sel.ExcludeDatabases = append(sel.ExcludeDatabases, e)
+			continue
+		}
+		ref, err := sel.parseTable(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude entry: %w", err)
+		}
+		sel.ExcludeTables = append(sel.ExcludeTables, ref)
+	}
+	return sel, nil
+}
+
+func (s *Selector) parseTable(value string) (TableRef, error) {
+	parts := strings.Split(value, ".")
+	for _, p := range parts {
+		if p == "" {
+			return TableRef{}, fmt.Errorf("%q has an empty name", value)
+		}
+	}
+	switch {
+	case len(parts) == 2 && s.Dialect == DialectMySQL:
+		return TableRef{Database: parts[0], Name: parts[1]}, nil
+	case len(parts) == 2:
+		return TableRef{Database: parts[0], Schema: "public", Name: parts[1]}, nil
+	case len(parts) == 3 && s.Dialect == DialectPostgres:
+		return TableRef{Database: parts[0], Schema: parts[1], Name: parts[2]}, nil
+	}
+	if s.Dialect == DialectMySQL {
+		return TableRef{}, fmt.Errorf("%q is not database.table", value)
+	}
+	return TableRef{}, fmt.Errorf("%q is not database.table or database.schema.table", value)
+}
+
+// Active reports whether any selector flag was given.
+func (s *Selector) Active() bool {
+	return s != nil && (len(s.Databases) > 0 || len(s.Tables) > 0 || len(s.ExcludeDatabases) > 0 || len(s.ExcludeTables) > 0)
+}
+
+// SelectedDatabases returns the databases named by --databases and --tables,
+// or nil when every database is selected.
+func (s *Selector) SelectedDatabases() []string {
+	var dbs []string
+	for _, db := range s.Databases {
+		if !slices.Contains(dbs, db) {
+			dbs = append(dbs, db)
+		}
+	}
+	for _, t := range s.Tables {
+		if !slices.Contains(dbs, t.Database) {
+			dbs = append(dbs, t.Database)
+		}
+	}
+	return dbs
+}
+
+// IncludesDatabase reports whether anything in db is selected.
+func (s *Selector) IncludesDatabase(db string) bool {
+	if !s.Active() {
+		return true
+	}
+	if slices.Contains(s.ExcludeDatabases, db) {
+		return false
+	}
+	selected := s.SelectedDatabases()
+	return len(selected) == 0 || slices.Contains(selected, db)
+}
+
+// TablesIn returns the tables selected in db, nil when the whole database is.
+func (s *Selector) TablesIn(db string) []TableRef {
+	if s == nil || slices.Contains(s.Databases, db) {
+		return nil
+	}
+	var tables []TableRef
+	for _, t := range s.Tables {
+		if t.Database == db {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// ExcludedTablesIn returns the tables excluded from db.
+func (s *Selector) ExcludedTablesIn(db string) []TableRef {
+	if s == nil {
+		return nil
+	}
+	var tables []TableRef
+	for _, t := range s.ExcludeTables {
+		if t.Database == db {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// NarrowsDatabase reports whether only part of db is selected.
+func (s *Selector) NarrowsDatabase(db string) bool {
+	return len(s.TablesIn(db)) > 0 || len(s.ExcludedTablesIn(db)) > 0
+}
+
+// IncludesTable reports whether a table is selected. schema is ignored for
+// MySQL.
+func (s *Selector) IncludesTable(db, schema, table string) bool {
+	if !s.IncludesDatabase(db) {
+		return false
+	}
+	match := func(t TableRef) bool {
+		return t.Name == table && (s.Dialect == DialectMySQL || t.Schema == schema)
+	}
+	if slices.ContainsFunc(s.ExcludedTablesIn(db), match) {
+		return false
+	}
+	tables := s.TablesIn(db)
+	return len(tables) == 0 || slices.ContainsFunc(tables, match)
+}
+
+// ForDatabase returns the selector restricted to the single database db.
+func (s *Selector) ForDatabase(db string) *Selector {
+	one := &Selector{Dialect: s.Dialect, Tables: s.TablesIn(db), ExcludeTables: s.ExcludedTablesIn(db)}
+	if len(one.Tables) == 0 {
+		one.Databases = []string{db}
+	}
+	return one
+}
+
+// includesStatement decides if a classified statement survives the selector
+// while the dump is in database current.
+func (s *Selector) includesStatement(info StatementInfo, current string) bool {
+	switch info.Scope {
+	case ScopeSession:
+		return current == "" || s.IncludesDatabase(current)
+	case ScopeUse, ScopeDatabase:
+		return s.IncludesDatabase(info.Database)
+	case ScopeGlobal:
+		// accounts and grants are instance wide, a partial restore must not
+		// change them
+		return false
+	case ScopeTable:
+		db, schema, table := current, "public", info.Table[len(info.Table)-1]
+		switch {
+		case s.Dialect == DialectMySQL && len(info.Table) > 1:
+			db = info.Table[len(info.Table)-2]
+		case s.Dialect == DialectPostgres && len(info.Table) > 1:
+			schema = info.Table[len(info.Table)-2]
+		}
+		return s.IncludesTable(db, schema, table)
+	}
+	// a DROP of something that isn't tied to a selected table could remove
+	// an object the selection left out
+	if info.Action == "drop" && s.NarrowsDatabase(current) {
+		return false
+	}
+	return current == "" || s.IncludesDatabase(current)
+}
+
+// FilterDump copies the statements of a dump that the selector includes from
+// r to w. database is the database the dump starts in, for dumps of a single
+// database without USE or \connect.
+func FilterDump(r io.Reader, w io.Writer, sel *Selector, database string) error {
+	scanner := NewStatementScanner(r, sel.Dialect)
+	bw := bufio.NewWriterSize(w, 1<<16)
+	current := database
+	for {
+		stmt, err := scanner.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		info := ClassifyStatement(stmt, sel.Dialect)
+		if info.Scope == ScopeUse {
+			current = info.Database
+		}
+		if stmt.Meta && info.Scope == ScopeSession || sel.includesStatement(info, current) {
+			if _, err := bw.WriteString(stmt.Text); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// NewFilterReader returns a reader of the statements of r the selector
+// includes.
+func NewFilterReader(r io.Reader, sel *Selector, database string) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(FilterDump(r, pw, sel, database))
+	}()
+	return pr
+}
+
+type filterWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// NewFilterWriter returns a writer that passes the statements written to it
+// that the selector includes on to w. Close must be called to flush it.
+func NewFilterWriter(w io.Writer, sel *Selector, database string) io.WriteCloser {
+	pr, pw := io.Pipe()
+	f := &filterWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := FilterDump(pr, w, sel, database)
+		pr.CloseWithError(err)
+		f.done <- err
+	}()
+	return f
+}
+
+func (f *filterWriter) Write(p []byte) (int, error) {
+	return f.pw.Write(p)
+}
+
+func (f *filterWriter) Close() error {
+	f.pw.Close()
+	return <-f.done
+}
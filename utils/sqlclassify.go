@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Statement scopes, deciding which selector applies to a statement.
+const (
+	// ScopeSession statements (SET, DELIMITER, LOCK bookkeeping) only
+	// change the client session
+	ScopeSession = "session"
+	// ScopeUse switches the current database (USE, \connect)
+	ScopeUse = "use"
+	// ScopeDatabase statements create, drop or alter a whole database
+	ScopeDatabase = "database"
+	// ScopeGlobal statements affect accounts, roles and their grants
+	ScopeGlobal = "global"
+	// ScopeTable statements create, fill or change one table or view
+	ScopeTable = "table"
+	// ScopeObject statements act on another object of the current database
+	ScopeObject = "object"
+)
+
+// StatementInfo describes what a dump statement does.
+type StatementInfo struct {
+	Scope string
+	// Action is the leading verb in lower case: create, drop, alter,
+	// insert, copy, grant, ...
+	Action string
+	// Object is the kind of object acted on: table, view, trigger, user, ...
+	Object string
+	// Name is the object name split into its qualified parts
+	Name []string
+	// Table is the table the statement depends on, for triggers, indexes
+	// and table statements
+	Table []string
+	// Database is set for ScopeUse and ScopeDatabase statements
+	Database string
+	// Rows is the approximate number of rows an INSERT or COPY loads
+	Rows int
+}
+
+const (
+	identPattern   = "(?:`(?:[^`]|``)*`|\"(?:[^\"]|\"\")*\"|[\\w$*]+)"
+	namePattern    = identPattern + `(?:\s*\.\s*` + identPattern + `)*`
+	accountPattern = `(?:'(?:[^'\\]|\\.|'')*'|` + identPattern + `)(?:\s*@\s*(?:'(?:[^'\\]|\\.|'')*'|` + identPattern + `))?`
+
+	// words that may come between CREATE and the object type
+	createModifiers = `(?:(?:OR\s+REPLACE|ALGORITHM\s*=\s*\w+|DEFINER\s*=\s*\S+|SQL\s+SECURITY\s+\w+|TEMP|TEMPORARY|UNLOGGED|UNIQUE|RECURSIVE|CONSTRAINT|AGGREGATE|TRUSTED|PROCEDURAL)\s+)*`
+	objectTypes     = `MATERIALIZED\s+VIEW|EVENT\s+TRIGGER|TABLE|VIEW|INDEX|TRIGGER|PROCEDURE|FUNCTION|EVENT|SEQUENCE|SCHEMA|DATABASE|USER|ROLE|EXTENSION|TYPE|DOMAIN|LANGUAGE|POLICY|RULE|AGGREGATE|OPERATOR|COLLATION|PUBLICATION|SUBSCRIPTION|SERVER`
+)
+
+var (
+	createStmt  = regexp.MustCompile(`(?is)^CREATE\s+` + createModifiers + `(` + objectTypes + `)\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(` + accountPattern + `(?:\s*\.\s*` + identPattern + `)*)`)
+	dropStmt    = regexp.MustCompile(`(?is)^DROP\s+(` + objectTypes + `)\s+(?:CONCURRENTLY\s+)?(?:IF\s+EXISTS\s+)?(` + accountPattern + `(?:\s*\.\s*` + identPattern + `)*)`)
+	alterStmt   = regexp.MustCompile(`(?is)^ALTER\s+(` + objectTypes + `)\s+(?:ONLY\s+)?(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?(` + accountPattern + `(?:\s*\.\s*` + identPattern + `)*)`)
+	insertStmt  = regexp.MustCompile(`(?is)^(INSERT|REPLACE)\s+(?:(?:LOW_PRIORITY|DELAYED|HIGH_PRIORITY|IGNORE)\s+)*(?:INTO\s+)?(` + namePattern + `)`)
+	copyStmt    = regexp.MustCompile(`(?is)^COPY\s+(` + namePattern + `)`)
+	lockStmt    = regexp.MustCompile(`(?is)^LOCK\s+TABLES?\s+(?:ONLY\s+)?(` + namePattern + `)`)
+	truncStmt   = regexp.MustCompile(`(?is)^TRUNCATE\s+(?:TABLE\s+)?(?:ONLY\s+)?(` + namePattern + `)`)
+	refreshStmt = regexp.MustCompile(`(?is)^REFRESH\s+MATERIALIZED\s+VIEW\s+(?:CONCURRENTLY\s+)?(` + namePattern + `)`)
+	commentStmt = regexp.MustCompile(`(?is)^COMMENT\s+ON\s+(TABLE|VIEW|MATERIALIZED\s+VIEW|COLUMN|DATABASE)\s+(` + namePattern + `)`)
+	grantStmt   = regexp.MustCompile(`(?is)^(GRANT|REVOKE)\s.*?\sON\s+(?:(TABLE|SEQUENCE|DATABASE|SCHEMA|FUNCTION|PROCEDURE|ROUTINE|TYPE|DOMAIN|LANGUAGE|LARGE\s+OBJECT|FOREIGN\s+DATA\s+WRAPPER|FOREIGN\s+SERVER|TABLESPACE|ALL\s+\w+\s+IN\s+SCHEMA)\s+)?(` + namePattern + `)`)
+	useStmt     = regexp.MustCompile(`(?is)^USE\s+(` + identPattern + `)`)
+	gexecDB     = regexp.MustCompile(`(?is)^SELECT\s+'CREATE\s+DATABASE\s+(` + identPattern + `)`)
+	doRole      = regexp.MustCompile(`(?is)^DO\s+\$\w*\$\s*BEGIN\s+CREATE\s+ROLE\s+(` + identPattern + `)`)
+	onTable     = regexp.MustCompile(`(?is)^.*?\sON\s+(?:ONLY\s+)?(` + namePattern + `)`)
+	ownedBy     = regexp.MustCompile(`(?is)\sOWNED\s+BY\s+(` + namePattern + `)`)
+	sessionStmt = regexp.MustCompile(`(?is)^(?:SET|UNLOCK|START\s+TRANSACTION|BEGIN|COMMIT|ROLLBACK|SELECT\s+pg_catalog\.set_config|FLUSH\s+(?:TABLES|LOGS))\b`)
+	globalStmt  = regexp.MustCompile(`(?is)^(?:(?:CREATE|ALTER|DROP|RENAME)\s+(?:USER|ROLE)|SET\s+(?:PASSWORD|DEFAULT\s+ROLE)|FLUSH\s+PRIVILEGES)\b`)
+)
+
+// SplitName splits a possibly qualified, possibly quoted name into its
+// unquoted parts.
+func SplitName(name string) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '`' || c == '"' || c == '\'':
+			for i++; i < len(name); i++ {
+				if name[i] == '\\' && c == '\'' && i+1 < len(name) {
+					i++
+				} else if name[i] == c {
+					if i+1 < len(name) && name[i+1] == c {
+						i++
+					} else {
+						break
+					}
+				}
+				cur.WriteByte(name[i])
+			}
+		case c == '.':
+			parts = append(parts, cur.String())
+			cur.Reset()
+		case c == ' ' || c == '\t' || c == '\n':
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// ClassifyStatement works out what a dump statement does. Statements it does
+// not recognise are ScopeObject, so filters keep them with their database.
+func ClassifyStatement(stmt *Statement, dialect Dialect) StatementInfo {
+	if stmt.Meta {
+		return classifyMeta(stmt.Text)
+	}
+	sql := stmt.SQL()
+	if sql == "" || sessionStmt.MatchString(sql) && !globalStmt.MatchString(sql) {
+		return StatementInfo{Scope: ScopeSession}
+	}
+
+	if m := useStmt.FindStringSubmatch(sql); m != nil {
+		return StatementInfo{Scope: ScopeUse, Action: "use", Database: SplitName(m[1])[0]}
+	}
+	if m := gexecDB.FindStringSubmatch(sql); m != nil {
+		return StatementInfo{Scope: ScopeDatabase, Action: "create", Object: "database", Database: SplitName(m[1])[0]}
+	}
+	if m := doRole.FindStringSubmatch(sql); m != nil {
+		return StatementInfo{Scope: ScopeGlobal, Action: "create", Object: "role", Name: SplitName(m[1])}
+	}
+	if m := insertStmt.FindStringSubmatch(sql); m != nil {
+		return StatementInfo{Scope: ScopeTable, Action: "insert", Object: "table", Name: SplitName(m[2]),
+			Table: SplitName(m[2]), Rows: strings.Count(stmt.Text, "),(") + 1}
+	}
+	if m := copyStmt.FindStringSubmatch(sql); m != nil {
+		return StatementInfo{Scope: ScopeTable, Action: "copy", Object: "table", Name: SplitName(m[1]),
+			Table: SplitName(m[1]), Rows: stmt.CopyRows}
+	}
+
+	for _, t := range []struct {
+		re     *regexp.Regexp
+		action string
+	}{{createStmt, "create"}, {dropStmt, "drop"}, {alterStmt, "alter"}} {
+		if m := t.re.FindStringSubmatch(sql); m != nil {
+			return classifyObject(t.action, m[1], m[2], sql[len(m[0]):], dialect)
+		}
+	}
+
+	for _, t := range []struct {
+		re     *regexp.Regexp
+		action string
+	}{{lockStmt, "lock"}, {truncStmt, "truncate"}, {refreshStmt, "refresh"}} {
+		if m := t.re.FindStringSubmatch(sql); m != nil {
+			return StatementInfo{Scope: ScopeTable, Action: t.action, Object: "table", Name: SplitName(m[1]), Table: SplitName(m[1])}
+		}
+	}
+	if m := commentStmt.FindStringSubmatch(sql); m != nil {
+		object := strings.ToLower(strings.Join(strings.Fields(m[1]), " "))
+		name := SplitName(m[2])
+		switch object {
+		case "database":
+			return StatementInfo{Scope: ScopeDatabase, Action: "comment", Object: object, Database: name[0]}
+		case "column":
+			return StatementInfo{Scope: ScopeTable, Action: "comment", Object: object, Name: name, Table: name[:max(len(name)-1, 1)]}
+		}
+		return StatementInfo{Scope: ScopeTable, Action: "comment", Object: object, Name: name, Table: name}
+	}
+
+	if globalStmt.MatchString(sql) {
+		fields := strings.Fields(strings.ToLower(sql))
+		return StatementInfo{Scope: ScopeGlobal, Action: fields[0], Object: "user"}
+	}
+	if strings.HasPrefix(strings.ToUpper(sql), "GRANT") || strings.HasPrefix(strings.ToUpper(sql), "REVOKE") {
+		return classifyGrant(sql, dialect)
+	}
+	return StatementInfo{Scope: ScopeObject, Action: strings.ToLower(strings.Fields(sql)[0])}
+}
+
+// classifyObject fills in a CREATE, DROP or ALTER of an object. rest is the
+// statement text after the object name.
+func classifyObject(action, objectType, name, rest string, dialect Dialect) StatementInfo {
+	object := strings.ToLower(strings.Join(strings.Fields(objectType), " "))
+	info := StatementInfo{Scope: ScopeObject, Action: action, Object: object, Name: SplitName(name)}
+
+	switch object {
+	case "database", "schema":
+		// MySQL treats SCHEMA as a synonym of DATABASE
+		if object == "database" || dialect == DialectMySQL {
+			info.Scope, info.Object, info.Database = ScopeDatabase, "database", info.Name[0]
+		}
+	case "user", "role":
+		info.Scope = ScopeGlobal
+	case "table", "view", "materialized view":
+		info.Scope, info.Table = ScopeTable, info.Name
+	case "index", "trigger", "policy", "rule":
+		if m := onTable.FindStringSubmatch(rest); m != nil {
+			info.Scope, info.Table = ScopeTable, SplitName(m[1])
+		}
+	case "sequence":
+		if m := ownedBy.FindStringSubmatch(rest); m != nil {
+			if owner := SplitName(m[1]); len(owner) > 1 {
+				info.Scope, info.Table = ScopeTable, owner[:len(owner)-1]
+			}
+		}
+	}
+	return info
+}
+
+// classifyGrant sorts GRANT and REVOKE. MySQL grants name accounts, so they
+// are all global; PostgreSQL object grants belong to the object.
+func classifyGrant(sql string, dialect Dialect) StatementInfo {
+	action := strings.ToLower(strings.Fields(sql)[0])
+	info := StatementInfo{Scope: ScopeGlobal, Action: action, Object: "privileges"}
+	if dialect == DialectMySQL {
+		return info
+	}
+	m := grantStmt.FindStringSubmatch(sql)
+	if m == nil {
+		// GRANT role TO role
+		info.Object = "role membership"
+		return info
+	}
+	info.Name = SplitName(m[3])
+	switch kind := strings.ToUpper(strings.Join(strings.Fields(m[2]), " ")); {
+	case kind == "" || kind == "TABLE":
+		info.Scope, info.Table = ScopeTable, info.Name
+	case kind == "DATABASE":
+		info.Scope, info.Database = ScopeDatabase, info.Name[0]
+	default:
+		info.Scope = ScopeObject
+	}
+	return info
+}
+
+var connectArg = regexp.MustCompile(`dbname\s*=\s*'((?:[^'\\]|\\.)*)'|dbname\s*=\s*(\S+)`)
+
+// classifyMeta sorts psql meta-commands and DELIMITER lines.
+func classifyMeta(text string) StatementInfo {
+	fields := strings.Fields(leadingComments.ReplaceAllString(text, ""))
+	if len(fields) == 0 || (fields[0] != `\connect` && fields[0] != `\c`) {
+		return StatementInfo{Scope: ScopeSession}
+	}
+	for _, arg := range fields[1:] {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if strings.HasPrefix(arg, `"`) {
+			arg = strings.ReplaceAll(strings.Trim(arg, `"`), `""`, `"`)
+		}
+		if m := connectArg.FindStringSubmatch(arg); m != nil {
+			if m[1] != "" {
+				return StatementInfo{Scope: ScopeUse, Action: "connect", Database: connValueUnescaper.Replace(m[1])}
+			}
+			return StatementInfo{Scope: ScopeUse, Action: "connect", Database: m[2]}
+		}
+		return StatementInfo{Scope: ScopeUse, Action: "connect", Database: arg}
+	}
+	return StatementInfo{Scope: ScopeSession}
+}
+
+var connValueUnescaper = strings.NewReplacer(`\\`, `\`, `\'`, `'`)
@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Dialect selects the SQL syntax a dump is read with.
+type Dialect int
+
+const (
+	DialectMySQL Dialect = iota
+	DialectPostgres
+)
+
+// Statement is one statement of a dump. Text is exactly what the dump holds,
+// including leading comments and the terminator, so writing every Text back
+// out reproduces the dump.
+type Statement struct {
+	Text string
+	// Meta is a client command such as DELIMITER or \connect
+	Meta bool
+	// CopyRows counts the data rows following a COPY ... FROM stdin
+	CopyRows int
+}
+
+// StatementScanner splits mysql and psql dump scripts into statements. It
+// tracks quotes, comments, DELIMITER, dollar quoting, psql meta-commands and
+// COPY data, so it never has to hold more than one statement in memory.
+type StatementScanner struct {
+	r         *bufio.Reader
+	dialect   Dialect
+	delimiter string
+	pending   string
+}
+
+func NewStatementScanner(r io.Reader, dialect Dialect) *StatementScanner {
+	return &StatementScanner{r: bufio.NewReaderSize(r, 1<<16), dialect: dialect, delimiter: ";"}
+}
+
+// scanState is the lexical state carried between the lines of a statement.
+type scanState struct {
+	quote   byte
+	dollar  string
+	block   bool
+	started bool
+}
+
+var dollarTag = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+func (s *StatementScanner) readLine() (string, error) {
+	if s.pending != "" {
+		line := s.pending
+		s.pending = ""
+		return line, nil
+	}
+	return s.r.ReadString('\n')
+}
+
+// Next returns the next statement, or io.EOF once the dump is exhausted.
+func (s *StatementScanner) Next() (*Statement, error) {
+	var text strings.Builder
+	var st scanState
+
+	for {
+		line, err := s.readLine()
+		if line == "" {
+			if err == nil {
+				continue
+			}
+			if err == io.EOF && text.Len() > 0 {
+				// an unterminated statement or trailing comments
+				return &Statement{Text: text.String()}, nil
+			}
+			return nil, err
+		}
+
+		if !st.started && st.quote == 0 && st.dollar == "" && !st.block {
+			if stmt := s.metaCommand(line); stmt != nil {
+				stmt.Text = text.String() + stmt.Text
+				return stmt, nil
+			}
+		}
+
+		end := s.scanLine(line, &st)
+		if end < 0 {
+			text.WriteString(line)
+			continue
+		}
+
+		// whitespace after the terminator stays with this statement, anything
+		// else starts the next one
+		rest := line[end:]
+		if strings.TrimSpace(rest) == "" {
+			text.WriteString(line)
+		} else {
+			text.WriteString(line[:end])
+			s.pending = rest
+		}
+		stmt := &Statement{Text: text.String()}
+		if s.dialect == DialectPostgres && copyFromStdin.MatchString(stmt.SQL()) {
+			if err := s.readCopyData(stmt); err != nil {
+				return nil, err
+			}
+		}
+		return stmt, nil
+	}
+}
+
+// metaCommand returns line as a statement if it is a client command.
+func (s *StatementScanner) metaCommand(line string) *Statement {
+	trimmed := strings.TrimSpace(line)
+	switch s.dialect {
+	case DialectMySQL:
+		fields := strings.Fields(trimmed)
+		if len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") {
+			s.delimiter = fields[1]
+			return &Statement{Text: line, Meta: true}
+		}
+	case DialectPostgres:
+		if strings.HasPrefix(trimmed, `\`) {
+			return &Statement{Text: line, Meta: true}
+		}
+	}
+	return nil
+}
+
+// scanLine advances st over line and returns the offset just past the
+// statement terminator, or -1 if the statement continues on the next line.
+func (s *StatementScanner) scanLine(line string, st *scanState) int {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case st.quote != 0:
+			if c == '\\' && s.dialect == DialectMySQL && st.quote != '`' {
+				i++
+			} else if c == st.quote {
+				if i+1 < len(line) && line[i+1] == c {
+					i++
+				} else {
+					st.quote = 0
+				}
+			}
+		case st.dollar != "":
+			if strings.HasPrefix(line[i:], st.dollar) {
+				i += len(st.dollar) - 1
+				st.dollar = ""
+			}
+		case st.block:
+			if strings.HasPrefix(line[i:], "*/") {
+				st.block = false
+				i++
+			}
+		case c == '\'' || c == '"' || c == '`':
+			st.quote = c
+			st.started = true
+		case strings.HasPrefix(line[i:], "--") || (c == '#' && s.dialect == DialectMySQL):
+			return -1
+		case strings.HasPrefix(line[i:], "/*"):
+			st.block = true
+			// /*! ... */ is executed by MySQL
+			st.started = st.started || strings.HasPrefix(line[i:], "/*!")
+			i++
+		case c == '$' && s.dialect == DialectPostgres && (i == 0 || !isIdentByte(line[i-1])):
+			if tag := dollarTag.FindString(line[i:]); tag != "" {
+				st.dollar = tag
+				st.started = true
+				i += len(tag) - 1
+			}
+		case c == '\\' && s.dialect == DialectPostgres:
+			// a trailing meta-command such as \gexec ends the statement
+			return len(line)
+		case strings.HasPrefix(line[i:], s.delimiter):
+			return i + len(s.delimiter)
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			st.started = true
+		}
+	}
+	return -1
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+var copyFromStdin = regexp.MustCompile(`(?is)^COPY\s.*\bFROM\s+stdin\b`)
+
+// readCopyData appends the data rows of a COPY to stmt, up to the \. line.
+func (s *StatementScanner) readCopyData(stmt *Statement) error {
+	var text strings.Builder
+	text.WriteString(stmt.Text)
+	for {
+		line, err := s.readLine()
+		text.WriteString(line)
+		if strings.TrimRight(line, "\r\n") == `\.` {
+			break
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if line != "" {
+			stmt.CopyRows++
+		}
+	}
+	stmt.Text = text.String()
+	return nil
+}
+
+var (
+	leadingComments   = regexp.MustCompile(`^(?:\s+|--[^\n]*(?:\n|$)|#[^\n]*(?:\n|$)|/\*[^!](?s:.*?)\*/)*`)
+	versionedComments = regexp.MustCompile(`/\*!\d*\s?|\*/`)
+)
+
+// SQL returns the start of the statement without leading comments, with
+// MySQL /*!NNNNN ... */ version comments unwrapped. It is meant for
+// recognising statements, not for running them.
+func (s *Statement) SQL() string {
+	sql := leadingComments.ReplaceAllString(s.Text, "")
+	if len(sql) > 1024 {
+		sql = sql[:1024]
+	}
+	return strings.TrimSpace(versionedComments.ReplaceAllString(sql, ""))
+}
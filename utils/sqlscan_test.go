@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func scanAll(t *testing.T, dump string, dialect Dialect) []*Statement {
+	t.Helper()
+	var stmts []*Statement
+	sc := NewStatementScanner(strings.NewReader(dump), dialect)
+	for {
+		stmt, err := sc.Next()
+		if err == io.EOF {
+			return stmts
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		stmts = append(stmts, stmt)
+	}
+}
+
+const mysqlDump = "-- MySQL dump\n" +
+	"/*!40101 SET NAMES utf8mb4 */;\n" +
+	"CREATE DATABASE /*!32312 IF NOT EXISTS*/ `app` /*!40100 DEFAULT CHARACTER SET utf8mb4 */;\n" +
+	"USE `app`;\n" +
+	"DROP TABLE IF EXISTS `users`;\n" +
+	"CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `note` text -- not a ; terminator\n);\n" +
+	"INSERT INTO `users` VALUES (1,'a;b'),(2,'it\\'s'),(3,'x');\n" +
+	"INSERT INTO `logs` VALUES (1);\n" +
+	"DELIMITER ;;\n" +
+	"/*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `t1` BEFORE INSERT ON `users` FOR EACH ROW SET NEW.id = 1; */;;\n" +
+	"DELIMITER ;\n" +
+	"CREATE USER IF NOT EXISTS 'bob'@'%' IDENTIFIED BY 'x';\n" +
+	"GRANT SELECT ON `app`.* TO 'bob'@'%';\n"
+
+func TestScanMySQLDump(t *testing.T) {
+	stmts := scanAll(t, mysqlDump, DialectMySQL)
+
+	var text strings.Builder
+	for _, s := range stmts {
+		text.WriteString(s.Text)
+	}
+	if text.String() != mysqlDump {
+		t.Fatalf("statements do not add up to the dump:\n%s", text.String())
+	}
+
+	want := []struct {
+		scope, action, object string
+		name                  string
+	}{
+		{ScopeSession, "", "", ""},
+		{ScopeDatabase, "create", "database", "app"},
+		{ScopeUse, "use", "", ""},
+		{ScopeTable, "drop", "table", "users"},
+		{ScopeTable, "create", "table", "users"},
+		{ScopeTable, "insert", "table", "users"},
+		{ScopeTable, "insert", "table", "logs"},
+		{ScopeSession, "", "", ""},
+		{ScopeTable, "create", "trigger", "t1"},
+		{ScopeSession, "", "", ""},
+		{ScopeGlobal, "create", "user", "bob@%"},
+		{ScopeGlobal, "grant", "privileges", ""},
+	}
+	if len(stmts) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(stmts), len(want))
+	}
+	for i, w := range want {
+		info := ClassifyStatement(stmts[i], DialectMySQL)
+		name := strings.Join(info.Name, ".")
+		if info.Scope != w.scope || info.Action != w.action || info.Object != w.object || (w.name != "" && name != w.name) {
+			t.Errorf("statement %d %q: got %+v", i, stmts[i].SQL(), info)
+		}
+	}
+	if rows := ClassifyStatement(stmts[5], DialectMySQL).Rows; rows != 3 {
+		t.Errorf("insert rows = %d, want 3", rows)
+	}
+}
+
+const pgDump = "\\connect -reuse-previous=on \"dbname='app'\"\n" +
+	"SET statement_timeout = 0;\n" +
+	"SELECT 'CREATE DATABASE \"shop\" WITH TEMPLATE = template0' WHERE NOT EXISTS (SELECT FROM pg_database WHERE datname = 'shop')\\gexec\n" +
+	"DO $ccdc$BEGIN CREATE ROLE bob; EXCEPTION WHEN duplicate_object THEN NULL; END$ccdc$;\n" +
+	"CREATE FUNCTION public.f() RETURNS trigger\n    LANGUAGE plpgsql\n    AS $$\nBEGIN\n  RETURN NEW; -- ;\nEND;\n$$;\n" +
+	"CREATE TABLE public.users (\n    id integer\n);\n" +
+	"CREATE TABLE audit.log (\n    id integer\n);\n" +
+	"COPY public.users (id) FROM stdin;\n1\n2\n\\.\n" +
+	"CREATE INDEX users_idx ON public.users USING btree (id);\n" +
+	"CREATE TRIGGER trg BEFORE INSERT ON audit.log FOR EACH ROW EXECUTE FUNCTION public.f();\n" +
+	"ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;\n" +
+	"DROP SEQUENCE IF EXISTS public.other_seq;\n" +
+	"GRANT SELECT ON TABLE audit.log TO bob;\n" +
+	"GRANT admin TO bob;\n"
+
+func TestScanPostgresDump(t *testing.T) {
+	stmts := scanAll(t, pgDump, DialectPostgres)
+
+	want := []struct {
+		scope, action, object string
+		table                 string
+	}{
+		{ScopeUse, "connect", "", ""},
+		{ScopeSession, "", "", ""},
+		{ScopeDatabase, "create", "database", ""},
+		{ScopeGlobal, "create", "role", ""},
+		{ScopeObject, "create", "function", ""},
+		{ScopeTable, "create", "table", "public.users"},
+		{ScopeTable, "create", "table", "audit.log"},
+		{ScopeTable, "copy", "table", "public.users"},
+		{ScopeTable, "create", "index", "public.users"},
+		{ScopeTable, "create", "trigger", "audit.log"},
+		{ScopeTable, "alter", "sequence", "public.users"},
+		{ScopeObject, "drop", "sequence", ""},
+		{ScopeTable, "grant", "privileges", "audit.log"},
+		{ScopeGlobal, "grant", "role membership", ""},
+	}
+	if len(stmts) != len(want) {
+		for _, s := range stmts {
+			t.Logf("%q", s.Text)
+		}
+		t.Fatalf("got %d statements, want %d", len(stmts), len(want))
+	}
+	for i, w := range want {
+		info := ClassifyStatement(stmts[i], DialectPostgres)
+		if info.Scope != w.scope || info.Action != w.action || info.Object != w.object || strings.Join(info.Table, ".") != w.table {
+			t.Errorf("statement %d %q: got %+v", i, stmts[i].SQL(), info)
+		}
+	}
+	if db := ClassifyStatement(stmts[0], DialectPostgres).Database; db != "app" {
+		t.Errorf("\\connect database = %q, want app", db)
+	}
+	if db := ClassifyStatement(stmts[2], DialectPostgres).Database; db != "shop" {
+		t.Errorf("CREATE DATABASE via \\gexec = %q, want shop", db)
+	}
+	if rows := ClassifyStatement(stmts[7], DialectPostgres).Rows; rows != 2 {
+		t.Errorf("copy rows = %d, want 2", rows)
+	}
+}
+
+func TestFilterDump(t *testing.T) {
+	tests := []struct {
+		name                       string
+		dialect                    Dialect
+		dump                       string
+		databases, tables, exclude []string
+		keep, drop                 []string
+	}{
+		{
+			name: "mysql table", dialect: DialectMySQL, dump: mysqlDump,
+			tables: []string{"app.users"},
+			keep:   []string{"USE `app`", "INSERT INTO `users`", "TRIGGER `t1`", "DELIMITER ;;", "CREATE DATABASE"},
+			drop:   []string{"INSERT INTO `logs`", "CREATE USER", "GRANT"},
+		},
+		{
+			name: "mysql exclude database", dialect: DialectMySQL, dump: mysqlDump,
+			exclude: []string{"app"},
+			keep:    []string{"SET NAMES"},
+			drop:    []string{"USE `app`", "INSERT INTO", "CREATE DATABASE", "CREATE USER"},
+		},
+		{
+			name: "postgres exclude table", dialect: DialectPostgres, dump: pgDump,
+			exclude: []string{"app.audit.log"},
+			keep:    []string{"CREATE TABLE public.users", "COPY public.users", "\n1\n2\n\\.\n", "CREATE FUNCTION", "CREATE DATABASE"},
+			drop:    []string{"CREATE TABLE audit.log", "CREATE TRIGGER", "GRANT SELECT", "DROP SEQUENCE", "CREATE ROLE", "GRANT admin"},
+		},
+		{
+			name: "postgres other database", dialect: DialectPostgres, dump: pgDump,
+			databases: []string{"shop"},
+			keep:      []string{"CREATE DATABASE"},
+			drop:      []string{"\\connect", "CREATE TABLE", "COPY"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := ParseSelector(tt.dialect, tt.databases, tt.tables, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			if err := FilterDump(strings.NewReader(tt.dump), &out, sel, ""); err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range tt.keep {
+				if !strings.Contains(out.String(), k) {
+					t.Errorf("%q was dropped", k)
+				}
+			}
+			for _, d := range tt.drop {
+				if strings.Contains(out.String(), d) {
+					t.Errorf("%q was kept", d)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	sel, err := ParseSelector(DialectPostgres, []string{"app"}, []string{"shop.orders", "shop.sales.items"}, []string{"app.public.tmp", "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sel.SelectedDatabases(); !slices.Equal(got, []string{"app", "shop"}) {
+		t.Errorf("SelectedDatabases = %v", got)
+	}
+	checks := []struct {
+		db, schema, table string
+		want              bool
+	}{
+		{"app", "public", "users", true},
+		{"app", "public", "tmp", false},
+		{"shop", "public", "orders", true},
+		{"shop", "sales", "orders", false},
+		{"shop", "sales", "items", true},
+		{"old", "public", "users", false},
+		{"other", "public", "users", false},
+	}
+	for _, c := range checks {
+		if got := sel.IncludesTable(c.db, c.schema, c.table); got != c.want {
+			t.Errorf("IncludesTable(%s, %s, %s) = %v, want %v", c.db, c.schema, c.table, got, c.want)
+		}
+	}
+
+	if _, err := ParseSelector(DialectMySQL, nil, []string{"app.public.users"}, nil); err == nil {
+		t.Error("MySQL accepted a three part table")
+	}
+}
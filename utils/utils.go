@@ -2,7 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 
 	"golang.org/x/term"
@@ -11,6 +13,8 @@ import (
 var (
 	askedPass      bool
 	cachedPassword string
+	// answeredSecrets are handed on to a --daemon process
+	answeredSecrets []string
 )
 
 func GetPassword() (string, error) {
@@ -18,19 +22,39 @@ func GetPassword() (string, error) {
 		return cachedPassword, nil
 	}
 
-	fmt.Print("Enter Password: ")
+	password, err := ReadSecret("Enter Password: ")
+	if err != nil {
+		return "", err
+	}
+	cachedPassword = password
+	askedPass = true
+	return password, nil
+}
+
+// ReadSecret prompts for a value without echoing it. A --daemon process reads
+// it from the line its parent wrote to stdin instead.
+func ReadSecret(prompt string) (string, error) {
+	if IsDaemonChild() {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("no value passed for %q: %w", strings.TrimSpace(prompt), err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	// The prompt goes to stderr so structured output on stdout stays parseable
+	fmt.Fprint(os.Stderr, prompt)
 
 	// syscall.Stdin is the file descriptor for standard input
 	// ReadPassword disables terminal echo automatically
-	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+	secret, err := term.ReadPassword(int(syscall.Stdin))
 	if err != nil {
 		return "", err
 	}
 
-	fmt.Println() // Print a newline because ReadPassword doesn't
-	cachedPassword = string(bytePassword)
-	askedPass = true
-	return string(bytePassword), nil
+	fmt.Fprintln(os.Stderr) // Print a newline because ReadPassword doesn't
+	answeredSecrets = append(answeredSecrets, string(secret))
+	return string(secret), nil
 }
 
 func PrintHeader(header string) {
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"strings"
+)
+
+// CommandLines reads lines typed on stdin in the background so a watch loop
+// can react to them without blocking. The channel is closed on EOF.
+func CommandLines() <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := stdinReader.ReadString('\n')
+			if line = strings.TrimSpace(line); line != "" {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return lines
+}
+
+// Truncate collapses whitespace in s and cuts it to at most n characters.
+func Truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > n {
+		return s[:n-3] + "..."
+	}
+	return s
+}